@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -10,7 +11,15 @@ import (
 	"time"
 
 	apiserver "github.com/OODemi52/chronocast-server/internal/api-server"
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/media-server/embedded"
 	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
 	"github.com/joho/godotenv"
 )
 
@@ -26,21 +35,39 @@ func main() {
 
 	flag.Parse()
 
-	rtmpServer, err := rtmpserver.NewServer(*rtmpPort)
+	if err := auth.InitKeyStore(config.GetKeyStoreConfig()); err != nil {
+		log.Fatalf("Failed to initialize stream key store: %v", err)
+	}
+
+	mediaServer, err := newMediaServer(*rtmpPort)
 
 	if err != nil {
 		log.Fatalf("Failed to initialize RTMP server: %v", err)
 	}
 
-	go func() {
+	multiStreamService, err := multistream.NewMultiStreamService()
 
-		if err := rtmpServer.Start(); err != nil {
-			log.Fatalf("RTMP server failed to start: %v", err)
-		}
+	if err != nil {
+		log.Printf("Warning: Failed to initialize MultiStreamService: %v", err)
+	}
 
-	}()
+	streamLifecycle := lifecycle.NewManager(mediaServer, multiStreamService)
+
+	ingestService := ingest.NewService(mediaServer, streamLifecycle)
+
+	// The embedded server checks publishes itself rather than through the
+	// SRS hooks, and SRS reports the publishers it lost when it exits.
+	if setter, ok := mediaServer.(mediaserver.IngestHandlerSetter); ok {
+		setter.SetIngestHandler(ingestService)
+	}
+
+	go startMediaServer(mediaServer)
 
-	apiServer, err := apiserver.NewServer(*apiPort, rtmpServer)
+	streamScheduler := scheduler.NewScheduler(mediaServer, multiStreamService, streamLifecycle)
+
+	go streamScheduler.Start()
+
+	apiServer, err := apiserver.NewServer(*apiPort, mediaServer, multiStreamService, streamLifecycle, ingestService, streamScheduler)
 
 	if err != nil {
 		log.Fatalf("Failed to initialize API server: %v", err)
@@ -54,11 +81,57 @@ func main() {
 
 	}()
 
-	handleServerShutdown(apiServer, rtmpServer)
+	handleServerShutdown(apiServer, mediaServer, streamScheduler)
+
+}
+
+// newMediaServer creates the media server MEDIA_SERVER selects.
+func newMediaServer(rtmpPort string) (mediaserver.MediaServer, error) {
+
+	switch backend := config.GetMediaServerConfig().Backend; backend {
+
+	case "srs":
+		return rtmpserver.NewServer(rtmpPort)
+
+	case "embedded":
+		return embedded.NewServer(rtmpPort)
+
+	default:
+		return nil, fmt.Errorf("unknown media server %q, expected \"srs\" or \"embedded\"", backend)
+
+	}
 
 }
 
-func handleServerShutdown(apiServer *apiserver.APIServer, rtmpServer *rtmpserver.SimpleRealtimeServer) {
+func startMediaServer(mediaServer mediaserver.MediaServer) {
+
+	srs, isSRS := mediaServer.(*rtmpserver.SimpleRealtimeServer)
+
+	// An SRS launched by the server reads srs.conf on start.
+	if isSRS && srs.Mode == rtmpserver.SRSModeProcess {
+
+		if err := srs.WriteConfig(); err != nil {
+			log.Printf("Warning: Failed to write SRS config: %v", err)
+		}
+
+	}
+
+	if err := mediaServer.Start(); err != nil {
+		log.Fatalf("RTMP server failed to start: %v", err)
+	}
+
+	// One that was already running is given it and reloads.
+	if isSRS && srs.Mode != rtmpserver.SRSModeProcess {
+
+		if err := srs.ApplyConfig(); err != nil {
+			log.Printf("Warning: Failed to apply SRS config: %v", err)
+		}
+
+	}
+
+}
+
+func handleServerShutdown(apiServer *apiserver.APIServer, mediaServer mediaserver.MediaServer, streamScheduler *scheduler.Scheduler) {
 
 	sigChan := make(chan os.Signal, 1)
 
@@ -84,12 +157,20 @@ func handleServerShutdown(apiServer *apiserver.APIServer, rtmpServer *rtmpserver
 
 	}
 
+	log.Println("Stopping scheduler...")
+
+	streamScheduler.Stop()
+
 	log.Println("Stopping RTMP server...")
 
-	if err := rtmpServer.Stop(); err != nil {
+	if err := mediaServer.Stop(); err != nil {
 		log.Printf("RTMP server shutdown error: %v", err)
 	}
 
+	if err := auth.CloseKeyStore(); err != nil {
+		log.Printf("Stream key store shutdown error: %v", err)
+	}
+
 	log.Println("Shutdown complete")
 
 }
@@ -4,6 +4,7 @@ go 1.24.1
 
 require (
 	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.4.0
 	golang.org/x/oauth2 v0.28.0
 	google.golang.org/api v0.228.0
 )
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// AdminClientsHandler lists the media server's connections
+// (GET /api/admin/clients[?streamId=]) and disconnects one of them, publisher
+// or player (DELETE /api/admin/clients/{clientId}).
+func AdminClientsHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		clientID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/clients"), "/")
+
+		if clientID == "" {
+
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			clients, err := mediaServer.Clients(r.Context(), r.URL.Query().Get("streamId"))
+
+			if err != nil {
+				log.Printf("Failed to list clients: %v", err)
+				http.Error(w, "Failed to list clients", http.StatusBadGateway)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, clients)
+
+			return
+
+		}
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := mediaServer.KickClient(clientID)
+
+		if errors.Is(err, mediaserver.ErrClientNotFound) {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Failed to kick client: %v", err)
+			http.Error(w, "Failed to disconnect client", http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	}
+
+}
+
+// AdminRelaysHandler lists the state of every platform relay
+// (GET /api/admin/relays).
+func AdminRelaysHandler(multiStreamService *multistream.MultiStreamService) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		relays := []types.RelayStatus{}
+
+		if multiStreamService != nil {
+			relays = multiStreamService.Relays("")
+		}
+
+		writeJSON(w, http.StatusOK, relays)
+
+	}
+
+}
+
+// AdminStreamHandler disconnects the encoder publishing on a stream key
+// (DELETE /api/admin/streams/{id}/publisher). With ?revoke=true the key is
+// revoked first, so an encoder that reconnects on its own is refused: the
+// kill switch for a leaked key.
+func AdminStreamHandler(mediaServer mediaserver.MediaServer, streamLifecycle *lifecycle.Manager) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/streams/"), "/")
+
+		if len(parts) != 2 || parts[0] == "" || parts[1] != "publisher" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		streamID := parts[0]
+
+		publisher, publishing := mediaServer.Publishers().Active(streamID)
+
+		revoked := false
+
+		if r.URL.Query().Get("revoke") == "true" {
+
+			userID := publisher.UserID
+
+			if !publishing {
+
+				stream, err := streamLifecycle.Get(streamID)
+
+				if err != nil {
+					http.Error(w, "Stream not found", http.StatusNotFound)
+					return
+				}
+
+				userID = stream.UserID
+
+			}
+
+			record, exists := auth.FindStreamKeyForUser(userID, streamID)
+
+			if !exists || record.ID != streamID {
+				http.Error(w, "Stream key not found", http.StatusNotFound)
+				return
+			}
+
+			if err := auth.RevokeStreamKeyRecord(record); err != nil {
+				log.Printf("Failed to revoke stream key: %v", err)
+				http.Error(w, "Failed to revoke stream key", http.StatusInternalServerError)
+				return
+			}
+
+			log.Printf("Stream key %s revoked by admin", streamID)
+
+			revoked = true
+
+		}
+
+		kicked, err := mediaServer.KickPublisher(streamID)
+
+		if errors.Is(err, mediaserver.ErrStreamNotLive) || errors.Is(err, mediaserver.ErrClientNotFound) {
+
+			if !revoked {
+				http.Error(w, "Stream is not live", http.StatusNotFound)
+				return
+			}
+
+		} else if err != nil {
+			log.Printf("Failed to kick publisher: %v", err)
+			http.Error(w, "Failed to disconnect publisher", http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			StreamID string `json:"streamId"`
+			ClientID string `json:"clientId,omitempty"`
+			Kicked   bool   `json:"kicked"`
+			Revoked  bool   `json:"revoked"`
+		}{
+			StreamID: streamID,
+			ClientID: kicked.ClientID,
+			Kicked:   kicked.ClientID != "",
+			Revoked:  revoked,
+		})
+
+	}
+
+}
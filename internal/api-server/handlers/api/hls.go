@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+)
+
+const (
+	hlsFetchTimeout    = 10 * time.Second
+	maxHLSPlaylistSize = 1 << 20
+)
+
+// HLSHandler plays what is published on a stream key over HLS at
+// /api/hls/{keyID}.m3u8. The media server names its output after the
+// stream name, which is usually the stream key itself, so the playlist is
+// fetched from it with the stream name replaced by the key ID, and the
+// segments it then lists are fetched the same way.
+func HLSHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	client := &http.Client{Timeout: hlsFetchTimeout}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		file := strings.TrimPrefix(r.URL.Path, "/api/hls/")
+
+		var keyID, suffix string
+
+		if name, playlist := strings.CutSuffix(file, ".m3u8"); playlist {
+
+			keyID, suffix = name, ".m3u8"
+
+		} else if name, segment := strings.CutSuffix(file, ".ts"); segment {
+
+			// Segments are named <stream>-<sequence number>.ts.
+			if separator := strings.LastIndex(name, "-"); separator > 0 {
+				keyID, suffix = name[:separator], name[separator:]+".ts"
+			}
+
+		}
+
+		publisher, publishing := mediaServer.Publishers().Active(keyID)
+
+		if keyID == "" || strings.Contains(keyID, "/") || !publishing {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+
+		source := mediaServer.GetHLSURL(publisher.Stream + suffix)
+
+		if source == "" {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+
+		// SRS tracks HLS viewers with a query parameter it adds.
+		if r.URL.RawQuery != "" {
+			source += "?" + r.URL.RawQuery
+		}
+
+		request, err := http.NewRequestWithContext(r.Context(), http.MethodGet, source, nil)
+
+		if err != nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+
+		response, err := client.Do(request)
+
+		if err != nil {
+			log.Printf("Failed to fetch HLS for key %s: %v", keyID, err)
+			http.Error(w, "Failed to fetch stream", http.StatusBadGateway)
+			return
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			http.Error(w, http.StatusText(response.StatusCode), response.StatusCode)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if suffix != ".m3u8" {
+
+			w.Header().Set("Content-Type", "video/mp2t")
+
+			io.Copy(w, response.Body)
+
+			return
+
+		}
+
+		playlist, err := io.ReadAll(io.LimitReader(response.Body, maxHLSPlaylistSize))
+
+		if err != nil {
+			log.Printf("Failed to fetch HLS for key %s: %v", keyID, err)
+			http.Error(w, "Failed to fetch stream", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+
+		w.Write([]byte(strings.ReplaceAll(string(playlist), publisher.Stream, keyID)))
+
+	}
+
+}
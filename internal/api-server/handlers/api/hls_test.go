@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+)
+
+func TestHLSHandler(t *testing.T) {
+
+	// SRS's HTTP server, with the output of a stream published under its
+	// stream key.
+	var fetched []string
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		fetched = append(fetched, r.URL.RequestURI())
+
+		switch r.URL.Path {
+
+		case "/live/the-stream-key.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXTINF:10.000,\nthe-stream-key-3.ts?hls_ctx=viewer\n"))
+
+		case "/live/the-stream-key-3.ts":
+			w.Write([]byte("segment"))
+
+		default:
+			http.NotFound(w, r)
+
+		}
+
+	}))
+
+	t.Cleanup(origin.Close)
+
+	originURL, _ := url.Parse(origin.URL)
+
+	t.Setenv("SRS_HTTP_PORT", originURL.Port())
+
+	_, srs := newTestSRS(t, "reject")
+
+	srs.Publishers().Claim(mediaserver.Publisher{KeyID: "key-id", Stream: "the-stream-key", ClientID: "1"})
+
+	handler := HLSHandler(srs)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    int
+		body    string
+		fetched string
+	}{
+		{
+			name:    "playlist",
+			path:    "/api/hls/key-id.m3u8",
+			want:    http.StatusOK,
+			body:    "#EXTM3U\n#EXTINF:10.000,\nkey-id-3.ts?hls_ctx=viewer\n",
+			fetched: "/live/the-stream-key.m3u8",
+		},
+		{
+			name:    "segment",
+			path:    "/api/hls/key-id-3.ts?hls_ctx=viewer",
+			want:    http.StatusOK,
+			body:    "segment",
+			fetched: "/live/the-stream-key-3.ts?hls_ctx=viewer",
+		},
+		{name: "missing segment", path: "/api/hls/key-id-4.ts", want: http.StatusNotFound, fetched: "/live/the-stream-key-4.ts"},
+		{name: "key not publishing", path: "/api/hls/other-key.m3u8", want: http.StatusNotFound},
+		{name: "not HLS", path: "/api/hls/key-id.mp4", want: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			fetched = nil
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if w.Code != test.want {
+				t.Fatalf("got status %d, want %d", w.Code, test.want)
+			}
+
+			if test.body != "" && w.Body.String() != test.body {
+				t.Fatalf("got body %q, want %q", w.Body.String(), test.body)
+			}
+
+			if strings.Contains(w.Body.String(), "the-stream-key") {
+				t.Fatalf("the response gives away the stream key: %q", w.Body.String())
+			}
+
+			if test.fetched == "" && len(fetched) > 0 || test.fetched != "" && (len(fetched) != 1 || fetched[0] != test.fetched) {
+				t.Fatalf("fetched %v, want %q", fetched, test.fetched)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+const defaultRotationGracePeriod = 15 * time.Minute
+
+func StreamKeysHandler(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+
+	case http.MethodGet:
+		userID := r.URL.Query().Get("userID")
+
+		if userID == "" {
+			http.Error(w, "Missing userID", http.StatusBadRequest)
+			return
+		}
+
+		keys := []types.StreamKeyResponse{}
+
+		for _, record := range auth.ListStreamKeysForUser(userID) {
+			keys = append(keys, streamKeyResponse(record))
+		}
+
+		writeJSON(w, http.StatusOK, keys)
+
+	case http.MethodPost:
+		record, streamKey, ok := createStreamKey(w, r)
+
+		if !ok {
+			return
+		}
+
+		response := streamKeyResponse(record)
+
+		response.StreamKey = streamKey
+
+		writeJSON(w, http.StatusCreated, response)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+	}
+
+}
+
+func ManageStreamKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+
+	userID := r.URL.Query().Get("userID")
+
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "Invalid stream key ID", http.StatusBadRequest)
+		return
+	}
+
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	record, exists := auth.FindStreamKeyForUser(userID, id)
+
+	if !exists || record.ID != id {
+		http.Error(w, "Stream key not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, streamKeyResponse(record))
+
+	case http.MethodDelete:
+		if err := auth.RevokeStreamKeyRecord(record); err != nil {
+			log.Printf("Failed to revoke stream key %s: %v", record.ID, err)
+			http.Error(w, "Failed to revoke stream key", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+	}
+
+}
+
+func RotateStreamKeyHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		UserID      string `json:"userID"`
+		KeyID       string `json:"keyID"`
+		StreamKey   string `json:"streamKey"`
+		GracePeriod string `json:"gracePeriod"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if request.UserID == "" || request.KeyID == "" && request.StreamKey == "" {
+		http.Error(w, "Missing userID, and keyID or streamKey", http.StatusBadRequest)
+		return
+	}
+
+	grace := defaultRotationGracePeriod
+
+	if request.GracePeriod != "" {
+
+		parsed, err := time.ParseDuration(request.GracePeriod)
+
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid gracePeriod, expected a duration such as \"15m\"", http.StatusBadRequest)
+			return
+		}
+
+		grace = parsed
+
+	}
+
+	keyID := request.KeyID
+
+	if request.StreamKey != "" {
+
+		record, err := auth.LookupStreamKey(request.StreamKey)
+
+		if err != nil || record.UserID != request.UserID {
+			http.Error(w, "Stream key not found for user", http.StatusNotFound)
+			return
+		}
+
+		keyID = record.ID
+
+	}
+
+	replacement, streamKey, previous, err := auth.RotateStreamKey(request.UserID, keyID, grace)
+
+	if errors.Is(err, auth.ErrStreamKeyNotFound) {
+		http.Error(w, "Stream key not found for user", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to rotate stream key: %v", err)
+		http.Error(w, "Failed to rotate stream key", http.StatusInternalServerError)
+		return
+	}
+
+	response := streamKeyResponse(replacement)
+
+	response.StreamKey = streamKey
+
+	writeJSON(w, http.StatusOK, struct {
+		types.StreamKeyResponse
+		PreviousKeyExpiresAt time.Time `json:"previousKeyExpiresAt"`
+	}{
+		StreamKeyResponse:    response,
+		PreviousKeyExpiresAt: previous.ExpiresAt,
+	})
+
+}
+
+func createStreamKey(w http.ResponseWriter, r *http.Request) (auth.StreamKeyRecord, string, bool) {
+
+	var request struct {
+		UserID    string `json:"userID"`
+		Name      string `json:"name"`
+		TTL       string `json:"ttl"`
+		SingleUse bool   `json:"singleUse"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return auth.StreamKeyRecord{}, "", false
+	}
+
+	if request.UserID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return auth.StreamKeyRecord{}, "", false
+	}
+
+	options := auth.StreamKeyOptions{
+		Name:      strings.TrimSpace(request.Name),
+		SingleUse: request.SingleUse,
+	}
+
+	if request.TTL != "" {
+
+		ttl, err := time.ParseDuration(request.TTL)
+
+		if err != nil || ttl <= 0 {
+			http.Error(w, "Invalid ttl, expected a positive duration such as \"4h\"", http.StatusBadRequest)
+			return auth.StreamKeyRecord{}, "", false
+		}
+
+		options.TTL = ttl
+
+	}
+
+	record, streamKey, err := auth.CreateStreamKey(request.UserID, options)
+
+	if errors.Is(err, auth.ErrStreamKeyNameUsed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return auth.StreamKeyRecord{}, "", false
+	}
+
+	if err != nil {
+		log.Printf("Failed to generate stream key: %v", err)
+		http.Error(w, "Failed to generate stream key", http.StatusInternalServerError)
+		return auth.StreamKeyRecord{}, "", false
+	}
+
+	return record, streamKey, true
+
+}
+
+// resolveStreamKey selects the stream key a stream or schedule publishes
+// on, by ID or name. A client that presents the plaintext key instead has
+// it checked, and any ID or name given must then refer to the same key.
+func resolveStreamKey(w http.ResponseWriter, userID, streamKey, keyID, keyName string) (auth.StreamKeyRecord, bool) {
+
+	if streamKey == "" {
+
+		selector := keyID
+
+		if selector == "" {
+			selector = keyName
+		}
+
+		// Requests from before keys were selected explicitly name no key
+		// and get the user's newest one, as they used to.
+		if selector == "" {
+
+			record, exists := auth.FindStreamKeyForUser(userID, "")
+
+			if !exists {
+				http.Error(w, "Missing keyID, keyName or streamKey", http.StatusBadRequest)
+				return auth.StreamKeyRecord{}, false
+			}
+
+			log.Printf("Deprecated request for user %s names no stream key, using key %s", userID, record.ID)
+
+			w.Header().Set("Deprecation", "true")
+
+			return record, true
+
+		}
+
+		record, exists := auth.FindStreamKeyForUser(userID, selector)
+
+		if !exists || keyID != "" && record.ID != keyID || keyID == "" && record.Name != keyName {
+			http.Error(w, "Stream key not found for user", http.StatusNotFound)
+			return auth.StreamKeyRecord{}, false
+		}
+
+		return record, true
+
+	}
+
+	record, err := auth.LookupStreamKey(streamKey)
+
+	if err != nil || record.UserID != userID {
+		http.Error(w, "Stream key not found for user", http.StatusUnauthorized)
+		return auth.StreamKeyRecord{}, false
+	}
+
+	if keyID != "" && record.ID != keyID || keyName != "" && record.Name != keyName {
+		http.Error(w, "streamKey does not match the selected key", http.StatusBadRequest)
+		return auth.StreamKeyRecord{}, false
+	}
+
+	return record, true
+
+}
+
+func streamKeyResponse(record auth.StreamKeyRecord) types.StreamKeyResponse {
+
+	return types.StreamKeyResponse{
+		ID:        record.ID,
+		Name:      record.Name,
+		Prefix:    record.Prefix,
+		SingleUse: record.SingleUse,
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.ExpiresAt,
+		UsedAt:    record.UsedAt,
+	}
+
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+)
+
+func TestResolveStreamKey(t *testing.T) {
+
+	record, streamKey, err := auth.CreateStreamKey("resolve-user", auth.StreamKeyOptions{Name: "studio"})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		streamKey  string
+		keyID      string
+		keyName    string
+		status     int
+		deprecated bool
+	}{
+		{name: "by plaintext key", userID: "resolve-user", streamKey: streamKey, status: http.StatusOK},
+		{name: "by id", userID: "resolve-user", keyID: record.ID, status: http.StatusOK},
+		{name: "by name", userID: "resolve-user", keyName: "studio", status: http.StatusOK},
+		{name: "no key names the newest", userID: "resolve-user", status: http.StatusOK, deprecated: true},
+		{name: "no key and none exist", userID: "keyless-user", status: http.StatusBadRequest},
+		{name: "another user's key", userID: "other-user", streamKey: streamKey, status: http.StatusUnauthorized},
+		{name: "mismatched selectors", userID: "resolve-user", streamKey: streamKey, keyName: "other", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			w := httptest.NewRecorder()
+
+			resolved, ok := resolveStreamKey(w, test.userID, test.streamKey, test.keyID, test.keyName)
+
+			if ok != (test.status == http.StatusOK) || !ok && w.Code != test.status {
+				t.Fatalf("got ok %v and status %d, want status %d", ok, w.Code, test.status)
+			}
+
+			if ok && resolved.ID != record.ID {
+				t.Fatalf("resolved key %s, want %s", resolved.ID, record.ID)
+			}
+
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != test.deprecated {
+				t.Fatalf("got deprecated %v, want %v", deprecated, test.deprecated)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+const (
+	defaultPublishURLTTL = time.Hour
+	maxPublishURLTTL     = 7 * 24 * time.Hour
+)
+
+// PublishURLHandler hands out a signed, expiring publish URL for one of a
+// user's stream keys, so an encoder can be given access without being
+// given the key. Anyone holding a publish URL can take over the key's
+// ingest, so the route is behind the admin token.
+func PublishURLHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			UserID   string `json:"userID"`
+			KeyID    string `json:"keyID"`
+			KeyName  string `json:"keyName"`
+			TTL      string `json:"ttl"`
+			ClientIP string `json:"clientIP"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		selector := request.KeyID
+
+		if selector == "" {
+			selector = request.KeyName
+		}
+
+		if request.UserID == "" || selector == "" {
+			http.Error(w, "Missing userID, and keyID or keyName", http.StatusBadRequest)
+			return
+		}
+
+		ttl := defaultPublishURLTTL
+
+		if request.TTL != "" {
+
+			parsed, err := time.ParseDuration(request.TTL)
+
+			if err != nil || parsed <= 0 || parsed > maxPublishURLTTL {
+				http.Error(w, "Invalid ttl, expected a positive duration of at most 168h", http.StatusBadRequest)
+				return
+			}
+
+			ttl = parsed
+
+		}
+
+		if request.ClientIP != "" && net.ParseIP(request.ClientIP) == nil {
+			http.Error(w, "Invalid clientIP", http.StatusBadRequest)
+			return
+		}
+
+		record, exists := auth.FindStreamKeyForUser(request.UserID, selector)
+
+		if !exists {
+			http.Error(w, "Stream key not found for user", http.StatusNotFound)
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl)
+
+		// A publish URL must not outlive the key it publishes to.
+		if !record.ExpiresAt.IsZero() && record.ExpiresAt.Before(expiresAt) {
+			expiresAt = record.ExpiresAt
+		}
+
+		token := auth.PublishToken{
+			UserID:    record.UserID,
+			KeyID:     record.ID,
+			ExpiresAt: expiresAt,
+			ClientIP:  request.ClientIP,
+		}
+
+		writeJSON(w, http.StatusCreated, types.PublishURLResponse{
+			URL:       mediaServer.PublicRTMPURL(record.ID) + "?" + token.Query(),
+			KeyID:     record.ID,
+			ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+			ClientIP:  request.ClientIP,
+		})
+
+	}
+
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+)
+
+// PublishersHandler lists who is publishing on each stream key and the
+// recent decisions made when a second encoder tried to use a live key.
+func PublishersHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		publishers, decisions := mediaServer.Publishers().List(r.URL.Query().Get("userID"))
+
+		writeJSON(w, http.StatusOK, struct {
+			Policy     mediaserver.PublisherPolicy     `json:"policy"`
+			Publishers []mediaserver.Publisher         `json:"publishers"`
+			Decisions  []mediaserver.PublisherDecision `json:"decisions"`
+		}{
+			Policy:     mediaServer.Publishers().Policy(),
+			Publishers: publishers,
+			Decisions:  decisions,
+		})
+
+	}
+
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(body)
+
+}
@@ -2,79 +2,186 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
 	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
 )
 
-type OnPublishRequest struct {
-	App    string `json:"app"`
-	Stream string `json:"stream"`
-	TcUrl  string `json:"tcUrl"`
-	Client string `json:"client_id"`
-	IP     string `json:"ip"`
-	Vhost  string `json:"vhost"`
-	Param  string `json:"param"`
+// HookRequest is the body SRS posts to its HTTP hooks. Every hook shares
+// the client and stream fields; on_dvr and on_hls add the file written and,
+// for HLS, the segment details.
+type HookRequest struct {
+	ServerID  string  `json:"server_id"`
+	Action    string  `json:"action"`
+	Client    string  `json:"client_id"`
+	IP        string  `json:"ip"`
+	Vhost     string  `json:"vhost"`
+	App       string  `json:"app"`
+	Stream    string  `json:"stream"`
+	Param     string  `json:"param"`
+	TcUrl     string  `json:"tcUrl"`
+	PageUrl   string  `json:"pageUrl"`
+	StreamURL string  `json:"stream_url"`
+	StreamID  string  `json:"stream_id"`
+	Cwd       string  `json:"cwd"`
+	File      string  `json:"file"`
+	URL       string  `json:"url"`
+	M3U8      string  `json:"m3u8"`
+	M3U8URL   string  `json:"m3u8_url"`
+	SeqNo     int     `json:"seq_no"`
+	Duration  float64 `json:"duration"`
 }
 
-type OnUnPublishRequest struct {
-	App    string `json:"app"`
-	Stream string `json:"stream"`
-	TcUrl  string `json:"tcUrl"`
-	Client string `json:"client_id"`
-	IP     string `json:"ip"`
-	Vhost  string `json:"vhost"`
-	Param  string `json:"param"`
+func RTMPPublishedHandler(ingestService *ingest.Service) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		req, ok := decodeHookRequest(w, r)
+
+		if !ok {
+			return
+		}
+
+		log.Printf("RTMP auth request received: app=%s stream=%s client=%s ip=%s", req.App, auth.MaskStreamKey(req.Stream), req.Client, req.IP)
+
+		if req.Stream == "" {
+			http.Error(w, "Missing stream key", http.StatusBadRequest)
+			return
+		}
+
+		_, err := ingestService.Publish(hookConnection(req))
+
+		switch {
+
+		case errors.Is(err, ingest.ErrKeyInUse):
+			http.Error(w, "Stream key is already in use", http.StatusConflict)
+			return
+
+		case errors.Is(err, ingest.ErrInvalidPublishToken):
+			http.Error(w, "Invalid publish token", http.StatusUnauthorized)
+			return
+
+		case err != nil:
+			http.Error(w, "Invalid stream key", http.StatusUnauthorized)
+			return
+
+		}
+
+		writeHookOK(w)
+
+	}
+
 }
 
-//TODO - Consider making a standard request type if it confirmed these two are the same
+func RTMPUnPublishedHandler(ingestService *ingest.Service) http.HandlerFunc {
 
-func RTMPPublishedHandler(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 
-	var req OnPublishRequest
+		req, ok := decodeHookRequest(w, r)
+
+		if !ok {
+			return
+		}
+
+		log.Printf("RTMP publish done: app=%s stream=%s client=%s ip=%s", req.App, auth.MaskStreamKey(req.Stream), req.Client, req.IP)
+
+		ingestService.Unpublish(hookConnection(req))
+
+		writeHookOK(w)
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to parse JSON payload: %v", err)
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-		return
 	}
 
-	log.Printf("RTMP auth request received with data: %+v", req)
+}
+
+// RTMPEventHandler handles the SRS hooks that only report activity:
+// on_connect, on_close, on_play, on_stop, on_dvr and on_hls. Each is turned
+// into an event on the server's event bus.
+func RTMPEventHandler(mediaServer mediaserver.MediaServer, eventType events.Type) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		req, ok := decodeHookRequest(w, r)
 
-	streamKey := req.Stream
+		if !ok {
+			return
+		}
 
-	log.Printf("Stream key received: %+v", streamKey)
+		keyID := hookStreamKeyID(mediaServer, req.Stream)
+
+		switch eventType {
+
+		case events.Play, events.Stop:
+			log.Printf("RTMP %s: app=%s stream=%s client=%s ip=%s", eventType, req.App, auth.MaskStreamKey(req.Stream), req.Client, req.IP)
+
+		case events.DVR:
+			log.Printf("RTMP recording written for key %s", keyID)
+
+		}
+
+		mediaServer.Events().Publish(hookEvent(eventType, req, keyID))
+
+		writeHookOK(w)
 
-	if streamKey == "" {
-		http.Error(w, "Missing stream key", http.StatusBadRequest)
-		return
 	}
 
-	if !auth.ValidateStreamKey(streamKey) {
-		http.Error(w, "Invalid stream key", http.StatusUnauthorized)
-		return
+}
+
+func hookConnection(req HookRequest) mediaserver.Connection {
+
+	return mediaserver.Connection{
+		ClientID: req.Client,
+		IP:       req.IP,
+		Protocol: hookProtocol(req.TcUrl),
+		App:      req.App,
+		Stream:   req.Stream,
+		Param:    req.Param,
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
+}
 
-	w.WriteHeader(http.StatusOK)
+// hookProtocol is the protocol a client came in on, from the scheme SRS
+// gives its tcUrl: "srt://" for SRT publishes, which SRS remuxes to RTMP,
+// "webrtc://" for WebRTC and "rtmp://" otherwise.
+func hookProtocol(tcURL string) string {
 
-	w.Write([]byte("0"))
+	scheme, _, found := strings.Cut(tcURL, "://")
+
+	switch {
+
+	case found && strings.EqualFold(scheme, mediaserver.ProtocolSRT):
+		return mediaserver.ProtocolSRT
+
+	case found && strings.EqualFold(scheme, "webrtc"):
+		return mediaserver.ProtocolWHIP
+
+	}
+
+	return mediaserver.ProtocolRTMP
 
 }
 
-func RTMPUnPublishedHandler(w http.ResponseWriter, r *http.Request) {
+func decodeHookRequest(w http.ResponseWriter, r *http.Request) (HookRequest, bool) {
 
-	var req OnUnPublishRequest
+	var req HookRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to parse JSON payload: %v", err)
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-		return
+		return req, false
 	}
 
-	log.Printf("RTMP publish done with data: %+v", req)
+	return req, true
+
+}
+
+// writeHookOK tells SRS to carry on; any other response rejects the client.
+func writeHookOK(w http.ResponseWriter) {
 
 	w.Header().Set("Content-Type", "text/plain")
 
@@ -83,3 +190,52 @@ func RTMPUnPublishedHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("0"))
 
 }
+
+// hookStreamKeyID works out which stream key a hook's stream name belongs
+// to. Streams published through a signed URL are named after the key ID.
+func hookStreamKeyID(mediaServer mediaserver.MediaServer, stream string) string {
+
+	if stream == "" {
+		return ""
+	}
+
+	if keyID, publishing := mediaServer.Publishers().StreamKeyID(stream); publishing {
+		return keyID
+	}
+
+	if record, err := auth.LookupStreamKey(stream); err == nil {
+		return record.ID
+	}
+
+	return ""
+
+}
+
+// hookEvent builds the bus event for a hook. File names and URLs contain
+// the stream name, so a plaintext key in them is masked.
+func hookEvent(eventType events.Type, req HookRequest, keyID string) events.Event {
+
+	redact := func(value string) string {
+
+		if req.Stream == "" || req.Stream == keyID {
+			return value
+		}
+
+		return strings.ReplaceAll(value, req.Stream, auth.MaskStreamKey(req.Stream))
+
+	}
+
+	return events.Event{
+		Type:     eventType,
+		ClientID: req.Client,
+		IP:       req.IP,
+		App:      req.App,
+		KeyID:    keyID,
+		File:     redact(req.File),
+		URL:      redact(req.URL),
+		Duration: req.Duration,
+		SeqNo:    req.SeqNo,
+		Relay:    mediaserver.IsRelayParam(req.Param),
+	}
+
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/api-server/middleware"
+	"github.com/OODemi52/chronocast-server/internal/config"
+	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi/srsapitest"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+)
+
+// hookStep is one hook SRS sends. Clients listed in connected are what the
+// fake SRS reports as connected when the hook arrives.
+type hookStep struct {
+	hook      string
+	client    string
+	stream    string
+	connected []string
+	want      int
+}
+
+func TestPublishHooks(t *testing.T) {
+
+	key, err := auth.GenerateStreamKey("hook-user")
+
+	if err != nil {
+		t.Fatalf("GenerateStreamKey: %v", err)
+	}
+
+	singleUse, err := auth.GenerateStreamKeyWithOptions("hook-user", auth.StreamKeyOptions{SingleUse: true})
+
+	if err != nil {
+		t.Fatalf("GenerateStreamKeyWithOptions: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		steps  []hookStep
+		kicked []string
+	}{
+		{
+			name:   "unknown key",
+			policy: "reject",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: "not-a-key", want: http.StatusUnauthorized},
+			},
+		},
+		{
+			name:   "reject keeps a connected publisher",
+			policy: "reject",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: key, connected: []string{"a"}, want: http.StatusOK},
+				{hook: "published", client: "b", stream: key, connected: []string{"a", "b"}, want: http.StatusConflict},
+			},
+		},
+		{
+			name:   "reject releases a publisher that is gone",
+			policy: "reject",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: key, want: http.StatusOK},
+				{hook: "published", client: "b", stream: key, connected: []string{"b"}, want: http.StatusOK},
+			},
+		},
+		{
+			name:   "unpublish frees the key",
+			policy: "reject",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: key, connected: []string{"a"}, want: http.StatusOK},
+				{hook: "unpublished", client: "a", stream: key, want: http.StatusOK},
+				{hook: "published", client: "b", stream: key, connected: []string{"b"}, want: http.StatusOK},
+			},
+		},
+		{
+			name:   "kick replaces the publisher",
+			policy: "kick",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: key, connected: []string{"a"}, want: http.StatusOK},
+				{hook: "published", client: "b", stream: key, connected: []string{"a", "b"}, want: http.StatusOK},
+			},
+			kicked: []string{"a"},
+		},
+		{
+			name:   "single-use key survives a hook retry",
+			policy: "reject",
+			steps: []hookStep{
+				{hook: "published", client: "a", stream: singleUse, connected: []string{"a"}, want: http.StatusOK},
+				{hook: "published", client: "a", stream: singleUse, connected: []string{"a"}, want: http.StatusOK},
+				{hook: "unpublished", client: "a", stream: singleUse, want: http.StatusOK},
+				{hook: "published", client: "b", stream: singleUse, connected: []string{"b"}, want: http.StatusUnauthorized},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			fake, ingestService := newHookTestServer(t, test.policy)
+
+			// The hooks pass through the authentication SRS retries meet,
+			// so a retry has to get past its duplicate check.
+			hookAuthentication := middleware.HookAuthentication(config.HookConfig{Secret: "secret", ReplayWindow: time.Minute})
+
+			published := hookAuthentication(RTMPPublishedHandler(ingestService))
+
+			unpublished := hookAuthentication(RTMPUnPublishedHandler(ingestService))
+
+			for i, step := range test.steps {
+
+				for _, client := range step.connected {
+					fake.AddClient(srsapi.ClientInfo{ID: client, Publish: true})
+				}
+
+				body, _ := json.Marshal(HookRequest{
+					Action: "on_" + strings.TrimSuffix(step.hook, "ed"),
+					Client: step.client,
+					IP:     "127.0.0.1",
+					App:    "live",
+					Stream: step.stream,
+					TcUrl:  "rtmp://localhost/live",
+				})
+
+				r := httptest.NewRequest(http.MethodPost, "/api/rtmp/"+step.hook+"?secret=secret", strings.NewReader(string(body)))
+
+				w := httptest.NewRecorder()
+
+				if step.hook == "published" {
+					published.ServeHTTP(w, r)
+				} else {
+					unpublished.ServeHTTP(w, r)
+				}
+
+				if w.Code != step.want {
+					t.Fatalf("step %d, %s from %s: got status %d, want %d", i, step.hook, step.client, w.Code, step.want)
+				}
+
+			}
+
+			if kicked := fake.Kicked(); !slices.Equal(kicked, test.kicked) {
+				t.Fatalf("kicked %v, want %v", kicked, test.kicked)
+			}
+
+		})
+
+	}
+
+}
+
+// newHookTestServer returns an ingest service on an SRS media server whose
+// API is a fake.
+func newHookTestServer(t *testing.T, policy string) (*srsapitest.Server, *ingest.Service) {
+
+	fake, srs := newTestSRS(t, policy)
+
+	return fake, ingest.NewService(srs, lifecycle.NewManager(srs, nil))
+
+}
+
+// newTestSRS returns an SRS media server whose API is a fake.
+func newTestSRS(t *testing.T, policy string) (*srsapitest.Server, *rtmpserver.SimpleRealtimeServer) {
+
+	fake := srsapitest.NewServer()
+
+	t.Cleanup(fake.Close)
+
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "srs.conf"))
+
+	t.Setenv("SRS_PATH", "/usr/local/srs/objs/srs")
+
+	t.Setenv("SRS_MODE", "external")
+
+	t.Setenv("SRS_API_URL", fake.URL)
+
+	t.Setenv("SRS_API_RETRIES", "0")
+
+	t.Setenv("HOOK_SECRET", "secret")
+
+	t.Setenv("PUBLISHER_POLICY", policy)
+
+	srs, err := rtmpserver.NewServer(":1935")
+
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	return fake, srs
+
+}
@@ -1,3 +1,280 @@
 package handlers
 
-//TODO - Implement stream scheduling
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func ScheduleStreamHandler(streamScheduler *scheduler.Scheduler) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		switch r.Method {
+
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, streamScheduler.ListSchedules(r.URL.Query().Get("userID")))
+
+		case http.MethodPost:
+			request, ok := decodeScheduleRequest(w, r)
+
+			if !ok {
+				return
+			}
+
+			schedule, err := streamScheduler.CreateSchedule(request)
+
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusCreated, schedule)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+		}
+
+	}
+
+}
+
+func ManageScheduleHandler(streamScheduler *scheduler.Scheduler) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/schedules/"), "/")
+
+		id := parts[0]
+
+		if id == "" {
+			http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+			return
+		}
+
+		if len(parts) > 1 {
+
+			if parts[1] != "occurrences" || len(parts) > 3 {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+
+			if len(parts) == 2 {
+				listOccurrences(w, r, streamScheduler, id)
+				return
+			}
+
+			manageOccurrence(w, r, streamScheduler, id, parts[2])
+
+			return
+
+		}
+
+		switch r.Method {
+
+		case http.MethodGet:
+			schedule, exists := streamScheduler.GetSchedule(id)
+
+			if !exists {
+				http.Error(w, "Schedule not found", http.StatusNotFound)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, schedule)
+
+		case http.MethodPut:
+			request, ok := decodeScheduleRequest(w, r)
+
+			if !ok {
+				return
+			}
+
+			schedule, err := streamScheduler.UpdateSchedule(id, request)
+
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, schedule)
+
+		case http.MethodDelete:
+			schedule, err := streamScheduler.CancelSchedule(id)
+
+			if err != nil {
+				writeScheduleError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, schedule)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+		}
+
+	}
+
+}
+
+func listOccurrences(w http.ResponseWriter, r *http.Request, streamScheduler *scheduler.Scheduler, id string) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 10
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+
+	}
+
+	occurrences, err := streamScheduler.ListOccurrences(id, limit)
+
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, occurrences)
+
+}
+
+func manageOccurrence(w http.ResponseWriter, r *http.Request, streamScheduler *scheduler.Scheduler, id, key string) {
+
+	var override types.OccurrenceOverride
+
+	switch r.Method {
+
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if override.StartTime != nil && override.StartTime.Before(time.Now()) {
+			http.Error(w, "startTime must be in the future", http.StatusBadRequest)
+			return
+		}
+
+	case http.MethodDelete:
+		override.Skip = true
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+
+	}
+
+	schedule, err := streamScheduler.SetOccurrenceOverride(id, key, override)
+
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schedule)
+
+}
+
+func decodeScheduleRequest(w http.ResponseWriter, r *http.Request) (types.ScheduleRequest, bool) {
+
+	var request types.ScheduleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.UserID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.Title == "" {
+		http.Error(w, "Missing title", http.StatusBadRequest)
+		return request, false
+	}
+
+	if len(request.Destinations) == 0 {
+		http.Error(w, "Missing destinations", http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.StartTime.IsZero() {
+		http.Error(w, "Missing startTime", http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.Recurrence == nil && request.StartTime.Before(time.Now()) {
+		http.Error(w, "startTime must be in the future", http.StatusBadRequest)
+		return request, false
+	}
+
+	if request.Privacy == "" {
+		request.Privacy = "public"
+	}
+
+	record, ok := resolveStreamKey(w, request.UserID, request.StreamKey, request.KeyID, request.KeyName)
+
+	if !ok {
+		return request, false
+	}
+
+	request.KeyID = record.ID
+
+	request.KeyName = record.Name
+
+	for i, destination := range request.Destinations {
+		request.Destinations[i] = strings.ToLower(destination)
+	}
+
+	return request, true
+
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+
+	switch {
+
+	case errors.Is(err, scheduler.ErrScheduleNotFound):
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+
+	case errors.Is(err, scheduler.ErrScheduleNotEditable), errors.Is(err, scheduler.ErrOccurrenceMaterialized):
+		http.Error(w, err.Error(), http.StatusConflict)
+
+	case errors.Is(err, scheduler.ErrInvalidRecurrence), errors.Is(err, scheduler.ErrScheduleNotRecurring):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+	case errors.Is(err, scheduler.ErrInvalidOccurrence):
+		http.Error(w, err.Error(), http.StatusNotFound)
+
+	case errors.Is(err, scheduler.ErrBroadcastsNotDeleted):
+		log.Printf("Schedule request failed: %v", err)
+		http.Error(w, scheduler.ErrBroadcastsNotDeleted.Error(), http.StatusBadGateway)
+
+	default:
+		log.Printf("Schedule request failed: %v", err)
+		http.Error(w, "Schedule request failed", http.StatusInternalServerError)
+
+	}
+
+}
@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
-	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
 	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
 	"github.com/OODemi52/chronocast-server/internal/services/multistream"
 	"github.com/OODemi52/chronocast-server/internal/types"
 )
@@ -17,59 +21,40 @@ func GenerateStreamKeyHandler(w http.ResponseWriter, r *http.Request) {
 	//		  and decode to get the user id. Short lived access, long lived refresh in http cookie
 	//		  Add CRSF proctection.
 
-	var request struct {
-		UserID string `json:"userID"`
-	}
+	record, streamKey, ok := createStreamKey(w, r)
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !ok {
 		return
 	}
 
-	if request.UserID == "" {
-		http.Error(w, "Missing userID", http.StatusBadRequest)
-		return
-	}
+	response := streamKeyResponse(record)
 
-	streamKey, err := auth.GenerateStreamKey(request.UserID)
+	response.StreamKey = streamKey
 
-	if err != nil {
-		http.Error(w, "Failed to generate stream key", http.StatusInternalServerError)
-		return
-	}
-
-	response := map[string]string{
-		"streamKey": streamKey,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 
 }
 
-func CreateStreamHandler(rtmpServer *rtmpserver.SimpleRealtimeServer) http.HandlerFunc {
+func CreateStreamHandler(mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService, streamLifecycle *lifecycle.Manager) http.HandlerFunc {
 	//TODO - This function is handling to many different responsibilities
 	//       Need to reasses scope and split it up
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		multiStreamService, err := multistream.NewMultiStreamService()
-
-		if err != nil {
-			log.Printf("Warning: Failed to initialize MultiStreamService: %v", err)
-		}
-
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		var request struct {
-			UserID       string   `json:"userID"`
-			Title        string   `json:"title"`
-			Description  string   `json:"description"`
-			Destinations []string `json:"destinations"`
+			UserID       string    `json:"userID"`
+			StreamKey    string    `json:"streamKey"`
+			KeyID        string    `json:"keyID"`
+			KeyName      string    `json:"keyName"`
+			Title        string    `json:"title"`
+			Description  string    `json:"description"`
+			Destinations []string  `json:"destinations"`
+			ScheduleTime time.Time `json:"scheduleTime"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -82,82 +67,120 @@ func CreateStreamHandler(rtmpServer *rtmpserver.SimpleRealtimeServer) http.Handl
 			return
 		} //TODO - Added checks for other fields in request type
 
-		streamKey, exists := auth.GetStreamKeyForUser(request.UserID)
+		record, ok := resolveStreamKey(w, request.UserID, request.StreamKey, request.KeyID, request.KeyName)
 
-		if !exists {
-			http.Error(w, "Stream key not found for user", http.StatusUnauthorized)
+		if !ok {
 			return
 		}
 
-		inputStreamURL := rtmpServer.GetIngestURL(streamKey)
+		if multiStreamService == nil {
 
-		var destinations []rtmpserver.StreamDestination
+			errMsg := "Multi-streaming service temporarily unavailable"
 
-		if multiStreamService != nil {
+			log.Printf("ERROR: MultiStreamService unavailable")
 
-			//TODO - Form validation and sanitization (client and server)
-			// Convert destinations to lowercase for case-insensitive matching
-			for i, destination := range request.Destinations {
-				request.Destinations[i] = strings.ToLower(destination)
-			}
+			http.Error(w, errMsg, http.StatusServiceUnavailable)
 
-			results, err := multiStreamService.CreateMultiStream(
-				request.Destinations,
-				types.StreamOptions{
-					Title:       request.Title,
-					Description: request.Description,
-					Privacy:     "public", //FIXME - change to be set by user instead of defaulting to public
-				},
-				inputStreamURL,
-			)
+			return
 
-			if err != nil {
-				log.Printf("Warning: Some stream platforms failed: %v", err)
-			}
+		}
 
-			for _, result := range results {
+		if _, err := streamLifecycle.Create(record.ID, request.UserID, request.Title, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 
-				if result.Error == nil {
+		streamKey := request.StreamKey
 
-					log.Printf("Adding destination: %s", result.RTMPDestination.URL)
-					destinations = append(destinations, result.RTMPDestination)
+		//TODO - Form validation and sanitization (client and server)
+		// Convert destinations to lowercase for case-insensitive matching
+		for i, destination := range request.Destinations {
+			request.Destinations[i] = strings.ToLower(destination)
+		}
 
-				} else {
+		results, err := multiStreamService.ProvisionMultiStream(
+			request.Destinations,
+			types.StreamOptions{
+				Title:        request.Title,
+				Description:  request.Description,
+				Privacy:      "public", //FIXME - change to be set by user instead of defaulting to public
+				ScheduleTime: request.ScheduleTime,
+			},
+		)
 
-					log.Printf("Failed to create stream on %s: %v", result.Platform, result.Error)
+		if err != nil {
+			log.Printf("Warning: Some stream platforms failed: %v", err)
+		}
 
-				}
-			}
+		var destinations []mediaserver.StreamDestination
 
-		} else {
+		for _, result := range results {
 
-			errMsg := "Multi-streaming service temporarily unavailable"
+			if result.Error == nil {
 
-			log.Printf("ERROR: MultiStreamService unavailable: %v", err)
+				log.Printf("Adding destination: %s", result.RTMPDestination.URL)
+				destinations = append(destinations, result.RTMPDestination)
 
-			http.Error(w, errMsg, http.StatusServiceUnavailable)
+			} else {
 
-			return
+				log.Printf("Failed to create stream on %s: %v", result.Platform, result.Error)
 
+			}
 		}
 
-		if err := rtmpServer.AddStream(streamKey, destinations); err != nil {
+		if err := mediaServer.AddStream(record.ID, destinations); err != nil {
+			multiStreamService.DeleteMultiStream(results)
+			streamLifecycle.Discard(record.ID)
 			http.Error(w, "Failed to create stream", http.StatusInternalServerError)
 			return
 		}
 
+		// The relays start once the encoder publishes on the key.
+		stream, err := streamLifecycle.Arm(record.ID, record.ID, results)
+
+		if err != nil {
+			log.Printf("Failed to track stream %s: %v", record.ID, err)
+		}
+
+		ingest := mediaServer.IngestEndpoints(streamKey)
+
+		// Playback is addressed by key ID; the key is only ever given back
+		// to the caller who sent it.
+		playback := mediaServer.PlaybackURLs(record.ID)
+
 		response := struct {
-			StreamKey   string `json:"streamKey"`
-			IngestURL   string `json:"ingestUrl"`
-			HLSPlayURL  string `json:"hlsPlayUrl"`
-			Title       string `json:"title"`
-			Description string `json:"description"`
+			StreamID    string                 `json:"streamId"`
+			StreamKey   string                 `json:"streamKey,omitempty"`
+			IngestURL   string                 `json:"ingestUrl,omitempty"`
+			HLSPlayURL  string                 `json:"hlsPlayUrl,omitempty"`
+			Ingest      []types.IngestEndpoint `json:"ingest"`
+			Playback    []types.PlaybackURL    `json:"playback"`
+			Title       string                 `json:"title"`
+			Description string                 `json:"description"`
+			State       types.StreamState      `json:"state"`
 		}{
+			StreamID:    record.ID,
 			StreamKey:   streamKey,
-			IngestURL:   rtmpServer.GetIngestURL(streamKey),
-			HLSPlayURL:  rtmpServer.GetHLSURL(streamKey),
+			Ingest:      ingest,
+			Playback:    playback,
 			Title:       request.Title,
 			Description: request.Description,
+			State:       stream.State,
+		}
+
+		// The single URL fields predate the lists and carry their first
+		// entries.
+		if len(ingest) > 0 {
+			response.IngestURL = ingest[0].URL
+		}
+
+		for _, playbackURL := range playback {
+
+			if playbackURL.Protocol == mediaserver.ProtocolHLS {
+				response.HLSPlayURL = playbackURL.URL
+				break
+			}
+
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -167,31 +190,141 @@ func CreateStreamHandler(rtmpServer *rtmpserver.SimpleRealtimeServer) http.Handl
 	}
 }
 
-func ManageStreamHandler(rtmpServer *rtmpserver.SimpleRealtimeServer) http.HandlerFunc {
+func ManageStreamHandler(mediaServer mediaserver.MediaServer, streamLifecycle *lifecycle.Manager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract stream key from URL path
-		parts := strings.Split(r.URL.Path, "/")
-		if len(parts) < 3 {
+		// Extract the stream ID (the ID of its stream key) from URL path
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/")
+		streamID := parts[0]
+		if streamID == "" {
 			http.Error(w, "Invalid stream ID", http.StatusBadRequest)
 			return
 		}
-		streamKey := parts[len(parts)-1]
+
+		// Streams used to be addressed by their plaintext stream key
+		streamID = legacyStreamID(w, streamLifecycle, streamID)
+
+		if len(parts) > 1 {
+
+			if len(parts) > 2 || parts[1] != "stats" {
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+
+			streamStats(w, r, mediaServer, streamLifecycle, streamID)
+
+			return
+
+		}
+
+		stream, err := streamLifecycle.Get(streamID)
+
+		if err != nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
 
 		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, struct {
+				types.StreamLifecycle
+				Activity events.StreamActivity `json:"activity"`
+			}{
+				StreamLifecycle: stream,
+				Activity:        mediaServer.Activity().Stream(streamID),
+			})
+
 		case http.MethodDelete:
-			// Revoke the stream key
-			auth.RevokeStreamKey(streamKey)
+			// Revoke the stream key first so the encoder cannot reconnect
+			// while the stream is torn down
+			if record, exists := auth.FindStreamKeyForUser(stream.UserID, streamID); exists && record.ID == streamID {
+
+				if err := auth.RevokeStreamKeyRecord(record); err != nil {
+					log.Printf("Failed to revoke stream key: %v", err)
+					http.Error(w, "Failed to revoke stream key", http.StatusInternalServerError)
+					return
+				}
 
-			// Remove the stream from the RTMP server
-			if err := rtmpServer.RemoveStream(streamKey); err != nil {
+			}
+
+			// Stop the relays, complete the broadcasts and disconnect the encoder
+			stream, err = streamLifecycle.End(streamID, "deleted")
+
+			if err != nil {
 				http.Error(w, "Failed to delete stream", http.StatusInternalServerError)
 				return
 			}
 
-			w.WriteHeader(http.StatusOK)
+			// A stream that never got its relays armed is not registered
+			// with the RTMP server, so kick a lingering encoder directly
+			if _, err := mediaServer.KickPublisher(streamID); err != nil && !errors.Is(err, mediaserver.ErrStreamNotLive) && !errors.Is(err, mediaserver.ErrClientNotFound) {
+				log.Printf("Failed to disconnect publisher of stream %s: %v", streamID, err)
+			}
+
+			writeJSON(w, http.StatusOK, stream)
 
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}
 }
+
+// streamStats reports what the encoder is sending and how each of the
+// stream's relays is keeping up.
+func streamStats(w http.ResponseWriter, r *http.Request, mediaServer mediaserver.MediaServer, streamLifecycle *lifecycle.Manager, streamID string) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := mediaServer.IngestStats(r.Context(), streamID)
+
+	if errors.Is(err, mediaserver.ErrStreamNotLive) {
+		http.Error(w, "Stream is not live", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to get stats for stream %s: %v", streamID, err)
+		http.Error(w, "Failed to get stream stats", http.StatusBadGateway)
+		return
+	}
+
+	relays := []types.RelayStatus{}
+
+	if stream, err := streamLifecycle.Get(streamID); err == nil && stream.Relays != nil {
+		relays = stream.Relays
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		types.IngestStats
+		Relays []types.RelayStatus `json:"relays"`
+	}{
+		IngestStats: stats,
+		Relays:      relays,
+	})
+
+}
+
+// legacyStreamID maps a plaintext stream key in a stream path, as clients
+// from before stream IDs used, to the stream's ID. Anything else is
+// returned as it is.
+func legacyStreamID(w http.ResponseWriter, streamLifecycle *lifecycle.Manager, streamID string) string {
+
+	if _, err := streamLifecycle.Get(streamID); err == nil {
+		return streamID
+	}
+
+	record, err := auth.LookupStreamKey(streamID)
+
+	if err != nil {
+		return streamID
+	}
+
+	log.Printf("Deprecated request addresses stream %s by its stream key", record.ID)
+
+	w.Header().Set("Deprecation", "true")
+
+	return record.ID
+
+}
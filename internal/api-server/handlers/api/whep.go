@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+const (
+	defaultPreviewTTL = 5 * time.Minute
+	maxPreviewTTL     = time.Hour
+)
+
+// PreviewURLHandler hands out a WHEP endpoint and a short-lived token for
+// watching one of a user's stream keys with sub-second latency, for the
+// control room to monitor ingest without waiting on HLS. Like publish URLs,
+// preview tokens are only issued behind the admin token.
+func PreviewURLHandler(apiURL string) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			UserID  string `json:"userID"`
+			KeyID   string `json:"keyID"`
+			KeyName string `json:"keyName"`
+			TTL     string `json:"ttl"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		selector := request.KeyID
+
+		if selector == "" {
+			selector = request.KeyName
+		}
+
+		if request.UserID == "" || selector == "" {
+			http.Error(w, "Missing userID, and keyID or keyName", http.StatusBadRequest)
+			return
+		}
+
+		ttl := defaultPreviewTTL
+
+		if request.TTL != "" {
+
+			parsed, err := time.ParseDuration(request.TTL)
+
+			if err != nil || parsed <= 0 || parsed > maxPreviewTTL {
+				http.Error(w, "Invalid ttl, expected a positive duration of at most 1h", http.StatusBadRequest)
+				return
+			}
+
+			ttl = parsed
+
+		}
+
+		record, exists := auth.FindStreamKeyForUser(request.UserID, selector)
+
+		if !exists {
+			http.Error(w, "Stream key not found for user", http.StatusNotFound)
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl)
+
+		if !record.ExpiresAt.IsZero() && record.ExpiresAt.Before(expiresAt) {
+			expiresAt = record.ExpiresAt
+		}
+
+		token := auth.PreviewToken{
+			UserID:    record.UserID,
+			KeyID:     record.ID,
+			ExpiresAt: expiresAt,
+		}
+
+		writeJSON(w, http.StatusCreated, types.PreviewURLResponse{
+			URL:       strings.TrimSuffix(apiURL, "/") + "/api/whep/" + record.ID,
+			Token:     token.String(),
+			KeyID:     record.ID,
+			ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+		})
+
+	}
+
+}
+
+type previewSession struct {
+	keyID  string
+	stream string
+	timer  *time.Timer
+}
+
+// WHEPHandler plays what is published on a stream key out over WebRTC
+// (WHEP). A POST to /api/whep/{keyID} carries the SDP offer, with a preview
+// token as the bearer token; a DELETE on the Location it answers with ends
+// the session. Sessions are closed when their token expires.
+func WHEPHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	sessions := make(map[string]previewSession)
+
+	var sessionsLock sync.Mutex
+
+	closeSession := func(ctx context.Context, id string) error {
+
+		sessionsLock.Lock()
+
+		session, exists := sessions[id]
+
+		delete(sessions, id)
+
+		sessionsLock.Unlock()
+
+		if !exists {
+			return mediaserver.ErrWebRTCSessionNotFound
+		}
+
+		session.timer.Stop()
+
+		return mediaServer.(mediaserver.WebRTCServer).CloseWebRTC(ctx, id, session.stream)
+
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		webrtc, supported := mediaServer.(mediaserver.WebRTCServer)
+
+		if !supported {
+			http.Error(w, "WebRTC playback is not supported by this media server", http.StatusNotImplemented)
+			return
+		}
+
+		keyID, sessionID, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/whep"), "/"), "/")
+
+		if keyID == "" {
+			http.Error(w, "Missing stream key ID", http.StatusBadRequest)
+			return
+		}
+
+		token, ok := bearerToken(r)
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Missing preview token", http.StatusUnauthorized)
+			return
+		}
+
+		preview, err := auth.VerifyPreviewToken(keyID, token)
+
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Invalid preview token", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+
+		case r.Method == http.MethodPost && sessionID == "":
+
+			offer, ok := readSDPOffer(w, r)
+
+			if !ok {
+				return
+			}
+
+			publisher, live := mediaServer.Publishers().Active(keyID)
+
+			if !live {
+				http.Error(w, "Stream is not live", http.StatusNotFound)
+				return
+			}
+
+			session, err := webrtc.PlayWebRTC(r.Context(), publisher.Stream, offer)
+
+			if err != nil {
+				log.Printf("WHEP preview of key %s failed: %v", keyID, err)
+				http.Error(w, "Media server rejected the offer", http.StatusBadGateway)
+				return
+			}
+
+			sessionsLock.Lock()
+
+			sessions[session.ID] = previewSession{
+				keyID:  keyID,
+				stream: session.Stream,
+				timer: time.AfterFunc(time.Until(preview.ExpiresAt), func() {
+
+					err := closeSession(context.Background(), session.ID)
+
+					if err != nil && !errors.Is(err, mediaserver.ErrWebRTCSessionNotFound) {
+						log.Printf("Failed to close expired WHEP session %s: %v", session.ID, err)
+					}
+
+				}),
+			}
+
+			sessionsLock.Unlock()
+
+			writeSDPAnswer(w, "/api/whep/"+keyID+"/"+session.ID, session.Answer)
+
+		case r.Method == http.MethodDelete && sessionID != "":
+
+			sessionsLock.Lock()
+
+			session, exists := sessions[sessionID]
+
+			sessionsLock.Unlock()
+
+			if !exists || session.keyID != keyID {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+
+			err := closeSession(r.Context(), sessionID)
+
+			if errors.Is(err, mediaserver.ErrWebRTCSessionNotFound) {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+
+			if err != nil {
+				log.Printf("Failed to close WHEP session %s: %v", sessionID, err)
+				http.Error(w, "Failed to close session", http.StatusBadGateway)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+		}
+
+	}
+
+}
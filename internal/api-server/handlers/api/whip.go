@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+)
+
+// maxSDPOfferSize bounds the SDP offers accepted from clients.
+const maxSDPOfferSize = 64 << 10
+
+// WHIPHandler lets browsers and other WebRTC encoders publish (WHIP). A
+// POST to /api/whip carries the SDP offer, with the stream key as the
+// bearer token, and is answered with the media server's SDP answer and the
+// session's Location; a DELETE on that Location stops publishing. The
+// publish is authorized by the media server's publish hook, like RTMP.
+func WHIPHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		webrtc, supported := mediaServer.(mediaserver.WebRTCServer)
+
+		if !supported {
+			http.Error(w, "WebRTC ingest is not supported by this media server", http.StatusNotImplemented)
+			return
+		}
+
+		streamKey, ok := bearerToken(r)
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Missing stream key", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/whip"), "/")
+
+		switch {
+
+		case r.Method == http.MethodPost && sessionID == "":
+			publishWHIP(w, r, mediaServer, webrtc, streamKey)
+
+		case r.Method == http.MethodDelete && sessionID != "":
+			err := webrtc.CloseWebRTC(r.Context(), sessionID, streamKey)
+
+			if errors.Is(err, mediaserver.ErrWebRTCSessionNotFound) {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+
+			if err != nil {
+				log.Printf("Failed to close WHIP session %s: %v", sessionID, err)
+				http.Error(w, "Failed to close session", http.StatusBadGateway)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+
+		}
+
+	}
+
+}
+
+func publishWHIP(w http.ResponseWriter, r *http.Request, mediaServer mediaserver.MediaServer, webrtc mediaserver.WebRTCServer, streamKey string) {
+
+	offer, ok := readSDPOffer(w, r)
+
+	if !ok {
+		return
+	}
+
+	// Turn bad keys and busy streams away before SRS sets up a session;
+	// the publish hook makes the final decision.
+	record, err := auth.LookupStreamKey(streamKey)
+
+	if err != nil {
+		http.Error(w, "Invalid stream key", http.StatusUnauthorized)
+		return
+	}
+
+	publishers := mediaServer.Publishers()
+
+	if _, publishing := publishers.Active(record.ID); publishing && publishers.Policy() == mediaserver.PublisherPolicyReject {
+
+		if _, released := mediaserver.ReleaseStalePublisher(r.Context(), mediaServer, record.ID); !released {
+			http.Error(w, "Stream key is already in use", http.StatusConflict)
+			return
+		}
+
+	}
+
+	session, err := webrtc.PublishWebRTC(r.Context(), streamKey, offer)
+
+	if err != nil {
+		log.Printf("WHIP publish on key %s failed: %v", record.ID, err)
+		http.Error(w, "Media server rejected the offer", http.StatusBadGateway)
+		return
+	}
+
+	writeSDPAnswer(w, "/api/whip/"+session.ID, session.Answer)
+
+}
+
+// readSDPOffer reads the SDP offer a WHIP or WHEP client posts.
+func readSDPOffer(w http.ResponseWriter, r *http.Request) (string, bool) {
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/sdp" {
+		http.Error(w, "Content-Type must be application/sdp", http.StatusUnsupportedMediaType)
+		return "", false
+	}
+
+	offer, err := io.ReadAll(io.LimitReader(r.Body, maxSDPOfferSize+1))
+
+	if err != nil || len(offer) == 0 || len(offer) > maxSDPOfferSize {
+		http.Error(w, "Invalid SDP offer", http.StatusBadRequest)
+		return "", false
+	}
+
+	return string(offer), true
+
+}
+
+func writeSDPAnswer(w http.ResponseWriter, location, answer string) {
+
+	w.Header().Set("Content-Type", "application/sdp")
+
+	w.Header().Set("Location", location)
+
+	// Browsers only let the page read Location when it is exposed.
+	w.Header().Set("Access-Control-Expose-Headers", "Location")
+
+	w.WriteHeader(http.StatusCreated)
+
+	w.Write([]byte(answer))
+
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	token = strings.TrimSpace(token)
+
+	return token, found && token != ""
+
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
 )
 
 type HealthCheckResponse struct {
@@ -20,3 +22,27 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 
 }
+
+// MediaServerHealthHandler reports whether the media server is reachable,
+// answering 503 when it is not.
+func MediaServerHealthHandler(mediaServer mediaserver.MediaServer) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		health := mediaServer.Health(r.Context())
+
+		status := http.StatusOK
+
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		w.WriteHeader(status)
+
+		json.NewEncoder(w).Encode(health)
+
+	}
+
+}
@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // HandleAuth logs authentication requests
@@ -13,10 +15,16 @@ func HandleAuth(next http.Handler) http.Handler {
 	})
 }
 
-// Authentication middleware verifies the user's identity
+// Authentication middleware verifies the caller presents secretKey as a
+// bearer token. An empty secretKey disables the routes it protects.
 func Authentication(secretKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if secretKey == "" {
+				http.Error(w, "Endpoint disabled, no API token configured", http.StatusServiceUnavailable)
+				return
+			}
+
 			// Get token from Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
@@ -24,8 +32,12 @@ func Authentication(secretKey string) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Validate token logic here
-			// ...
+			token, found := strings.CutPrefix(authHeader, "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(secretKey)) != 1 {
+				log.Printf("Rejected request to %s from %s: invalid token", r.URL.Path, r.RemoteAddr)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
 
 			// If valid, continue
 			next.ServeHTTP(w, r)
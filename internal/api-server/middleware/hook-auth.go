@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+)
+
+// HookSecretHeader can carry the hook secret instead of the query string,
+// e.g. when hooks pass through a proxy that adds it.
+const HookSecretHeader = "X-Hook-Secret"
+
+// HookTimestampHeader and HookSignatureHeader sign a hook in place of the
+// secret: the signature is the hex HMAC-SHA256, keyed with the hook secret,
+// of the Unix timestamp, the path and the body, each followed by a newline
+// but the body.
+const (
+	HookTimestampHeader = "X-Hook-Timestamp"
+	HookSignatureHeader = "X-Hook-Signature"
+)
+
+// maxSeenHooks bounds the duplicate cache, and maxHookResponseSize how much
+// of each hook's response it keeps.
+const (
+	maxSeenHooks        = 100000
+	maxHookResponseSize = 4 << 10
+)
+
+// hookResponse is the answer to a hook, kept to answer duplicates of it the
+// same way. done is closed once the answer is complete.
+type hookResponse struct {
+	done        chan struct{}
+	status      int
+	contentType string
+	body        []byte
+}
+
+type seenHook struct {
+	at       time.Time
+	response *hookResponse
+}
+
+// recordingWriter passes a hook's response through and keeps a copy.
+type recordingWriter struct {
+	http.ResponseWriter
+	response *hookResponse
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+
+	if rw.response.status == 0 {
+		rw.response.status = status
+		rw.response.contentType = rw.Header().Get("Content-Type")
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+
+	if rw.response.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if room := maxHookResponseSize - len(rw.response.body); room > 0 {
+		rw.response.body = append(rw.response.body, p[:min(len(p), room)]...)
+	}
+
+	return rw.ResponseWriter.Write(p)
+
+}
+
+// HookAuthentication protects the SRS hook endpoints. A request must come
+// from an allowed address if an allowlist is set and be signed, or, unless
+// signatures are required, carry the shared secret in the "secret" query
+// parameter or the X-Hook-Secret header. Signed hooks are rejected once
+// their timestamp is older than the replay window, which together with the
+// duplicate check makes them replay-proof. Hooks authenticated by the secret
+// alone are only checked for duplicates: SRS sends no timestamp, so such a
+// hook captured in transit can be sent again once the window has passed.
+// A duplicate is given the first call's answer, so SRS retrying a hook is
+// told the same as the first time rather than refused.
+func HookAuthentication(cfg config.HookConfig) func(http.Handler) http.Handler {
+
+	var allowed []*net.IPNet
+
+	for _, entry := range cfg.AllowedIPs {
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid hook allowlist entry %q: %v", entry, err)
+			continue
+		}
+
+		allowed = append(allowed, network)
+
+	}
+
+	var (
+		seen     = make(map[[sha256.Size]byte]seenHook)
+		seenLock sync.Mutex
+	)
+
+	// duplicate records the hook and reports whether it was already seen,
+	// with the response to the first call, or the one to record otherwise.
+	duplicate := func(digest [sha256.Size]byte, now time.Time) (*hookResponse, bool) {
+
+		seenLock.Lock()
+
+		defer seenLock.Unlock()
+
+		if hook, exists := seen[digest]; exists && now.Sub(hook.at) < cfg.ReplayWindow {
+			return hook.response, true
+		}
+
+		if len(seen) >= maxSeenHooks {
+
+			for key, hook := range seen {
+				if now.Sub(hook.at) >= cfg.ReplayWindow {
+					delete(seen, key)
+				}
+			}
+
+		}
+
+		response := &hookResponse{done: make(chan struct{})}
+
+		seen[digest] = seenHook{at: now, response: response}
+
+		return response, false
+
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if len(allowed) > 0 && !hookSourceAllowed(r.RemoteAddr, allowed) {
+				log.Printf("Rejected hook %s from %s: address not allowed", r.URL.Path, r.RemoteAddr)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+
+			if r.Header.Get(HookSignatureHeader) != "" {
+
+				if reason := verifyHookSignature(r, body, cfg, now); reason != "" {
+					log.Printf("Rejected hook %s from %s: %s", r.URL.Path, r.RemoteAddr, reason)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+			} else {
+
+				secret := r.URL.Query().Get("secret")
+
+				if secret == "" {
+					secret = r.Header.Get(HookSecretHeader)
+				}
+
+				if cfg.RequireSignature || subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.Secret)) != 1 {
+					log.Printf("Rejected hook %s from %s: invalid secret", r.URL.Path, r.RemoteAddr)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+
+			}
+
+			if cfg.ReplayWindow <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Every genuine call differs in its client ID, action or segment,
+			// so an identical body on the same hook is a duplicate.
+			response, repeated := duplicate(sha256.Sum256(append([]byte(r.URL.Path+"\n"), body...)), now)
+
+			if repeated {
+
+				select {
+
+				case <-response.done:
+
+				case <-r.Context().Done():
+					return
+
+				}
+
+				log.Printf("Answered duplicate hook %s from %s as the first call", r.URL.Path, r.RemoteAddr)
+
+				if response.contentType != "" {
+					w.Header().Set("Content-Type", response.contentType)
+				}
+
+				w.WriteHeader(response.status)
+
+				w.Write(response.body)
+
+				return
+
+			}
+
+			defer func() {
+
+				if response.status == 0 {
+					response.status = http.StatusOK
+				}
+
+				close(response.done)
+
+			}()
+
+			next.ServeHTTP(&recordingWriter{ResponseWriter: w, response: response}, r)
+
+		})
+	}
+
+}
+
+// verifyHookSignature checks a signed hook and returns why it is rejected,
+// or "" if it is valid.
+func verifyHookSignature(r *http.Request, body []byte, cfg config.HookConfig, now time.Time) string {
+
+	timestamp := r.Header.Get(HookTimestampHeader)
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return "invalid timestamp"
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(HookSignatureHeader))
+
+	if err != nil || !hmac.Equal(signature, SignHook(cfg.Secret, timestamp, r.URL.Path, body)) {
+		return "invalid signature"
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+
+	if age < 0 {
+		age = -age
+	}
+
+	if cfg.ReplayWindow > 0 && age > cfg.ReplayWindow {
+		return "stale timestamp"
+	}
+
+	return ""
+
+}
+
+// SignHook returns the signature of a hook sent to path at the given Unix
+// timestamp.
+func SignHook(secret, timestamp, path string, body []byte) []byte {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+
+	mac.Write([]byte(timestamp + "\n" + path + "\n"))
+
+	mac.Write(body)
+
+	return mac.Sum(nil)
+
+}
+
+func hookSourceAllowed(remoteAddr string, allowed []*net.IPNet) bool {
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+
+}
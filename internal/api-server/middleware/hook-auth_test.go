@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+)
+
+func TestHookAuthentication(t *testing.T) {
+
+	const (
+		secret = "hook-secret"
+		path   = "/api/rtmp/published"
+	)
+
+	signed := func(at time.Time, body string) http.Header {
+
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+
+		header := http.Header{}
+
+		header.Set(HookTimestampHeader, timestamp)
+
+		header.Set(HookSignatureHeader, hex.EncodeToString(SignHook(secret, timestamp, path, []byte(body))))
+
+		return header
+
+	}
+
+	secretHeader := http.Header{HookSecretHeader: {secret}}
+
+	tests := []struct {
+		name   string
+		cfg    config.HookConfig
+		query  string
+		header http.Header
+		body   string
+		remote string
+		want   int
+	}{
+		{
+			name:  "secret in query",
+			query: "?secret=" + secret,
+			want:  http.StatusOK,
+		},
+		{
+			name:   "secret in header",
+			header: secretHeader,
+			want:   http.StatusOK,
+		},
+		{
+			name:  "wrong secret",
+			query: "?secret=guess",
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name: "no credentials",
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:   "signed",
+			header: signed(time.Now(), `{"action":"on_publish"}`),
+			body:   `{"action":"on_publish"}`,
+			want:   http.StatusOK,
+		},
+		{
+			name:   "signed over another body",
+			header: signed(time.Now(), `{"action":"on_publish"}`),
+			body:   `{"action":"on_unpublish"}`,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "stale signature",
+			header: signed(time.Now().Add(-time.Hour), `{}`),
+			body:   `{}`,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "secret when signatures are required",
+			cfg:    config.HookConfig{RequireSignature: true},
+			header: secretHeader,
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "signed when signatures are required",
+			cfg:    config.HookConfig{RequireSignature: true},
+			header: signed(time.Now(), `{}`),
+			body:   `{}`,
+			want:   http.StatusOK,
+		},
+		{
+			name:   "allowed address",
+			cfg:    config.HookConfig{AllowedIPs: []string{"10.0.0.0/8"}},
+			header: secretHeader,
+			remote: "10.1.2.3:5000",
+			want:   http.StatusOK,
+		},
+		{
+			name:   "address not allowed",
+			cfg:    config.HookConfig{AllowedIPs: []string{"10.0.0.1"}},
+			header: secretHeader,
+			remote: "192.168.1.1:5000",
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			cfg := test.cfg
+
+			cfg.Secret = secret
+
+			cfg.ReplayWindow = time.Minute
+
+			handler := HookAuthentication(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodPost, path+test.query, strings.NewReader(test.body))
+
+			for key, values := range test.header {
+				r.Header[key] = values
+			}
+
+			if test.remote != "" {
+				r.RemoteAddr = test.remote
+			}
+
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("got status %d, want %d", w.Code, test.want)
+			}
+
+		})
+
+	}
+
+}
+
+func TestHookAuthenticationRepeatsFirstResponse(t *testing.T) {
+
+	calls := 0
+
+	// The first call on a client is accepted and any later one refused, as
+	// a handler that is not idempotent would.
+	handler := HookAuthentication(config.HookConfig{Secret: "s", ReplayWindow: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		calls++
+
+		if calls > 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		w.Write([]byte(`{"code":0}`))
+
+	}))
+
+	send := func(body string) *httptest.ResponseRecorder {
+
+		r := httptest.NewRequest(http.MethodPost, "/api/rtmp/published?secret=s", strings.NewReader(body))
+
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, r)
+
+		return w
+
+	}
+
+	first := send(`{"client_id":"1"}`)
+
+	retry := send(`{"client_id":"1"}`)
+
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("the retry got %d %q, want the first response %d %q", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+
+	if calls != 1 {
+		t.Fatalf("the handler was called %d times, want once", calls)
+	}
+
+	if other := send(`{"client_id":"2"}`); other.Code != http.StatusForbidden || calls != 2 {
+		t.Fatalf("a different hook got %d after %d calls, want it passed on", other.Code, calls)
+	}
+
+}
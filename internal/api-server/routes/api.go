@@ -5,14 +5,66 @@ import (
 
 	apiHandlers "github.com/OODemi52/chronocast-server/internal/api-server/handlers/api"
 	"github.com/OODemi52/chronocast-server/internal/api-server/middleware"
-	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
 )
 
-func SetupAPIRoutes(mux *http.ServeMux, rtmpServer *rtmpserver.SimpleRealtimeServer) {
+func SetupAPIRoutes(mux *http.ServeMux, mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService, streamLifecycle *lifecycle.Manager, ingestService *ingest.Service, streamScheduler *scheduler.Scheduler) {
 
-	mux.HandleFunc("/api/rtmp/published", apiHandlers.RTMPPublishedHandler)
+	hookAuthentication := middleware.HookAuthentication(mediaServer.HookConfig())
 
-	mux.HandleFunc("/api/rtmp/unpublished", apiHandlers.RTMPUnPublishedHandler)
+	adminAuthentication := middleware.Authentication(config.GetAdminConfig().Token)
+
+	mux.Handle("/api/rtmp/published", middleware.ChainMiddleware(
+		apiHandlers.RTMPPublishedHandler(ingestService),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/unpublished", middleware.ChainMiddleware(
+		apiHandlers.RTMPUnPublishedHandler(ingestService),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/connect", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.Connect),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/close", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.Close),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/play", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.Play),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/stop", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.Stop),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/dvr", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.DVR),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/rtmp/hls", middleware.ChainMiddleware(
+		apiHandlers.RTMPEventHandler(mediaServer, events.HLS),
+		hookAuthentication,
+	))
+
+	mux.Handle("/api/publishers", middleware.ChainMiddleware(
+		apiHandlers.PublishersHandler(mediaServer),
+		middleware.CORS,
+		middleware.Logging,
+	))
 
 	mux.Handle("/api/generate-stream-key", middleware.ChainMiddleware(
 		http.HandlerFunc(apiHandlers.GenerateStreamKeyHandler),
@@ -20,15 +72,110 @@ func SetupAPIRoutes(mux *http.ServeMux, rtmpServer *rtmpserver.SimpleRealtimeSer
 		middleware.Logging,
 	))
 
+	mux.Handle("/api/keys", middleware.ChainMiddleware(
+		http.HandlerFunc(apiHandlers.StreamKeysHandler),
+		adminAuthentication,
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/keys/", middleware.ChainMiddleware(
+		http.HandlerFunc(apiHandlers.ManageStreamKeyHandler),
+		adminAuthentication,
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/keys/rotate", middleware.ChainMiddleware(
+		http.HandlerFunc(apiHandlers.RotateStreamKeyHandler),
+		adminAuthentication,
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/publish-urls", middleware.ChainMiddleware(
+		apiHandlers.PublishURLHandler(mediaServer),
+		adminAuthentication,
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/whip", middleware.ChainMiddleware(
+		apiHandlers.WHIPHandler(mediaServer),
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/whip/", middleware.ChainMiddleware(
+		apiHandlers.WHIPHandler(mediaServer),
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/whep/", middleware.ChainMiddleware(
+		apiHandlers.WHEPHandler(mediaServer),
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/preview-urls", middleware.ChainMiddleware(
+		apiHandlers.PreviewURLHandler(config.GetPublicConfig().APIURL),
+		adminAuthentication,
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/hls/", middleware.ChainMiddleware(
+		apiHandlers.HLSHandler(mediaServer),
+		middleware.CORS,
+	))
+
 	mux.Handle("/api/streams", middleware.ChainMiddleware(
-		apiHandlers.CreateStreamHandler(rtmpServer),
+		apiHandlers.CreateStreamHandler(mediaServer, multiStreamService, streamLifecycle),
 		middleware.CORS,
 		middleware.Logging,
 	))
 
 	mux.Handle("/api/streams/", middleware.ChainMiddleware(
-		apiHandlers.ManageStreamHandler(rtmpServer),
+		apiHandlers.ManageStreamHandler(mediaServer, streamLifecycle),
+		adminAuthentication,
 		middleware.CORS,
 		middleware.Logging,
 	))
+
+	mux.Handle("/api/schedules", middleware.ChainMiddleware(
+		apiHandlers.ScheduleStreamHandler(streamScheduler),
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/schedules/", middleware.ChainMiddleware(
+		apiHandlers.ManageScheduleHandler(streamScheduler),
+		middleware.CORS,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/admin/clients", middleware.ChainMiddleware(
+		apiHandlers.AdminClientsHandler(mediaServer),
+		adminAuthentication,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/admin/clients/", middleware.ChainMiddleware(
+		apiHandlers.AdminClientsHandler(mediaServer),
+		adminAuthentication,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/admin/relays", middleware.ChainMiddleware(
+		apiHandlers.AdminRelaysHandler(multiStreamService),
+		adminAuthentication,
+		middleware.Logging,
+	))
+
+	mux.Handle("/api/admin/streams/", middleware.ChainMiddleware(
+		apiHandlers.AdminStreamHandler(mediaServer, streamLifecycle),
+		adminAuthentication,
+		middleware.Logging,
+	))
 }
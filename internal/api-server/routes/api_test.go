@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi/srsapitest"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
+)
+
+const testAdminToken = "admin-token"
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+
+	mux := newTestMux(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "list keys", method: http.MethodGet, path: "/api/keys?userID=user"},
+		{name: "manage key", method: http.MethodDelete, path: "/api/keys/key-id?userID=user"},
+		{name: "rotate key", method: http.MethodPost, path: "/api/keys/rotate", body: `{"userID":"user","keyID":"key-id"}`},
+		{name: "stream", method: http.MethodGet, path: "/api/streams/key-id"},
+		{name: "delete stream", method: http.MethodDelete, path: "/api/streams/key-id"},
+		{name: "publish urls", method: http.MethodPost, path: "/api/publish-urls", body: `{}`},
+		{name: "preview urls", method: http.MethodPost, path: "/api/preview-urls", body: `{}`},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			for _, token := range []string{"", "wrong-token"} {
+
+				r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+
+				if token != "" {
+					r.Header.Set("Authorization", "Bearer "+token)
+				}
+
+				w := httptest.NewRecorder()
+
+				mux.ServeHTTP(w, r)
+
+				if w.Code != http.StatusUnauthorized {
+					t.Fatalf("token %q: got status %d, want %d", token, w.Code, http.StatusUnauthorized)
+				}
+
+			}
+
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+
+			r.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			if w.Code == http.StatusUnauthorized {
+				t.Fatalf("the admin token was refused")
+			}
+
+		})
+
+	}
+
+}
+
+// newTestMux sets the API routes up on an SRS media server whose API is a
+// fake.
+func newTestMux(t *testing.T) *http.ServeMux {
+
+	fake := srsapitest.NewServer()
+
+	t.Cleanup(fake.Close)
+
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "srs.conf"))
+
+	t.Setenv("SRS_PATH", "/usr/local/srs/objs/srs")
+
+	t.Setenv("SRS_MODE", "external")
+
+	t.Setenv("SRS_API_URL", fake.URL)
+
+	t.Setenv("HOOK_SECRET", "secret")
+
+	t.Setenv("ADMIN_API_TOKEN", testAdminToken)
+
+	srs, err := rtmpserver.NewServer(":1935")
+
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	streamLifecycle := lifecycle.NewManager(srs, nil)
+
+	mux := http.NewServeMux()
+
+	SetupAPIRoutes(mux, srs, nil, streamLifecycle, ingest.NewService(srs, streamLifecycle), scheduler.NewScheduler(srs, nil, streamLifecycle))
+
+	return mux
+
+}
@@ -5,9 +5,10 @@ import (
 
 	healthHandlers "github.com/OODemi52/chronocast-server/internal/api-server/handlers/health"
 	"github.com/OODemi52/chronocast-server/internal/api-server/middleware"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
 )
 
-func SetupHealthRoutes(mux *http.ServeMux) {
+func SetupHealthRoutes(mux *http.ServeMux, mediaServer mediaserver.MediaServer) {
 
 	mux.Handle("/health", middleware.ChainMiddleware(
 		http.HandlerFunc(healthHandlers.HealthCheckHandler),
@@ -16,5 +17,11 @@ func SetupHealthRoutes(mux *http.ServeMux) {
 		middleware.HandleAuth,
 	))
 
+	mux.Handle("/health/media-server", middleware.ChainMiddleware(
+		healthHandlers.MediaServerHealthHandler(mediaServer),
+		middleware.Logging,
+		middleware.CORS,
+	))
+
 	//TODO - Improve health checking
 }
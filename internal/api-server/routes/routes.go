@@ -3,18 +3,22 @@ package routes
 import (
 	"net/http"
 
-	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
 )
 
-func SetupRoutes(rtmpServer *rtmpserver.SimpleRealtimeServer) *http.ServeMux {
+func SetupRoutes(mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService, streamLifecycle *lifecycle.Manager, ingestService *ingest.Service, streamScheduler *scheduler.Scheduler) *http.ServeMux {
 
 	muxRouter := http.NewServeMux()
 
-	SetupHealthRoutes(muxRouter)
+	SetupHealthRoutes(muxRouter, mediaServer)
 
 	SetupAuthRoutes(muxRouter)
 
-	SetupAPIRoutes(muxRouter, rtmpServer)
+	SetupAPIRoutes(muxRouter, mediaServer, multiStreamService, streamLifecycle, ingestService, streamScheduler)
 
 	return muxRouter
 
@@ -6,7 +6,11 @@ import (
 	"net/http"
 
 	"github.com/OODemi52/chronocast-server/internal/api-server/routes"
-	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/services/ingest"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/services/scheduler"
 )
 
 type APIServer struct {
@@ -14,13 +18,13 @@ type APIServer struct {
 	port       string
 }
 
-func NewServer(port string, rtmpServer *rtmpserver.SimpleRealtimeServer) (*APIServer, error) {
+func NewServer(port string, mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService, streamLifecycle *lifecycle.Manager, ingestService *ingest.Service, streamScheduler *scheduler.Scheduler) (*APIServer, error) {
 
 	return &APIServer{
 		port: port,
 		httpServer: &http.Server{
 			Addr:    port,
-			Handler: routes.SetupRoutes(rtmpServer),
+			Handler: routes.SetupRoutes(mediaServer, multiStreamService, streamLifecycle, ingestService, streamScheduler),
 		},
 	}, nil
 
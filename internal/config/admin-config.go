@@ -0,0 +1,18 @@
+package config
+
+import "os"
+
+type AdminConfig struct {
+	Token string
+}
+
+// GetAdminConfig reads the bearer token admin endpoints, stream key and
+// stream management and the issuing of publish and preview URLs require
+// (ADMIN_API_TOKEN). Without one they are disabled.
+func GetAdminConfig() AdminConfig {
+
+	return AdminConfig{
+		Token: os.Getenv("ADMIN_API_TOKEN"),
+	}
+
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getEnv(key, fallback string) string {
+
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Printf("Warning: Invalid duration %q for %s, using default %s", value, key, fallback)
+		return fallback
+	}
+
+	return duration
+
+}
+
+// getPositiveDurationEnv is getDurationEnv for durations that must be
+// above zero, such as ticker intervals.
+func getPositiveDurationEnv(key string, fallback time.Duration) time.Duration {
+
+	duration := getDurationEnv(key, fallback)
+
+	if duration <= 0 {
+		log.Printf("Warning: %s must be positive, got %s, using default %s", key, duration, fallback)
+		return fallback
+	}
+
+	return duration
+
+}
+
+func getListEnv(key string) []string {
+
+	var values []string
+
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+
+	}
+
+	return values
+
+}
+
+func getIntEnv(key string, fallback int) int {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Printf("Warning: Invalid number %q for %s, using default %d", value, key, fallback)
+		return fallback
+	}
+
+	return number
+
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	enabled, err := strconv.ParseBool(value)
+
+	if err != nil {
+		log.Printf("Warning: Invalid boolean %q for %s, using default %t", value, key, fallback)
+		return fallback
+	}
+
+	return enabled
+
+}
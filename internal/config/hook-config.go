@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+type HookConfig struct {
+	Secret           string
+	AllowedIPs       []string
+	ReplayWindow     time.Duration
+	RequireSignature bool
+	BaseURL          string
+}
+
+// GetHookConfig reads how SRS's HTTP hooks are authenticated. HOOK_SECRET
+// is the shared secret hooks carry; HOOK_ALLOWED_IPS is an optional comma
+// separated list of addresses or CIDRs hooks may come from. Signed hooks
+// older than HOOK_REPLAY_WINDOW are rejected, as are identical hook calls
+// repeated within it. HOOK_REQUIRE_SIGNATURE rejects hooks that are not
+// signed, for when a proxy in front of the server signs SRS's hooks; SRS
+// itself can only send the secret in the URL. srs.conf points the hooks at
+// HOOK_BASE_URL.
+func GetHookConfig() HookConfig {
+
+	return HookConfig{
+		Secret:           os.Getenv("HOOK_SECRET"),
+		AllowedIPs:       getListEnv("HOOK_ALLOWED_IPS"),
+		ReplayWindow:     getDurationEnv("HOOK_REPLAY_WINDOW", 5*time.Minute),
+		RequireSignature: getBoolEnv("HOOK_REQUIRE_SIGNATURE", false),
+		BaseURL:          getEnv("HOOK_BASE_URL", "http://host.docker.internal:8081"),
+	}
+
+}
@@ -0,0 +1,24 @@
+package config
+
+import "os"
+
+type KeyStoreConfig struct {
+	Backend string
+	Path    string
+	Secret  string
+}
+
+// GetKeyStoreConfig selects the stream key backend. STREAM_KEY_STORE is
+// "memory" (the default, keys are lost on restart) or "bolt", which keeps
+// keys, and the schedules with them, in the BoltDB file at
+// STREAM_KEY_STORE_PATH. Keys are stored as
+// HMACs under STREAM_KEY_SECRET, which must stay stable across restarts.
+func GetKeyStoreConfig() KeyStoreConfig {
+
+	return KeyStoreConfig{
+		Backend: getEnv("STREAM_KEY_STORE", "memory"),
+		Path:    getEnv("STREAM_KEY_STORE_PATH", "data/stream-keys.db"),
+		Secret:  os.Getenv("STREAM_KEY_SECRET"),
+	}
+
+}
@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+type LifecycleConfig struct {
+	ReconnectGrace time.Duration
+}
+
+// GetLifecycleConfig reads how long a stream waits for its encoder to
+// reconnect after it stops publishing (STREAM_RECONNECT_GRACE) before the
+// relays are stopped and the platform broadcasts are completed.
+func GetLifecycleConfig() LifecycleConfig {
+
+	return LifecycleConfig{
+		ReconnectGrace: getDurationEnv("STREAM_RECONNECT_GRACE", 2*time.Minute),
+	}
+
+}
@@ -0,0 +1,17 @@
+package config
+
+type MediaServerConfig struct {
+	Backend string
+}
+
+// GetMediaServerConfig reads which media server encoders publish to.
+// MEDIA_SERVER is "srs" (the default), which drives SRS according to the
+// SRS_* settings, or "embedded", which accepts RTMP on the rtmp-port flag
+// itself and needs neither SRS nor Docker.
+func GetMediaServerConfig() MediaServerConfig {
+
+	return MediaServerConfig{
+		Backend: getEnv("MEDIA_SERVER", "srs"),
+	}
+
+}
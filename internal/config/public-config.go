@@ -0,0 +1,51 @@
+package config
+
+import "net"
+
+type PublicConfig struct {
+	Host              string
+	IngestProtocols   []string
+	PlaybackProtocols []string
+	RTMPPort          int
+	RTMPSPort         int
+	SRTPort           int
+	APIURL            string
+}
+
+// GetPublicConfig reads how encoders and viewers reach the media server
+// from outside: the public hostname (PUBLIC_HOST), which ingest protocols
+// are offered (INGEST_PROTOCOLS: rtmp, rtmps, srt and whip, default rtmp)
+// and which playback protocols (PLAYBACK_PROTOCOLS: hls, the default).
+//
+// PUBLIC_RTMP_PORT and PUBLIC_SRT_PORT default to the ports the media
+// server listens on. RTMPS is expected to be terminated by a TLS proxy on
+// PUBLIC_RTMPS_PORT. PUBLIC_API_URL is the API server's base URL, which
+// WebRTC encoders publish to (WHIP) and HLS is played from; by default it
+// is built from the host and the default port.
+func GetPublicConfig() PublicConfig {
+
+	cfg := PublicConfig{
+		Host:              getEnv("PUBLIC_HOST", "localhost"),
+		IngestProtocols:   getListEnv("INGEST_PROTOCOLS"),
+		PlaybackProtocols: getListEnv("PLAYBACK_PROTOCOLS"),
+		RTMPPort:          getIntEnv("PUBLIC_RTMP_PORT", 0),
+		RTMPSPort:         getIntEnv("PUBLIC_RTMPS_PORT", 443),
+		SRTPort:           getIntEnv("PUBLIC_SRT_PORT", 0),
+		APIURL:            getEnv("PUBLIC_API_URL", ""),
+	}
+
+	if len(cfg.IngestProtocols) == 0 {
+		cfg.IngestProtocols = []string{"rtmp"}
+	}
+
+	if cfg.APIURL == "" {
+		cfg.APIURL = "http://" + net.JoinHostPort(cfg.Host, "8081")
+	}
+
+	if len(cfg.PlaybackProtocols) == 0 {
+		cfg.PlaybackProtocols = []string{"hls"}
+	}
+
+	return cfg
+
+}
@@ -0,0 +1,17 @@
+package config
+
+type PublisherConfig struct {
+	Policy string
+}
+
+// GetPublisherConfig reads what happens when a second encoder publishes
+// with a key that is already live. PUBLISHER_POLICY is "reject" (the
+// default, the newcomer is turned away) or "kick", which disconnects the
+// current publisher and lets the newcomer take over.
+func GetPublisherConfig() PublisherConfig {
+
+	return PublisherConfig{
+		Policy: getEnv("PUBLISHER_POLICY", "reject"),
+	}
+
+}
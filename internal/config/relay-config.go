@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+type RelayConfig struct {
+	StartupPeriod     time.Duration
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+	MaxRestarts       int
+	Retention         time.Duration
+}
+
+// GetRelayConfig reads how the ffmpeg relays to the platforms are
+// supervised. A relay counts as running once it has stayed up for
+// RELAY_STARTUP_PERIOD. A relay that exits is restarted after
+// RELAY_RESTART_BACKOFF, doubling up to RELAY_MAX_RESTART_BACKOFF, and is
+// given up on after RELAY_MAX_RESTARTS restarts in a row (0 retries
+// forever). A relay that stayed up longer than the longest backoff starts
+// the backoff and the budget over. Stopped and failed relays are reported
+// for RELAY_RETENTION before they are forgotten.
+func GetRelayConfig() RelayConfig {
+
+	return RelayConfig{
+		StartupPeriod:     getDurationEnv("RELAY_STARTUP_PERIOD", 5*time.Second),
+		RestartBackoff:    getDurationEnv("RELAY_RESTART_BACKOFF", time.Second),
+		MaxRestartBackoff: getDurationEnv("RELAY_MAX_RESTART_BACKOFF", 30*time.Second),
+		MaxRestarts:       getIntEnv("RELAY_MAX_RESTARTS", 5),
+		Retention:         getDurationEnv("RELAY_RETENTION", 10*time.Minute),
+	}
+
+}
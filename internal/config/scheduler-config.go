@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+type SchedulerConfig struct {
+	ProvisionLead time.Duration
+	PollInterval  time.Duration
+}
+
+// GetSchedulerConfig reads the scheduler settings from the environment.
+// ProvisionLead is how long before a scheduled start the platform
+// broadcasts are created; PollInterval is how often schedules are checked,
+// and falls back to its default unless it is positive.
+func GetSchedulerConfig() SchedulerConfig {
+
+	return SchedulerConfig{
+		ProvisionLead: getDurationEnv("SCHEDULER_PROVISION_LEAD", 30*time.Minute),
+		PollInterval:  getPositiveDurationEnv("SCHEDULER_POLL_INTERVAL", 15*time.Second),
+	}
+
+}
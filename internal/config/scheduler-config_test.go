@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerPollInterval(t *testing.T) {
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 15 * time.Second},
+		{value: "5s", want: 5 * time.Second},
+		{value: "0s", want: 15 * time.Second},
+		{value: "0", want: 15 * time.Second},
+		{value: "-1m", want: 15 * time.Second},
+		{value: "soon", want: 15 * time.Second},
+	}
+
+	for _, test := range tests {
+
+		t.Setenv("SCHEDULER_POLL_INTERVAL", test.value)
+
+		if got := GetSchedulerConfig().PollInterval; got != test.want {
+			t.Fatalf("SCHEDULER_POLL_INTERVAL=%q: got %s, want %s", test.value, got, test.want)
+		}
+
+	}
+
+}
@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+type SRSAPIConfig struct {
+	BaseURL string
+	Timeout time.Duration
+	Retries int
+}
+
+// GetSRSAPIConfig reads where the SRS HTTP API lives (SRS_API_URL), how
+// long a call may take (SRS_API_TIMEOUT) and how often a failed call is
+// retried (SRS_API_RETRIES).
+func GetSRSAPIConfig() SRSAPIConfig {
+
+	return SRSAPIConfig{
+		BaseURL: getEnv("SRS_API_URL", "http://localhost:1985"),
+		Timeout: getDurationEnv("SRS_API_TIMEOUT", 5*time.Second),
+		Retries: getIntEnv("SRS_API_RETRIES", 2),
+	}
+
+}
@@ -0,0 +1,75 @@
+package config
+
+import "time"
+
+type SRSHLSConfig struct {
+	Enabled  bool
+	Fragment time.Duration
+	Window   time.Duration
+}
+
+// SRSSRTConfig is SRS's SRT listener. Latency is SRT's receive buffer in
+// time: higher values ride out more packet loss at the cost of delay.
+type SRSSRTConfig struct {
+	Port    int
+	Latency time.Duration
+}
+
+type SRSDVRConfig struct {
+	Enabled  bool
+	Path     string
+	Plan     string
+	Duration time.Duration
+}
+
+// SRSConfig is what srs.conf is rendered from. The RTMP port comes from
+// the server's -rtmp-port flag and the API port from SRS_API_URL, so each
+// port is set in one place.
+type SRSConfig struct {
+	HTTPPort       int
+	RTCPort        int
+	RTCCandidate   string
+	MaxConnections int
+	LogLevel       string
+	Vhost          string
+	HTMLDir        string
+	SRT            SRSSRTConfig
+	HLS            SRSHLSConfig
+	DVR            SRSDVRConfig
+}
+
+// GetSRSConfig reads the SRS settings chronocast-server writes into
+// srs.conf: the HTTP server port for HLS (SRS_HTTP_PORT), the WebRTC UDP
+// port and candidate (SRS_RTC_PORT, SRS_RTC_CANDIDATE), the SRT UDP port
+// and latency (SRS_SRT_PORT, SRS_SRT_LATENCY), connection limit, log
+// level, vhost and web root, and the HLS (SRS_HLS_*) and DVR (SRS_DVR_*)
+// settings. DVR plan is "session" (one file per publish) or "segment" (a
+// new file every SRS_DVR_DURATION).
+func GetSRSConfig() SRSConfig {
+
+	return SRSConfig{
+		HTTPPort:       getIntEnv("SRS_HTTP_PORT", 8080),
+		RTCPort:        getIntEnv("SRS_RTC_PORT", 10080),
+		RTCCandidate:   getEnv("SRS_RTC_CANDIDATE", "*"),
+		MaxConnections: getIntEnv("SRS_MAX_CONNECTIONS", 1000),
+		LogLevel:       getEnv("SRS_LOG_LEVEL", "trace"),
+		Vhost:          getEnv("SRS_VHOST", "__defaultVhost__"),
+		HTMLDir:        getEnv("SRS_HTML_DIR", "/usr/local/srs/objs/nginx/html"),
+		SRT: SRSSRTConfig{
+			Port:    getIntEnv("SRS_SRT_PORT", 10081),
+			Latency: getDurationEnv("SRS_SRT_LATENCY", 120*time.Millisecond),
+		},
+		HLS: SRSHLSConfig{
+			Enabled:  getBoolEnv("SRS_HLS_ENABLED", true),
+			Fragment: getDurationEnv("SRS_HLS_FRAGMENT", 10*time.Second),
+			Window:   getDurationEnv("SRS_HLS_WINDOW", 60*time.Second),
+		},
+		DVR: SRSDVRConfig{
+			Enabled:  getBoolEnv("SRS_DVR_ENABLED", false),
+			Path:     getEnv("SRS_DVR_PATH", "/usr/local/srs/objs/nginx/html/dvr/[app]/[stream].[timestamp].flv"),
+			Plan:     getEnv("SRS_DVR_PLAN", "session"),
+			Duration: getDurationEnv("SRS_DVR_DURATION", 30*time.Minute),
+		},
+	}
+
+}
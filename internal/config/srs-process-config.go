@@ -0,0 +1,37 @@
+package config
+
+import "time"
+
+type SRSProcessConfig struct {
+	Mode              string
+	DockerImage       string
+	WorkDir           string
+	ReadyTimeout      time.Duration
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+	StopTimeout       time.Duration
+}
+
+// GetSRSProcessConfig reads how SRS is run. SRS_MODE is "docker" (the
+// default, SRS runs in a container started alongside the server and
+// stopped by its image, SRS_DOCKER_IMAGE), "process" (SRS_PATH is launched
+// as a child process with CONFIG_PATH and restarted if it crashes) or
+// "external" (SRS is managed elsewhere and left alone).
+//
+// In process mode SRS runs in SRS_WORK_DIR, gets SRS_READY_TIMEOUT to
+// answer its API, is restarted after SRS_RESTART_BACKOFF doubling up to
+// SRS_MAX_RESTART_BACKOFF, and is killed if it has not exited
+// SRS_STOP_TIMEOUT after SIGTERM.
+func GetSRSProcessConfig() SRSProcessConfig {
+
+	return SRSProcessConfig{
+		Mode:              getEnv("SRS_MODE", "docker"),
+		DockerImage:       getEnv("SRS_DOCKER_IMAGE", "ossrs/srs:5"),
+		WorkDir:           getEnv("SRS_WORK_DIR", ""),
+		ReadyTimeout:      getDurationEnv("SRS_READY_TIMEOUT", 30*time.Second),
+		RestartBackoff:    getDurationEnv("SRS_RESTART_BACKOFF", time.Second),
+		MaxRestartBackoff: getDurationEnv("SRS_MAX_RESTART_BACKOFF", time.Minute),
+		StopTimeout:       getDurationEnv("SRS_STOP_TIMEOUT", 10*time.Second),
+	}
+
+}
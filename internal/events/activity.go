@@ -0,0 +1,147 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRecordings bounds how many recordings are remembered per stream.
+const maxRecordings = 50
+
+type Recording struct {
+	File string    `json:"file"`
+	Time time.Time `json:"time"`
+}
+
+type Segment struct {
+	File     string    `json:"file"`
+	URL      string    `json:"url"`
+	SeqNo    int       `json:"seqNo"`
+	Duration float64   `json:"duration"`
+	Time     time.Time `json:"time"`
+}
+
+type StreamActivity struct {
+	Viewers     int         `json:"viewers"`
+	Recordings  []Recording `json:"recordings"`
+	LastSegment *Segment    `json:"lastSegment,omitempty"`
+}
+
+// Activity follows the event bus to keep per stream viewer counts, DVR
+// recordings and the latest HLS segment, keyed by stream key ID.
+type Activity struct {
+	viewers      map[string]map[string]struct{}
+	recordings   map[string][]Recording
+	segments     map[string]Segment
+	activityLock sync.RWMutex
+}
+
+func NewActivity(bus *Bus) *Activity {
+
+	activity := &Activity{
+		viewers:    make(map[string]map[string]struct{}),
+		recordings: make(map[string][]Recording),
+		segments:   make(map[string]Segment),
+	}
+
+	bus.Subscribe(activity.handle)
+
+	return activity
+
+}
+
+func (a *Activity) Stream(keyID string) StreamActivity {
+
+	a.activityLock.RLock()
+
+	defer a.activityLock.RUnlock()
+
+	activity := StreamActivity{
+		Viewers:    len(a.viewers[keyID]),
+		Recordings: append([]Recording{}, a.recordings[keyID]...),
+	}
+
+	if segment, exists := a.segments[keyID]; exists {
+		activity.LastSegment = &segment
+	}
+
+	return activity
+
+}
+
+func (a *Activity) handle(event Event) {
+
+	a.activityLock.Lock()
+
+	defer a.activityLock.Unlock()
+
+	switch event.Type {
+
+	case Play:
+		if event.KeyID == "" || event.Relay {
+			return
+		}
+
+		if a.viewers[event.KeyID] == nil {
+			a.viewers[event.KeyID] = make(map[string]struct{})
+		}
+
+		a.viewers[event.KeyID][event.ClientID] = struct{}{}
+
+	case Stop:
+		a.removeViewer(event.KeyID, event.ClientID)
+
+	case Close:
+		// A player that drops without on_stop still closes its connection.
+		for keyID := range a.viewers {
+			a.removeViewer(keyID, event.ClientID)
+		}
+
+	case DVR:
+		if event.KeyID == "" {
+			return
+		}
+
+		recordings := append(a.recordings[event.KeyID], Recording{
+			File: event.File,
+			Time: event.Time,
+		})
+
+		if len(recordings) > maxRecordings {
+			recordings = recordings[len(recordings)-maxRecordings:]
+		}
+
+		a.recordings[event.KeyID] = recordings
+
+	case HLS:
+		if event.KeyID == "" {
+			return
+		}
+
+		a.segments[event.KeyID] = Segment{
+			File:     event.File,
+			URL:      event.URL,
+			SeqNo:    event.SeqNo,
+			Duration: event.Duration,
+			Time:     event.Time,
+		}
+
+	}
+
+}
+
+func (a *Activity) removeViewer(keyID, clientID string) {
+
+	viewers, exists := a.viewers[keyID]
+
+	if !exists {
+		return
+	}
+
+	delete(viewers, clientID)
+
+	if len(viewers) == 0 {
+		delete(a.viewers, keyID)
+	}
+
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	Connect   Type = "connect"
+	Close     Type = "close"
+	Publish   Type = "publish"
+	Unpublish Type = "unpublish"
+	Play      Type = "play"
+	Stop      Type = "stop"
+	DVR       Type = "dvr"
+	HLS       Type = "hls"
+)
+
+// Event is something the media server reported through one of its hooks.
+// KeyID is the ID of the stream key the stream publishes on, when it could
+// be worked out; the stream name itself may be a plaintext key and is not
+// carried.
+type Event struct {
+	Type     Type      `json:"type"`
+	Time     time.Time `json:"time"`
+	ClientID string    `json:"clientID,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	App      string    `json:"app,omitempty"`
+	KeyID    string    `json:"keyID,omitempty"`
+	File     string    `json:"file,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+	SeqNo    int       `json:"seqNo,omitempty"`
+	Relay    bool      `json:"relay,omitempty"`
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 256
+
+type subscriber struct {
+	events chan Event
+	done   chan struct{}
+}
+
+// Bus fans events out to subscribers. Each subscriber receives events in
+// order on its own goroutine, so a slow subscriber never holds up the hook
+// that published the event.
+type Bus struct {
+	subscribers map[int]*subscriber
+	nextID      int
+	lock        sync.RWMutex
+}
+
+func NewBus() *Bus {
+
+	return &Bus{
+		subscribers: make(map[int]*subscriber),
+	}
+
+}
+
+// Subscribe calls fn for every event published from now on. The returned
+// function unsubscribes.
+func (b *Bus) Subscribe(fn func(Event)) func() {
+
+	sub := &subscriber{
+		events: make(chan Event, subscriberBuffer),
+		done:   make(chan struct{}),
+	}
+
+	b.lock.Lock()
+
+	id := b.nextID
+
+	b.nextID++
+
+	b.subscribers[id] = sub
+
+	b.lock.Unlock()
+
+	go func() {
+
+		for {
+
+			select {
+
+			case event := <-sub.events:
+				fn(event)
+
+			case <-sub.done:
+				return
+
+			}
+
+		}
+
+	}()
+
+	var once sync.Once
+
+	return func() {
+
+		once.Do(func() {
+
+			b.lock.Lock()
+
+			delete(b.subscribers, id)
+
+			b.lock.Unlock()
+
+			close(sub.done)
+
+		})
+
+	}
+
+}
+
+func (b *Bus) Publish(event Event) {
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.lock.RLock()
+
+	defer b.lock.RUnlock()
+
+	for _, sub := range b.subscribers {
+
+		select {
+
+		case sub.events <- event:
+
+		default:
+			log.Printf("Event bus subscriber is falling behind, dropped %s event", event.Type)
+
+		}
+
+	}
+
+}
@@ -0,0 +1,352 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AMF0 type markers.
+const (
+	amf0Number      = 0x00
+	amf0Boolean     = 0x01
+	amf0String      = 0x02
+	amf0Object      = 0x03
+	amf0Null        = 0x05
+	amf0Undefined   = 0x06
+	amf0ECMAArray   = 0x08
+	amf0ObjectEnd   = 0x09
+	amf0StrictArray = 0x0A
+	amf0Date        = 0x0B
+	amf0LongString  = 0x0C
+)
+
+// maxAMF0Depth bounds how deeply objects and arrays may nest, so a crafted
+// command cannot recurse the decoder's stack without limit.
+const maxAMF0Depth = 32
+
+var (
+	errAMF0Truncated = errors.New("truncated AMF0 value")
+	errAMF0TooDeep   = errors.New("AMF0 value is nested too deeply")
+)
+
+// amf0Decoder reads AMF0 values: numbers as float64, booleans, strings,
+// objects and ECMA arrays as map[string]any, strict arrays as []any and
+// null or undefined as nil.
+type amf0Decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *amf0Decoder) more() bool {
+	return d.pos < len(d.data)
+}
+
+// rest returns the bytes not decoded yet.
+func (d *amf0Decoder) rest() []byte {
+	return d.data[d.pos:]
+}
+
+func (d *amf0Decoder) take(n int) ([]byte, error) {
+
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errAMF0Truncated
+	}
+
+	b := d.data[d.pos : d.pos+n]
+
+	d.pos += n
+
+	return b, nil
+
+}
+
+func (d *amf0Decoder) decode() (any, error) {
+
+	marker, err := d.take(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch marker[0] {
+
+	case amf0Object, amf0ECMAArray, amf0StrictArray:
+
+		if d.depth >= maxAMF0Depth {
+			return nil, errAMF0TooDeep
+		}
+
+		d.depth++
+
+		defer func() { d.depth-- }()
+
+	}
+
+	switch marker[0] {
+
+	case amf0Number:
+		return d.number()
+
+	case amf0Boolean:
+
+		b, err := d.take(1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return b[0] != 0, nil
+
+	case amf0String:
+		return d.string(2)
+
+	case amf0LongString:
+		return d.string(4)
+
+	case amf0Object:
+		return d.object()
+
+	case amf0ECMAArray:
+
+		// The count is a hint only; the entries end like an object's.
+		if _, err := d.take(4); err != nil {
+			return nil, err
+		}
+
+		return d.object()
+
+	case amf0StrictArray:
+
+		b, err := d.take(4)
+
+		if err != nil {
+			return nil, err
+		}
+
+		count := binary.BigEndian.Uint32(b)
+
+		if int(count) > len(d.data)-d.pos {
+			return nil, errAMF0Truncated
+		}
+
+		values := make([]any, 0, count)
+
+		for range count {
+
+			value, err := d.decode()
+
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, value)
+
+		}
+
+		return values, nil
+
+	case amf0Date:
+
+		value, err := d.number()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Time zone, always zero.
+		if _, err := d.take(2); err != nil {
+			return nil, err
+		}
+
+		return value, nil
+
+	case amf0Null, amf0Undefined:
+		return nil, nil
+
+	}
+
+	return nil, fmt.Errorf("unsupported AMF0 type 0x%02x", marker[0])
+
+}
+
+func (d *amf0Decoder) number() (float64, error) {
+
+	b, err := d.take(8)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+
+}
+
+func (d *amf0Decoder) string(lengthSize int) (string, error) {
+
+	b, err := d.take(lengthSize)
+
+	if err != nil {
+		return "", err
+	}
+
+	var length int
+
+	if lengthSize == 2 {
+		length = int(binary.BigEndian.Uint16(b))
+	} else {
+		length = int(binary.BigEndian.Uint32(b))
+	}
+
+	s, err := d.take(length)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(s), nil
+
+}
+
+func (d *amf0Decoder) object() (map[string]any, error) {
+
+	object := make(map[string]any)
+
+	for {
+
+		key, err := d.string(2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" && d.more() && d.data[d.pos] == amf0ObjectEnd {
+			d.pos++
+			return object, nil
+		}
+
+		value, err := d.decode()
+
+		if err != nil {
+			return nil, err
+		}
+
+		object[key] = value
+
+	}
+
+}
+
+// decodeAMF0 decodes every value in data.
+func decodeAMF0(data []byte) ([]any, error) {
+
+	d := &amf0Decoder{data: data}
+
+	var values []any
+
+	for d.more() {
+
+		value, err := d.decode()
+
+		if err != nil {
+			return values, err
+		}
+
+		values = append(values, value)
+
+	}
+
+	return values, nil
+
+}
+
+// encodeAMF0 encodes values. Integers are written as numbers and maps as
+// objects, with their keys sorted.
+func encodeAMF0(values ...any) []byte {
+
+	var buf bytes.Buffer
+
+	for _, value := range values {
+		writeAMF0(&buf, value)
+	}
+
+	return buf.Bytes()
+
+}
+
+func writeAMF0(buf *bytes.Buffer, value any) {
+
+	switch v := value.(type) {
+
+	case nil:
+		buf.WriteByte(amf0Null)
+
+	case bool:
+
+		buf.WriteByte(amf0Boolean)
+
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+	case int:
+		writeAMF0Number(buf, float64(v))
+
+	case uint32:
+		writeAMF0Number(buf, float64(v))
+
+	case float64:
+		writeAMF0Number(buf, v)
+
+	case string:
+
+		if len(v) > math.MaxUint16 {
+			buf.WriteByte(amf0LongString)
+			binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		} else {
+			buf.WriteByte(amf0String)
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		}
+
+		buf.WriteString(v)
+
+	case map[string]any:
+
+		buf.WriteByte(amf0Object)
+
+		keys := make([]string, 0, len(v))
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			binary.Write(buf, binary.BigEndian, uint16(len(key)))
+			buf.WriteString(key)
+			writeAMF0(buf, v[key])
+		}
+
+		buf.Write([]byte{0, 0, amf0ObjectEnd})
+
+	default:
+		buf.WriteByte(amf0Undefined)
+
+	}
+
+}
+
+func writeAMF0Number(buf *bytes.Buffer, value float64) {
+
+	buf.WriteByte(amf0Number)
+
+	binary.Write(buf, binary.BigEndian, math.Float64bits(value))
+
+}
@@ -0,0 +1,160 @@
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAMF0RoundTrip(t *testing.T) {
+
+	values := []any{
+		"connect",
+		1.0,
+		map[string]any{
+			"app":      "live",
+			"tcUrl":    "rtmp://localhost/live",
+			"fpad":     false,
+			"nested":   map[string]any{"level": 2.0},
+			"nothing":  nil,
+			"capacity": 15.0,
+		},
+		nil,
+	}
+
+	decoded, err := decodeAMF0(encodeAMF0(values...))
+
+	if err != nil {
+		t.Fatalf("decodeAMF0: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, values) {
+		t.Fatalf("decoded %#v, want %#v", decoded, values)
+	}
+
+}
+
+func TestAMF0Decode(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want []any
+		err  error
+	}{
+		{
+			name: "strict array",
+			data: []byte{amf0StrictArray, 0, 0, 0, 2, amf0Boolean, 1, amf0Null},
+			want: []any{[]any{true, nil}},
+		},
+		{
+			name: "ecma array",
+			data: []byte{amf0ECMAArray, 0, 0, 0, 1, 0, 1, 'a', amf0Boolean, 0, 0, 0, amf0ObjectEnd},
+			want: []any{map[string]any{"a": false}},
+		},
+		{
+			name: "truncated string",
+			data: []byte{amf0String, 0, 5, 'a', 'b'},
+			err:  errAMF0Truncated,
+		},
+		{
+			name: "strict array count beyond data",
+			data: []byte{amf0StrictArray, 0xFF, 0xFF, 0xFF, 0xFF},
+			err:  errAMF0Truncated,
+		},
+		{
+			name: "unterminated object",
+			data: []byte{amf0Object, 0, 1, 'a', amf0Null},
+			err:  errAMF0Truncated,
+		},
+		{
+			name: "nested objects beyond the cap",
+			data: nestedAMF0(amf0Object, maxAMF0Depth+1),
+			err:  errAMF0TooDeep,
+		},
+		{
+			name: "nested strict arrays beyond the cap",
+			data: nestedAMF0(amf0StrictArray, maxAMF0Depth+1),
+			err:  errAMF0TooDeep,
+		},
+		{
+			name: "deeply nested markers",
+			data: bytes.Repeat([]byte{amf0StrictArray, 0, 0, 0, 1}, 1<<20),
+			err:  errAMF0TooDeep,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			values, err := decodeAMF0(test.data)
+
+			if test.err != nil {
+
+				if !errors.Is(err, test.err) {
+					t.Fatalf("got error %v, want %v", err, test.err)
+				}
+
+				return
+
+			}
+
+			if err != nil {
+				t.Fatalf("decodeAMF0: %v", err)
+			}
+
+			if !reflect.DeepEqual(values, test.want) {
+				t.Fatalf("decoded %#v, want %#v", values, test.want)
+			}
+
+		})
+
+	}
+
+}
+
+func TestAMF0DepthCap(t *testing.T) {
+
+	for _, marker := range []byte{amf0Object, amf0StrictArray} {
+
+		if _, err := decodeAMF0(nestedAMF0(marker, maxAMF0Depth)); err != nil {
+			t.Fatalf("marker 0x%02x nested %d deep: %v", marker, maxAMF0Depth, err)
+		}
+
+	}
+
+}
+
+// nestedAMF0 encodes depth objects or strict arrays, each holding the next,
+// around a null.
+func nestedAMF0(marker byte, depth int) []byte {
+
+	var buf bytes.Buffer
+
+	for range depth {
+
+		buf.WriteByte(marker)
+
+		if marker == amf0Object {
+			buf.Write([]byte{0, 1, 'k'})
+		} else {
+			buf.Write([]byte{0, 0, 0, 1})
+		}
+
+	}
+
+	buf.WriteByte(amf0Null)
+
+	if marker == amf0Object {
+
+		for range depth {
+			buf.Write([]byte{0, 0, amf0ObjectEnd})
+		}
+
+	}
+
+	return buf.Bytes()
+
+}
@@ -0,0 +1,399 @@
+package embedded
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// RTMP message types.
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAcknowledgement  = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF3         = 15
+	msgCommandAMF3      = 17
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+// Chunk stream IDs used for what the server sends.
+const (
+	csidControl = 2
+	csidCommand = 3
+	csidAudio   = 4
+	csidData    = 5
+	csidVideo   = 6
+)
+
+const (
+	defaultChunkSize = 128
+	outChunkSize     = 4096
+	maxChunkSize     = 1 << 24
+	maxMessageSize   = 8 << 20
+	maxChunkStreams  = 64
+	extendedStamp    = 0xFFFFFF
+)
+
+// message is one RTMP message. Payloads are shared between the players a
+// message is sent to and must not be modified.
+type message struct {
+	typeID    uint8
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// chunkStream is the state the chunk header compression of one chunk
+// stream refers back to.
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    uint8
+	streamID  uint32
+	extended  bool
+	payload   []byte
+}
+
+type chunkReader struct {
+	r         *bufio.Reader
+	chunkSize uint32
+	streams   map[uint32]*chunkStream
+}
+
+func newChunkReader(r io.Reader) *chunkReader {
+
+	return &chunkReader{
+		r:         bufio.NewReaderSize(r, 64<<10),
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+
+}
+
+func (cr *chunkReader) readFull(b []byte) error {
+
+	_, err := io.ReadFull(cr.r, b)
+
+	return err
+
+}
+
+func (cr *chunkReader) readUint(n int) (uint32, error) {
+
+	var b [4]byte
+
+	if err := cr.readFull(b[4-n:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(b[:]), nil
+
+}
+
+// readMessage reads chunks until a message is complete.
+func (cr *chunkReader) readMessage() (*message, error) {
+
+	for {
+
+		msg, err := cr.readChunk()
+
+		if err != nil || msg != nil {
+			return msg, err
+		}
+
+	}
+
+}
+
+func (cr *chunkReader) readChunk() (*message, error) {
+
+	var basic [1]byte
+
+	if err := cr.readFull(basic[:]); err != nil {
+		return nil, err
+	}
+
+	format := basic[0] >> 6
+
+	csid := uint32(basic[0] & 0x3F)
+
+	switch csid {
+
+	case 0:
+
+		b, err := cr.readUint(1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		csid = 64 + b
+
+	case 1:
+
+		var b [2]byte
+
+		if err := cr.readFull(b[:]); err != nil {
+			return nil, err
+		}
+
+		csid = 64 + uint32(b[0]) + uint32(b[1])*256
+
+	}
+
+	cs, exists := cr.streams[csid]
+
+	if !exists {
+
+		if format != 0 {
+			return nil, fmt.Errorf("chunk stream %d starts without a full header", csid)
+		}
+
+		if len(cr.streams) >= maxChunkStreams {
+			return nil, fmt.Errorf("too many chunk streams, chunk stream %d exceeds %d", csid, maxChunkStreams)
+		}
+
+		cs = &chunkStream{}
+
+		cr.streams[csid] = cs
+
+	}
+
+	starting := len(cs.payload) == 0
+
+	if format <= 2 {
+
+		stamp, err := cr.readUint(3)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if format <= 1 {
+
+			length, err := cr.readUint(3)
+
+			if err != nil {
+				return nil, err
+			}
+
+			typeID, err := cr.readUint(1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			cs.length = length
+
+			cs.typeID = uint8(typeID)
+
+		}
+
+		if format == 0 {
+
+			var b [4]byte
+
+			if err := cr.readFull(b[:]); err != nil {
+				return nil, err
+			}
+
+			// The message stream ID is the one little-endian field.
+			cs.streamID = binary.LittleEndian.Uint32(b[:])
+
+		}
+
+		cs.extended = stamp == extendedStamp
+
+		if cs.extended {
+
+			if stamp, err = cr.readUint(4); err != nil {
+				return nil, err
+			}
+
+		}
+
+		if format == 0 {
+			cs.timestamp = stamp
+			cs.delta = 0
+		} else {
+			cs.delta = stamp
+			cs.timestamp += stamp
+		}
+
+	} else {
+
+		if cs.extended {
+
+			if _, err := cr.readUint(4); err != nil {
+				return nil, err
+			}
+
+		}
+
+		// A type 3 chunk that starts a message repeats the previous delta.
+		if starting {
+			cs.timestamp += cs.delta
+		}
+
+	}
+
+	if cs.length > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is too large", cs.length)
+	}
+
+	size := min(cs.length-uint32(len(cs.payload)), cr.chunkSize)
+
+	start := len(cs.payload)
+
+	// The payload grows as chunks arrive rather than by the declared
+	// length, which costs nothing to send.
+	cs.payload = slices.Grow(cs.payload, int(size))
+
+	cs.payload = cs.payload[:start+int(size)]
+
+	if err := cr.readFull(cs.payload[start:]); err != nil {
+		return nil, err
+	}
+
+	if uint32(len(cs.payload)) < cs.length {
+		return nil, nil
+	}
+
+	msg := &message{
+		typeID:    cs.typeID,
+		streamID:  cs.streamID,
+		timestamp: cs.timestamp,
+		payload:   cs.payload,
+	}
+
+	// The payload now belongs to the message.
+	cs.payload = nil
+
+	return msg, nil
+
+}
+
+func (cr *chunkReader) setChunkSize(size uint32) error {
+
+	if size < 1 || size > maxChunkSize {
+		return fmt.Errorf("invalid chunk size %d", size)
+	}
+
+	cr.chunkSize = size
+
+	return nil
+
+}
+
+// abort drops the partly read message on a chunk stream.
+func (cr *chunkReader) abort(csid uint32) {
+
+	if cs, exists := cr.streams[csid]; exists {
+		cs.payload = nil
+	}
+
+}
+
+type chunkWriter struct {
+	w         *bufio.Writer
+	chunkSize uint32
+}
+
+func newChunkWriter(w io.Writer) *chunkWriter {
+
+	return &chunkWriter{
+		w:         bufio.NewWriterSize(w, 64<<10),
+		chunkSize: defaultChunkSize,
+	}
+
+}
+
+// writeMessage writes a message as a full header chunk followed by
+// continuation chunks. It does not flush.
+func (cw *chunkWriter) writeMessage(csid uint8, msg *message) error {
+
+	stamp := msg.timestamp
+
+	extended := stamp >= extendedStamp
+
+	if extended {
+		stamp = extendedStamp
+	}
+
+	var header [16]byte
+
+	header[0] = csid & 0x3F
+
+	putUint24(header[1:4], stamp)
+
+	putUint24(header[4:7], uint32(len(msg.payload)))
+
+	header[7] = msg.typeID
+
+	binary.LittleEndian.PutUint32(header[8:12], msg.streamID)
+
+	n := 12
+
+	if extended {
+		binary.BigEndian.PutUint32(header[12:16], msg.timestamp)
+		n = 16
+	}
+
+	if _, err := cw.w.Write(header[:n]); err != nil {
+		return err
+	}
+
+	payload := msg.payload
+
+	for first := true; first || len(payload) > 0; first = false {
+
+		if !first {
+
+			continuation := []byte{0xC0 | csid&0x3F}
+
+			if extended {
+				continuation = binary.BigEndian.AppendUint32(continuation, msg.timestamp)
+			}
+
+			if _, err := cw.w.Write(continuation); err != nil {
+				return err
+			}
+
+		}
+
+		size := min(uint32(len(payload)), cw.chunkSize)
+
+		if _, err := cw.w.Write(payload[:size]); err != nil {
+			return err
+		}
+
+		payload = payload[size:]
+
+	}
+
+	return nil
+
+}
+
+func (cw *chunkWriter) flush() error {
+	return cw.w.Flush()
+}
+
+func putUint24(b []byte, v uint32) {
+
+	b[0] = byte(v >> 16)
+
+	b[1] = byte(v >> 8)
+
+	b[2] = byte(v)
+
+}
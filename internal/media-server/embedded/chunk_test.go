@@ -0,0 +1,190 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		chunkSize uint32
+		msg       message
+	}{
+		{
+			name:      "single chunk",
+			chunkSize: defaultChunkSize,
+			msg:       message{typeID: msgCommandAMF0, streamID: 1, timestamp: 40, payload: []byte("hello")},
+		},
+		{
+			name:      "split across chunks",
+			chunkSize: defaultChunkSize,
+			msg:       message{typeID: msgVideo, streamID: 1, timestamp: 1000, payload: bytes.Repeat([]byte{7}, 1000)},
+		},
+		{
+			name:      "extended timestamp",
+			chunkSize: 100,
+			msg:       message{typeID: msgAudio, streamID: 1, timestamp: 0x01000000, payload: bytes.Repeat([]byte{1}, 250)},
+		},
+		{
+			name:      "empty payload",
+			chunkSize: defaultChunkSize,
+			msg:       message{typeID: msgDataAMF0, streamID: 1},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+
+			cw := newChunkWriter(&buf)
+
+			cw.chunkSize = test.chunkSize
+
+			if err := cw.writeMessage(csidVideo, &test.msg); err != nil {
+				t.Fatalf("writeMessage: %v", err)
+			}
+
+			if err := cw.flush(); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+
+			cr := newChunkReader(&buf)
+
+			if err := cr.setChunkSize(test.chunkSize); err != nil {
+				t.Fatalf("setChunkSize: %v", err)
+			}
+
+			msg, err := cr.readMessage()
+
+			if err != nil {
+				t.Fatalf("readMessage: %v", err)
+			}
+
+			if msg.typeID != test.msg.typeID || msg.streamID != test.msg.streamID || msg.timestamp != test.msg.timestamp {
+				t.Fatalf("read %d/%d/%d, want %d/%d/%d", msg.typeID, msg.streamID, msg.timestamp, test.msg.typeID, test.msg.streamID, test.msg.timestamp)
+			}
+
+			if !bytes.Equal(msg.payload, test.msg.payload) {
+				t.Fatalf("read a payload of %d bytes, want %d", len(msg.payload), len(test.msg.payload))
+			}
+
+		})
+
+	}
+
+}
+
+func TestChunkReaderErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{
+			name: "continuation without a full header",
+			data: []byte{0xC3},
+			want: "without a full header",
+		},
+		{
+			name: "message too large",
+			data: fullHeader(3, maxMessageSize+1),
+			want: "too large",
+		},
+		{
+			name: "too many chunk streams",
+			data: manyChunkStreams(maxChunkStreams + 1),
+			want: "too many chunk streams",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			cr := newChunkReader(bytes.NewReader(test.data))
+
+			var err error
+
+			for err == nil {
+				_, err = cr.readChunk()
+			}
+
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got error %v, want one containing %q", err, test.want)
+			}
+
+		})
+
+	}
+
+}
+
+func TestChunkReaderGrowsPayloadAsChunksArrive(t *testing.T) {
+
+	// A header declaring the largest message followed by a single chunk.
+	data := append(fullHeader(3, maxMessageSize), make([]byte, defaultChunkSize)...)
+
+	cr := newChunkReader(bytes.NewReader(data))
+
+	msg, err := cr.readChunk()
+
+	if err != nil || msg != nil {
+		t.Fatalf("readChunk returned %v, %v, want an incomplete message", msg, err)
+	}
+
+	if got := cap(cr.streams[3].payload); got >= maxMessageSize {
+		t.Fatalf("payload reserved %d bytes after one chunk", got)
+	}
+
+	if _, err := cr.readChunk(); err != io.EOF {
+		t.Fatalf("got %v at the end of the data, want EOF", err)
+	}
+
+}
+
+// fullHeader encodes a format 0 chunk header for a message of length bytes.
+func fullHeader(csid byte, length uint32) []byte {
+
+	header := make([]byte, 12)
+
+	header[0] = csid
+
+	putUint24(header[4:7], length)
+
+	header[7] = msgVideo
+
+	binary.LittleEndian.PutUint32(header[8:12], 1)
+
+	return header
+
+}
+
+// manyChunkStreams opens count chunk streams, each carrying a one byte
+// message.
+func manyChunkStreams(count int) []byte {
+
+	var data []byte
+
+	for i := range count {
+
+		header := fullHeader(0, 1)
+
+		data = append(data, header[0], byte(i))
+
+		data = append(data, header[1:]...)
+
+		data = append(data, 0)
+
+	}
+
+	return data
+
+}
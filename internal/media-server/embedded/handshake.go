@@ -0,0 +1,163 @@
+package embedded
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	rtmpVersion       = 3
+	handshakeSize     = 1536
+	handshakeDigestSz = 32
+)
+
+// Keys of the digest ("complex") handshake Flash Player and most encoders
+// try first.
+var (
+	genuineFPKey = append([]byte("Genuine Adobe Flash Player 001"), handshakeKeyTail...)
+
+	genuineFMSKey = append([]byte("Genuine Adobe Flash Media Server 001"), handshakeKeyTail...)
+
+	handshakeKeyTail = []byte{
+		0xF0, 0xEE, 0xC2, 0x4A, 0x80, 0x68, 0xBE, 0xE8, 0x2E, 0x00, 0xD0, 0xD1,
+		0x02, 0x9E, 0x7E, 0x57, 0x6E, 0xEC, 0x5D, 0x2D, 0x29, 0x80, 0x6F, 0xAB,
+		0x93, 0xB8, 0xE6, 0x36, 0xCF, 0xEB, 0x31, 0xAE,
+	}
+)
+
+// serverHandshake performs the server side of the RTMP handshake. A C1
+// carrying a valid digest gets a digest handshake back; anything else gets
+// the plain handshake, which echoes C1.
+func serverHandshake(rw io.ReadWriter) error {
+
+	c0c1 := make([]byte, 1+handshakeSize)
+
+	if _, err := io.ReadFull(rw, c0c1); err != nil {
+		return fmt.Errorf("failed to read C0/C1: %v", err)
+	}
+
+	if c0c1[0] != rtmpVersion {
+		return fmt.Errorf("unsupported RTMP version %d", c0c1[0])
+	}
+
+	c1 := c0c1[1:]
+
+	s1 := make([]byte, handshakeSize)
+
+	if _, err := rand.Read(s1[8:]); err != nil {
+		return fmt.Errorf("failed to generate S1: %v", err)
+	}
+
+	binary.BigEndian.PutUint32(s1[0:4], uint32(time.Now().Unix()))
+
+	var s2 []byte
+
+	if offset, ok := findClientDigest(c1); ok {
+
+		// Advertise a server version so that clients expect a digest.
+		copy(s1[4:8], []byte{0x04, 0x05, 0x00, 0x01})
+
+		serverOffset := digestOffset(s1, offset > 8+764)
+
+		copy(s1[serverOffset:], handshakeDigest(s1, serverOffset, genuineFMSKey[:36]))
+
+		s2 = make([]byte, handshakeSize)
+
+		if _, err := rand.Read(s2); err != nil {
+			return fmt.Errorf("failed to generate S2: %v", err)
+		}
+
+		key := hmacSHA256(genuineFMSKey, c1[offset:offset+handshakeDigestSz])
+
+		copy(s2[handshakeSize-handshakeDigestSz:], hmacSHA256(key, s2[:handshakeSize-handshakeDigestSz]))
+
+	} else {
+
+		s2 = c1
+
+	}
+
+	response := make([]byte, 0, 1+2*handshakeSize)
+
+	response = append(response, rtmpVersion)
+
+	response = append(response, s1...)
+
+	response = append(response, s2...)
+
+	if _, err := rw.Write(response); err != nil {
+		return fmt.Errorf("failed to write S0/S1/S2: %v", err)
+	}
+
+	c2 := make([]byte, handshakeSize)
+
+	if _, err := io.ReadFull(rw, c2); err != nil {
+		return fmt.Errorf("failed to read C2: %v", err)
+	}
+
+	return nil
+
+}
+
+// findClientDigest looks for the client's digest in C1 in either of the
+// two places it may be, and returns its offset if it is valid.
+func findClientDigest(c1 []byte) (int, bool) {
+
+	for _, keyFirst := range []bool{false, true} {
+
+		offset := digestOffset(c1, keyFirst)
+
+		if hmac.Equal(c1[offset:offset+handshakeDigestSz], handshakeDigest(c1, offset, genuineFPKey[:30])) {
+			return offset, true
+		}
+
+	}
+
+	return 0, false
+
+}
+
+// digestOffset is where the digest sits in a C1 or S1. The digest block
+// follows the time and version, or the 764 byte key block when keyFirst is
+// set; the first four bytes of the block pick the offset within it.
+func digestOffset(packet []byte, keyFirst bool) int {
+
+	base := 8
+
+	if keyFirst {
+		base += 764
+	}
+
+	sum := int(packet[base]) + int(packet[base+1]) + int(packet[base+2]) + int(packet[base+3])
+
+	return base + 4 + sum%728
+
+}
+
+// handshakeDigest is the HMAC of a C1 or S1 without its digest bytes.
+func handshakeDigest(packet []byte, offset int, key []byte) []byte {
+
+	message := make([]byte, 0, handshakeSize-handshakeDigestSz)
+
+	message = append(message, packet[:offset]...)
+
+	message = append(message, packet[offset+handshakeDigestSz:]...)
+
+	return hmacSHA256(key, message)
+
+}
+
+func hmacSHA256(key, message []byte) []byte {
+
+	mac := hmac.New(sha256.New, key)
+
+	mac.Write(message)
+
+	return mac.Sum(nil)
+
+}
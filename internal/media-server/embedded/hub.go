@@ -0,0 +1,239 @@
+package embedded
+
+import (
+	"sync"
+	"time"
+)
+
+// maxGOPMessages bounds the messages kept since the last keyframe, so a
+// stream with a very long keyframe interval cannot grow it without limit.
+const maxGOPMessages = 1024
+
+// liveStream is one stream name: its current publisher, its players and
+// what a player joining mid-stream needs before the next packet, i.e.
+// the metadata, the codec sequence headers and the current group of
+// pictures.
+type liveStream struct {
+	name        string
+	publisher   *session
+	players     map[*session]struct{}
+	metadata    *message
+	videoHeader *message
+	audioHeader *message
+	gop         []*message
+	info        streamInfo
+}
+
+// streamInfo is what is known about the published media.
+type streamInfo struct {
+	publishedAt time.Time
+	videoCodec  string
+	profile     string
+	level       string
+	width       int
+	height      int
+	frameRate   float64
+	audioCodec  string
+	audioProf   string
+	sampleRate  int
+	channels    int
+	frames      int64
+}
+
+type hub struct {
+	streams map[string]*liveStream
+	lock    sync.Mutex
+}
+
+func newHub() *hub {
+	return &hub{streams: make(map[string]*liveStream)}
+}
+
+func (h *hub) stream(name string) *liveStream {
+
+	ls, exists := h.streams[name]
+
+	if !exists {
+		ls = &liveStream{name: name, players: make(map[*session]struct{})}
+		h.streams[name] = ls
+	}
+
+	return ls
+
+}
+
+// publish makes s the publisher of a stream name, replacing a publisher
+// that has not gone away yet.
+func (h *hub) publish(name string, s *session) {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	ls := h.stream(name)
+
+	ls.publisher = s
+
+	ls.metadata = nil
+
+	ls.videoHeader = nil
+
+	ls.audioHeader = nil
+
+	ls.gop = nil
+
+	ls.info = streamInfo{publishedAt: time.Now()}
+
+}
+
+// unpublish clears s as the publisher of a stream name. It reports false
+// if s had already been replaced.
+func (h *hub) unpublish(name string, s *session) bool {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	ls, exists := h.streams[name]
+
+	if !exists || ls.publisher != s {
+		return false
+	}
+
+	ls.publisher = nil
+
+	ls.gop = nil
+
+	for player := range ls.players {
+		player.send(statusMessage("status", "NetStream.Play.UnpublishNotify", "Stream is unpublished."))
+	}
+
+	h.prune(ls)
+
+	return true
+
+}
+
+// play adds a player to a stream name and queues what it needs to start
+// decoding. A player may join before the stream is published.
+func (h *hub) play(name string, s *session) {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	ls := h.stream(name)
+
+	ls.players[s] = struct{}{}
+
+	for _, msg := range []*message{ls.metadata, ls.videoHeader, ls.audioHeader} {
+
+		if msg != nil {
+			s.send(msg)
+		}
+
+	}
+
+	for _, msg := range ls.gop {
+		s.send(msg)
+	}
+
+}
+
+func (h *hub) stop(name string, s *session) {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	if ls, exists := h.streams[name]; exists {
+		delete(ls.players, s)
+		h.prune(ls)
+	}
+
+}
+
+func (h *hub) prune(ls *liveStream) {
+
+	if ls.publisher == nil && len(ls.players) == 0 {
+		delete(h.streams, ls.name)
+	}
+
+}
+
+// broadcast caches a message from the publisher and sends it to the
+// stream's players.
+func (h *hub) broadcast(name string, s *session, msg *message) {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	ls, exists := h.streams[name]
+
+	if !exists || ls.publisher != s {
+		return
+	}
+
+	switch msg.typeID {
+
+	case msgDataAMF0:
+
+		ls.metadata = msg
+
+		ls.info.applyMetadata(msg.payload)
+
+	case msgVideo:
+
+		ls.info.observeVideo(msg)
+
+		if isSequenceHeader(msg) {
+			ls.videoHeader = msg
+			break
+		}
+
+		ls.info.frames++
+
+		// Players start from the latest keyframe.
+		if isKeyframe(msg) {
+			ls.gop = nil
+		}
+
+		if len(ls.gop) < maxGOPMessages {
+			ls.gop = append(ls.gop, msg)
+		}
+
+	case msgAudio:
+
+		ls.info.observeAudio(msg)
+
+		if isSequenceHeader(msg) {
+			ls.audioHeader = msg
+		} else if len(ls.gop) > 0 && len(ls.gop) < maxGOPMessages {
+			ls.gop = append(ls.gop, msg)
+		}
+
+	}
+
+	for player := range ls.players {
+		player.send(msg)
+	}
+
+}
+
+// info returns what is known about the media published on a stream name.
+func (h *hub) info(name string) (streamInfo, *session, int, bool) {
+
+	h.lock.Lock()
+
+	defer h.lock.Unlock()
+
+	ls, exists := h.streams[name]
+
+	if !exists || ls.publisher == nil {
+		return streamInfo{}, nil, 0, false
+	}
+
+	return ls.info, ls.publisher, len(ls.players), true
+
+}
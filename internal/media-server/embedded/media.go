@@ -0,0 +1,192 @@
+package embedded
+
+import "fmt"
+
+// FLV codec IDs.
+const (
+	videoCodecAVC  = 7
+	videoCodecHEVC = 12
+	audioFormatMP3 = 2
+	audioFormatAAC = 10
+)
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+var aacProfiles = map[byte]string{1: "Main", 2: "LC", 3: "SSR", 4: "LTP", 5: "HE", 29: "HEv2"}
+
+var avcProfiles = map[byte]string{66: "Baseline", 77: "Main", 88: "Extended", 100: "High", 110: "High 10", 122: "High 4:2:2", 244: "High 4:4:4"}
+
+// Enhanced RTMP signals its video tags with this bit and a FourCC.
+const videoExHeader = 0x80
+
+var videoFourCCs = map[string]string{"avc1": "H264", "hvc1": "H265", "av01": "AV1", "vp09": "VP9"}
+
+// isSequenceHeader reports whether a media message carries codec
+// configuration rather than frames.
+func isSequenceHeader(msg *message) bool {
+
+	p := msg.payload
+
+	if len(p) < 2 {
+		return false
+	}
+
+	switch msg.typeID {
+
+	case msgVideo:
+
+		if p[0]&videoExHeader != 0 {
+			return p[0]&0x0F == 0
+		}
+
+		codec := p[0] & 0x0F
+
+		return (codec == videoCodecAVC || codec == videoCodecHEVC) && p[1] == 0
+
+	case msgAudio:
+		return p[0]>>4 == audioFormatAAC && p[1] == 0
+
+	}
+
+	return false
+
+}
+
+func isKeyframe(msg *message) bool {
+
+	return msg.typeID == msgVideo && len(msg.payload) > 0 && (msg.payload[0]>>4)&0x07 == 1
+
+}
+
+func (info *streamInfo) observeVideo(msg *message) {
+
+	p := msg.payload
+
+	if len(p) == 0 {
+		return
+	}
+
+	if p[0]&videoExHeader != 0 {
+
+		if len(p) >= 5 {
+			info.videoCodec = videoFourCCs[string(p[1:5])]
+		}
+
+		return
+
+	}
+
+	switch p[0] & 0x0F {
+
+	case videoCodecAVC:
+
+		info.videoCodec = "H264"
+
+		// AVCDecoderConfigurationRecord, after the tag header, packet
+		// type and composition time.
+		if isSequenceHeader(msg) && len(p) >= 9 {
+			info.profile = avcProfiles[p[6]]
+			info.level = formatLevel(p[8])
+		}
+
+	case videoCodecHEVC:
+		info.videoCodec = "H265"
+
+	}
+
+}
+
+func (info *streamInfo) observeAudio(msg *message) {
+
+	p := msg.payload
+
+	if len(p) == 0 {
+		return
+	}
+
+	switch p[0] >> 4 {
+
+	case audioFormatAAC:
+
+		info.audioCodec = "AAC"
+
+		// AudioSpecificConfig: object type, sample rate index, channels.
+		if isSequenceHeader(msg) && len(p) >= 4 {
+
+			info.audioProf = aacProfiles[p[2]>>3]
+
+			if index := int(p[2]&0x07)<<1 | int(p[3]>>7); index < len(aacSampleRates) {
+				info.sampleRate = aacSampleRates[index]
+			}
+
+			info.channels = int(p[3]>>3) & 0x0F
+
+		}
+
+	case audioFormatMP3:
+		info.audioCodec = "MP3"
+
+	}
+
+}
+
+// applyMetadata takes what the encoder announced in onMetaData for
+// whatever the codec headers do not say.
+func (info *streamInfo) applyMetadata(payload []byte) {
+
+	values, _ := decodeAMF0(payload)
+
+	for _, value := range values {
+
+		metadata, ok := value.(map[string]any)
+
+		if !ok {
+			continue
+		}
+
+		number := func(key string) float64 {
+			n, _ := metadata[key].(float64)
+			return n
+		}
+
+		info.width = int(number("width"))
+
+		info.height = int(number("height"))
+
+		if rate := number("framerate"); rate > 0 {
+			info.frameRate = rate
+		} else if rate := number("videoframerate"); rate > 0 {
+			info.frameRate = rate
+		}
+
+		if info.sampleRate == 0 {
+			info.sampleRate = int(number("audiosamplerate"))
+		}
+
+		if info.channels == 0 {
+
+			if channels := number("audiochannels"); channels > 0 {
+				info.channels = int(channels)
+			} else if stereo, ok := metadata["stereo"].(bool); ok {
+				info.channels = 1
+				if stereo {
+					info.channels = 2
+				}
+			}
+
+		}
+
+	}
+
+}
+
+// formatLevel turns an H.264 level_idc such as 31 into "3.1".
+func formatLevel(level byte) string {
+
+	if level%10 == 0 {
+		return fmt.Sprint(level / 10)
+	}
+
+	return fmt.Sprintf("%d.%d", level/10, level%10)
+
+}
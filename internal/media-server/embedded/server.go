@@ -0,0 +1,376 @@
+// Package embedded is a media server that accepts RTMP publishes itself,
+// so that neither SRS nor Docker is needed. It handles the handshake, the
+// chunk stream and the AMF0 commands encoders and players send, checks
+// publishes through a mediaserver.IngestHandler and fans the encoder's
+// packets out to the relays pulling the stream over loopback.
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/utils"
+)
+
+var _ mediaserver.MediaServer = (*Server)(nil)
+
+// Server is the embedded implementation of mediaserver.MediaServer.
+type Server struct {
+	Port        string
+	Public      config.PublicConfig
+	Hooks       config.HookConfig
+	Streams     map[string]*mediaserver.Stream
+	StreamsLock sync.RWMutex
+
+	publishers *mediaserver.PublisherRegistry
+	bus        *events.Bus
+	activity   *events.Activity
+	hub        *hub
+
+	handler   mediaserver.IngestHandler
+	listener  net.Listener
+	sessions  map[string]*session
+	startedAt time.Time
+	lock      sync.Mutex
+}
+
+func NewServer(port string) (*Server, error) {
+
+	publishers, err := mediaserver.NewPublisherRegistry(config.GetPublisherConfig().Policy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := publicConfig(config.GetPublicConfig())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The hook routes stay mounted, so they still need a secret.
+	hooks := config.GetHookConfig()
+
+	if hooks.Secret == "" {
+
+		secret, err := utils.GenerateRandomString()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate hook secret: %v", err)
+		}
+
+		hooks.Secret = secret
+
+	}
+
+	bus := events.NewBus()
+
+	return &Server{
+		Port:       port,
+		Public:     public,
+		Hooks:      hooks,
+		Streams:    make(map[string]*mediaserver.Stream),
+		publishers: publishers,
+		bus:        bus,
+		activity:   events.NewActivity(bus),
+		hub:        newHub(),
+		sessions:   make(map[string]*session),
+	}, nil
+
+}
+
+// SetIngestHandler sets what publishes are checked against. Publishes are
+// turned away until it is set.
+func (s *Server) SetIngestHandler(handler mediaserver.IngestHandler) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	s.handler = handler
+
+}
+
+func (s *Server) ingestHandler() mediaserver.IngestHandler {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	return s.handler
+
+}
+
+// Start listens on the RTMP port and accepts connections in the
+// background.
+func (s *Server) Start() error {
+
+	listener, err := net.Listen("tcp", s.Port)
+
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.Port, err)
+	}
+
+	s.lock.Lock()
+
+	s.listener = listener
+
+	s.startedAt = time.Now()
+
+	s.lock.Unlock()
+
+	log.Printf("Embedded RTMP server is listening on %s", listener.Addr())
+
+	go s.accept(listener)
+
+	return nil
+
+}
+
+func (s *Server) accept(listener net.Listener) {
+
+	for {
+
+		conn, err := listener.Accept()
+
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Failed to accept RTMP connection: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		id, err := utils.GenerateID()
+
+		if err != nil {
+			log.Printf("Failed to generate RTMP client ID: %v", err)
+			conn.Close()
+			continue
+		}
+
+		session := newSession(s, id, conn)
+
+		s.lock.Lock()
+
+		s.sessions[id] = session
+
+		s.lock.Unlock()
+
+		go session.run()
+
+	}
+
+}
+
+func (s *Server) removeSession(session *session) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	delete(s.sessions, session.id)
+
+}
+
+// Stop closes the listener and every connection.
+func (s *Server) Stop() error {
+
+	s.lock.Lock()
+
+	listener := s.listener
+
+	s.listener = nil
+
+	sessions := make([]*session, 0, len(s.sessions))
+
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+
+	s.lock.Unlock()
+
+	if listener == nil {
+		return nil
+	}
+
+	log.Println("Stopping embedded RTMP server...")
+
+	err := listener.Close()
+
+	for _, session := range sessions {
+		session.close()
+	}
+
+	return err
+
+}
+
+// Reload does nothing; the embedded server has no configuration to reload.
+func (s *Server) Reload() error {
+	return nil
+}
+
+// Health reports whether the server is accepting connections.
+func (s *Server) Health(ctx context.Context) mediaserver.Health {
+
+	health := mediaserver.Health{
+		Backend:   "embedded",
+		CheckedAt: time.Now(),
+	}
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	if s.listener == nil {
+		health.Error = "not listening"
+		return health
+	}
+
+	health.Healthy = true
+
+	return health
+
+}
+
+// AddStream registers a stream under the ID of its stream key, as
+// bookkeeping for the relays.
+func (s *Server) AddStream(id string, destinations []mediaserver.StreamDestination) error {
+
+	if id == "" {
+		return fmt.Errorf("stream ID cannot be empty")
+	}
+
+	if len(destinations) == 0 {
+		return fmt.Errorf("destinations cannot be empty")
+	}
+
+	log.Printf("Adding stream %s with %d destinations...", id, len(destinations))
+
+	for i, dest := range destinations {
+		log.Printf("Destination %d: URL=%s, StreamKey=%s", i, dest.URL, auth.MaskStreamKey(dest.StreamKey))
+	}
+
+	s.StreamsLock.Lock()
+
+	defer s.StreamsLock.Unlock()
+
+	s.Streams[id] = &mediaserver.Stream{
+		ID:           id,
+		Destinations: destinations,
+	}
+
+	return nil
+
+}
+
+func (s *Server) GetStream(id string) (*mediaserver.Stream, bool) {
+
+	s.StreamsLock.RLock()
+
+	defer s.StreamsLock.RUnlock()
+
+	stream, exists := s.Streams[id]
+
+	return stream, exists
+
+}
+
+// RemoveStream forgets a stream and disconnects its publisher, if any.
+func (s *Server) RemoveStream(id string) error {
+
+	if _, exists := s.GetStream(id); !exists {
+		return fmt.Errorf("stream %s not found", id)
+	}
+
+	log.Printf("Removing stream %s ...", id)
+
+	if publisher, publishing := s.publishers.Active(id); publishing {
+
+		if err := s.KickClient(publisher.ClientID); err != nil && !errors.Is(err, mediaserver.ErrClientNotFound) {
+			return err
+		}
+
+	}
+
+	s.StreamsLock.Lock()
+
+	defer s.StreamsLock.Unlock()
+
+	delete(s.Streams, id)
+
+	return nil
+
+}
+
+// KickClient closes a client's connection.
+func (s *Server) KickClient(clientID string) error {
+
+	if clientID == "" {
+		return fmt.Errorf("client ID cannot be empty")
+	}
+
+	s.lock.Lock()
+
+	session, exists := s.sessions[clientID]
+
+	s.lock.Unlock()
+
+	if !exists {
+		return fmt.Errorf("failed to disconnect client %s: %w", clientID, mediaserver.ErrClientNotFound)
+	}
+
+	session.close()
+
+	log.Printf("Client %s disconnected.", clientID)
+
+	return nil
+
+}
+
+// KickPublisher disconnects the encoder publishing on a stream key.
+func (s *Server) KickPublisher(keyID string) (mediaserver.Publisher, error) {
+
+	publisher, publishing := s.publishers.Active(keyID)
+
+	if !publishing {
+		return mediaserver.Publisher{}, mediaserver.ErrStreamNotLive
+	}
+
+	if err := s.KickClient(publisher.ClientID); err != nil {
+		return mediaserver.Publisher{}, err
+	}
+
+	log.Printf("Publisher %s (%s) kicked off key %s", publisher.ClientID, publisher.IP, keyID)
+
+	return publisher, nil
+
+}
+
+func (s *Server) Publishers() *mediaserver.PublisherRegistry {
+	return s.publishers
+}
+
+func (s *Server) Events() *events.Bus {
+	return s.bus
+}
+
+func (s *Server) Activity() *events.Activity {
+	return s.activity
+}
+
+func (s *Server) HookConfig() config.HookConfig {
+	return s.Hooks
+}
@@ -0,0 +1,823 @@
+package embedded
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+)
+
+// ingestApp is the app encoders publish to, as with SRS.
+const ingestApp = "live"
+
+const (
+	// mediaStreamID is the one message stream createStream hands out.
+	mediaStreamID = 1
+
+	windowAckSize = 2500000
+
+	// playerQueueSize is how many messages a player may fall behind before
+	// it is disconnected rather than holding up the publisher.
+	playerQueueSize = 2048
+
+	handshakeTimeout = 10 * time.Second
+
+	// idleTimeout is how long a connection may go without sending anything
+	// before it publishes, and a publisher without sending media.
+	idleTimeout = 30 * time.Second
+)
+
+// User control events.
+const (
+	userControlStreamBegin  = 0
+	userControlPingRequest  = 6
+	userControlPingResponse = 7
+)
+
+// countingConn counts the bytes that go through a connection.
+type countingConn struct {
+	net.Conn
+	recv atomic.Uint64
+	sent atomic.Uint64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+
+	n, err := c.Conn.Read(b)
+
+	c.recv.Add(uint64(n))
+
+	return n, err
+
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+
+	n, err := c.Conn.Write(b)
+
+	c.sent.Add(uint64(n))
+
+	return n, err
+
+}
+
+// rateSample is the byte counters of a session when its rate was last
+// asked for.
+type rateSample struct {
+	recv uint64
+	sent uint64
+	at   time.Time
+}
+
+// session is one RTMP connection. It is driven by its own goroutine, which
+// reads messages and answers commands; players get a second goroutine that
+// writes the messages the hub queues for them.
+type session struct {
+	id          string
+	server      *Server
+	conn        *countingConn
+	ip          string
+	connectedAt time.Time
+	reader      *chunkReader
+	writer      *chunkWriter
+	writeLock   sync.Mutex
+	queue       chan *message
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	// Set by the session's own goroutine, read by the server's client
+	// listing under stateLock.
+	app        string
+	stream     string
+	param      string
+	publishing bool
+	playing    bool
+	stateLock  sync.Mutex
+	lastSample rateSample
+
+	ackWindow uint32
+	acked     uint64
+}
+
+func newSession(server *Server, id string, conn net.Conn) *session {
+
+	counted := &countingConn{Conn: conn}
+
+	ip := conn.RemoteAddr().String()
+
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	now := time.Now()
+
+	return &session{
+		id:          id,
+		server:      server,
+		conn:        counted,
+		ip:          ip,
+		connectedAt: now,
+		reader:      newChunkReader(counted),
+		writer:      newChunkWriter(counted),
+		queue:       make(chan *message, playerQueueSize),
+		done:        make(chan struct{}),
+		lastSample:  rateSample{at: now},
+	}
+
+}
+
+func (s *session) run() {
+
+	defer s.cleanup()
+
+	s.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if err := serverHandshake(s.conn); err != nil {
+		log.Printf("RTMP handshake with %s failed: %v", s.ip, err)
+		return
+	}
+
+	s.conn.SetDeadline(time.Time{})
+
+	for {
+
+		s.stateLock.Lock()
+
+		playing := s.playing
+
+		s.stateLock.Unlock()
+
+		// Players only send the odd acknowledgement.
+		if playing {
+			s.conn.SetReadDeadline(time.Time{})
+		} else {
+			s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+
+		msg, err := s.reader.readMessage()
+
+		if err != nil {
+
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("RTMP client %s (%s) disconnected: %v", s.id, s.ip, err)
+			}
+
+			return
+
+		}
+
+		if err := s.handleMessage(msg); err != nil {
+			log.Printf("Closing RTMP client %s (%s): %v", s.id, s.ip, err)
+			return
+		}
+
+		if err := s.acknowledge(); err != nil {
+			return
+		}
+
+	}
+
+}
+
+func (s *session) handleMessage(msg *message) error {
+
+	switch msg.typeID {
+
+	case msgSetChunkSize:
+
+		if len(msg.payload) < 4 {
+			return fmt.Errorf("short set chunk size message")
+		}
+
+		return s.reader.setChunkSize(binary.BigEndian.Uint32(msg.payload) & 0x7FFFFFFF)
+
+	case msgAbort:
+
+		if len(msg.payload) >= 4 {
+			s.reader.abort(binary.BigEndian.Uint32(msg.payload))
+		}
+
+	case msgWindowAckSize:
+
+		if len(msg.payload) >= 4 {
+			s.ackWindow = binary.BigEndian.Uint32(msg.payload)
+		}
+
+	case msgUserControl:
+
+		if len(msg.payload) >= 6 && binary.BigEndian.Uint16(msg.payload) == userControlPingRequest {
+			return s.writeUserControl(userControlPingResponse, binary.BigEndian.Uint32(msg.payload[2:]))
+		}
+
+	case msgCommandAMF0:
+		return s.handleCommand(msg.payload)
+
+	case msgCommandAMF3:
+
+		// An AMF3 command is AMF0 after a format byte.
+		if len(msg.payload) > 0 {
+			return s.handleCommand(msg.payload[1:])
+		}
+
+	case msgDataAMF0, msgDataAMF3:
+
+		if s.publishing {
+
+			payload := msg.payload
+
+			if msg.typeID == msgDataAMF3 && len(payload) > 0 {
+				payload = payload[1:]
+			}
+
+			s.server.hub.broadcast(s.stream, s, &message{
+				typeID:    msgDataAMF0,
+				streamID:  msg.streamID,
+				timestamp: msg.timestamp,
+				payload:   stripSetDataFrame(payload),
+			})
+
+		}
+
+	case msgAudio, msgVideo:
+
+		if s.publishing {
+			s.server.hub.broadcast(s.stream, s, msg)
+		}
+
+	}
+
+	return nil
+
+}
+
+func (s *session) handleCommand(payload []byte) error {
+
+	d := &amf0Decoder{data: payload}
+
+	name, err := d.decode()
+
+	if err != nil {
+		return fmt.Errorf("failed to decode command: %v", err)
+	}
+
+	command, _ := name.(string)
+
+	txn, _ := d.decode()
+
+	transaction, _ := txn.(float64)
+
+	var args []any
+
+	for d.more() {
+
+		value, err := d.decode()
+
+		if err != nil {
+			break
+		}
+
+		args = append(args, value)
+
+	}
+
+	switch command {
+
+	case "connect":
+		return s.connect(transaction, args)
+
+	case "createStream":
+		return s.writeCommand("_result", transaction, nil, mediaStreamID)
+
+	case "publish":
+		return s.publish(args)
+
+	case "play":
+		return s.play(args)
+
+	case "FCUnpublish", "deleteStream", "closeStream":
+		s.stop()
+
+	default:
+
+		// releaseStream, FCPublish and the like only need an answer.
+		if transaction > 0 {
+			return s.writeCommand("_result", transaction, nil, nil)
+		}
+
+	}
+
+	return nil
+
+}
+
+func (s *session) connect(transaction float64, args []any) error {
+
+	properties, _ := argument(args, 0).(map[string]any)
+
+	app, _ := properties["app"].(string)
+
+	app, _, _ = strings.Cut(strings.Trim(app, "/"), "?")
+
+	if app != ingestApp {
+
+		s.writeCommand("_error", transaction, nil, map[string]any{
+			"level":       "error",
+			"code":        "NetConnection.Connect.Rejected",
+			"description": fmt.Sprintf("Unknown app %q.", app),
+		})
+
+		return fmt.Errorf("unknown app %q", app)
+
+	}
+
+	s.stateLock.Lock()
+
+	s.app = app
+
+	s.stateLock.Unlock()
+
+	if err := s.writeControl(msgWindowAckSize, binary.BigEndian.AppendUint32(nil, windowAckSize)); err != nil {
+		return err
+	}
+
+	// Dynamic limit type.
+	if err := s.writeControl(msgSetPeerBandwidth, append(binary.BigEndian.AppendUint32(nil, windowAckSize), 2)); err != nil {
+		return err
+	}
+
+	if err := s.writeControl(msgSetChunkSize, binary.BigEndian.AppendUint32(nil, outChunkSize)); err != nil {
+		return err
+	}
+
+	s.writeLock.Lock()
+
+	s.writer.chunkSize = outChunkSize
+
+	s.writeLock.Unlock()
+
+	s.server.bus.Publish(events.Event{
+		Type:     events.Connect,
+		ClientID: s.id,
+		IP:       s.ip,
+		App:      app,
+	})
+
+	return s.writeCommand("_result", transaction,
+		map[string]any{"fmsVer": "FMS/3,0,1,123", "capabilities": 31},
+		map[string]any{
+			"level":          "status",
+			"code":           "NetConnection.Connect.Success",
+			"description":    "Connection succeeded.",
+			"objectEncoding": 0,
+		},
+	)
+
+}
+
+// publish hands the stream name and param the encoder presented to the
+// ingest handler, which checks the key and decides whether the encoder may
+// take the stream.
+func (s *session) publish(args []any) error {
+
+	if s.app == "" || s.publishing || s.playing {
+		return fmt.Errorf("unexpected publish")
+	}
+
+	stream, param := splitStreamName(argument(args, 1))
+
+	conn := s.connection(stream, param)
+
+	handler := s.server.ingestHandler()
+
+	if handler == nil {
+		s.writeStatus("error", "NetStream.Publish.BadConnection", "Publishing is not available.")
+		return fmt.Errorf("no ingest handler")
+	}
+
+	if _, err := handler.Publish(conn); err != nil {
+		s.writeStatus("error", "NetStream.Publish.BadName", "Publish rejected.")
+		return fmt.Errorf("publish rejected: %v", err)
+	}
+
+	s.stateLock.Lock()
+
+	s.stream = stream
+
+	s.param = param
+
+	s.publishing = true
+
+	s.stateLock.Unlock()
+
+	s.server.hub.publish(stream, s)
+
+	log.Printf("RTMP client %s (%s) is publishing on %s", s.id, s.ip, auth.MaskStreamKey(stream))
+
+	if err := s.writeUserControl(userControlStreamBegin, mediaStreamID); err != nil {
+		return err
+	}
+
+	return s.writeStatus("status", "NetStream.Publish.Start", "Started publishing stream.")
+
+}
+
+// play lets a local client, such as a relay, pull a stream. Viewers are
+// served by the platforms the stream is relayed to, so players are not
+// accepted from elsewhere.
+func (s *session) play(args []any) error {
+
+	if s.app == "" || s.publishing || s.playing {
+		return fmt.Errorf("unexpected play")
+	}
+
+	if ip := net.ParseIP(s.ip); ip == nil || !ip.IsLoopback() {
+		s.writeStatus("error", "NetStream.Play.Failed", "Playback is not allowed.")
+		return fmt.Errorf("play from a non-local address")
+	}
+
+	stream, param := splitStreamName(argument(args, 1))
+
+	if stream == "" {
+		s.writeStatus("error", "NetStream.Play.StreamNotFound", "No stream name.")
+		return fmt.Errorf("play without a stream name")
+	}
+
+	if err := s.writeUserControl(userControlStreamBegin, mediaStreamID); err != nil {
+		return err
+	}
+
+	if err := s.writeStatus("status", "NetStream.Play.Reset", "Playing and resetting stream."); err != nil {
+		return err
+	}
+
+	if err := s.writeStatus("status", "NetStream.Play.Start", "Started playing stream."); err != nil {
+		return err
+	}
+
+	if err := s.write(csidData, &message{
+		typeID:   msgDataAMF0,
+		streamID: mediaStreamID,
+		payload:  encodeAMF0("|RtmpSampleAccess", true, true),
+	}); err != nil {
+		return err
+	}
+
+	s.stateLock.Lock()
+
+	s.stream = stream
+
+	s.param = param
+
+	s.playing = true
+
+	s.stateLock.Unlock()
+
+	go s.writeQueue()
+
+	s.server.hub.play(stream, s)
+
+	s.server.bus.Publish(s.event(events.Play))
+
+	return nil
+
+}
+
+// stop ends whatever the session is publishing or playing.
+func (s *session) stop() {
+
+	s.stateLock.Lock()
+
+	publishing, playing := s.publishing, s.playing
+
+	s.publishing, s.playing = false, false
+
+	s.stateLock.Unlock()
+
+	if publishing {
+
+		s.server.hub.unpublish(s.stream, s)
+
+		if handler := s.server.ingestHandler(); handler != nil {
+			handler.Unpublish(s.connection(s.stream, s.param))
+		}
+
+	}
+
+	if playing {
+
+		s.server.hub.stop(s.stream, s)
+
+		s.server.bus.Publish(s.event(events.Stop))
+
+	}
+
+}
+
+func (s *session) cleanup() {
+
+	s.stop()
+
+	s.close()
+
+	s.server.removeSession(s)
+
+	if s.app != "" {
+		s.server.bus.Publish(events.Event{
+			Type:     events.Close,
+			ClientID: s.id,
+			IP:       s.ip,
+			App:      s.app,
+		})
+	}
+
+}
+
+func (s *session) close() {
+
+	s.closeOnce.Do(func() {
+
+		close(s.done)
+
+		s.conn.Close()
+
+	})
+
+}
+
+// send queues a message for a player without blocking. A player that
+// cannot keep up is disconnected.
+func (s *session) send(msg *message) {
+
+	select {
+
+	case <-s.done:
+		return
+
+	default:
+
+	}
+
+	select {
+
+	case s.queue <- msg:
+
+	default:
+		log.Printf("RTMP player %s (%s) is too slow, disconnecting it", s.id, s.ip)
+		s.close()
+
+	}
+
+}
+
+// writeQueue writes what the hub queues for a player, flushing whenever
+// it catches up.
+func (s *session) writeQueue() {
+
+	for {
+
+		select {
+
+		case <-s.done:
+			return
+
+		case msg := <-s.queue:
+
+			s.writeLock.Lock()
+
+			err := s.writeQueued(msg)
+
+			for err == nil && len(s.queue) > 0 {
+				err = s.writeQueued(<-s.queue)
+			}
+
+			if err == nil {
+				err = s.writer.flush()
+			}
+
+			s.writeLock.Unlock()
+
+			if err != nil {
+				s.close()
+				return
+			}
+
+		}
+
+	}
+
+}
+
+// writeQueued writes a message from the publisher on the player's own
+// message stream. The caller holds writeLock.
+func (s *session) writeQueued(msg *message) error {
+
+	out := *msg
+
+	out.streamID = mediaStreamID
+
+	return s.writer.writeMessage(chunkStreamFor(msg.typeID), &out)
+
+}
+
+func (s *session) write(csid uint8, msg *message) error {
+
+	s.writeLock.Lock()
+
+	defer s.writeLock.Unlock()
+
+	if err := s.writer.writeMessage(csid, msg); err != nil {
+		return err
+	}
+
+	return s.writer.flush()
+
+}
+
+func (s *session) writeControl(typeID uint8, payload []byte) error {
+
+	return s.write(csidControl, &message{typeID: typeID, payload: payload})
+
+}
+
+func (s *session) writeUserControl(event uint16, value uint32) error {
+
+	payload := binary.BigEndian.AppendUint16(nil, event)
+
+	return s.writeControl(msgUserControl, binary.BigEndian.AppendUint32(payload, value))
+
+}
+
+func (s *session) writeCommand(name string, transaction float64, values ...any) error {
+
+	return s.write(csidCommand, &message{
+		typeID:  msgCommandAMF0,
+		payload: encodeAMF0(append([]any{name, transaction}, values...)...),
+	})
+
+}
+
+func (s *session) writeStatus(level, code, description string) error {
+
+	return s.write(csidCommand, statusMessage(level, code, description))
+
+}
+
+// acknowledge tells the peer how much has been received once it has sent
+// a window's worth since the last acknowledgement.
+func (s *session) acknowledge() error {
+
+	received := s.conn.recv.Load()
+
+	if s.ackWindow == 0 || received-s.acked < uint64(s.ackWindow) {
+		return nil
+	}
+
+	s.acked = received
+
+	return s.writeControl(msgAcknowledgement, binary.BigEndian.AppendUint32(nil, uint32(received)))
+
+}
+
+func (s *session) connection(stream, param string) mediaserver.Connection {
+
+	return mediaserver.Connection{
+		ClientID: s.id,
+		IP:       s.ip,
+		Protocol: mediaserver.ProtocolRTMP,
+		App:      s.app,
+		Stream:   stream,
+		Param:    param,
+	}
+
+}
+
+func (s *session) event(eventType events.Type) events.Event {
+
+	keyID, _ := s.server.publishers.StreamKeyID(s.stream)
+
+	return events.Event{
+		Type:     eventType,
+		ClientID: s.id,
+		IP:       s.ip,
+		App:      s.app,
+		KeyID:    keyID,
+		Relay:    mediaserver.IsRelayParam(s.param),
+	}
+
+}
+
+// rates is the session's receive and send rate in kbps since it was last
+// asked for, or since it connected the first time.
+func (s *session) rates(now time.Time) (int, int) {
+
+	s.stateLock.Lock()
+
+	defer s.stateLock.Unlock()
+
+	sample := rateSample{recv: s.conn.recv.Load(), sent: s.conn.sent.Load(), at: now}
+
+	previous := s.lastSample
+
+	elapsed := now.Sub(previous.at).Seconds()
+
+	if elapsed < 1 {
+		previous = rateSample{at: s.connectedAt}
+		elapsed = now.Sub(s.connectedAt).Seconds()
+	} else {
+		s.lastSample = sample
+	}
+
+	if elapsed <= 0 {
+		return 0, 0
+	}
+
+	kbps := func(bytes uint64) int {
+		return int(float64(bytes) * 8 / 1000 / elapsed)
+	}
+
+	return kbps(sample.recv - previous.recv), kbps(sample.sent - previous.sent)
+
+}
+
+func statusMessage(level, code, description string) *message {
+
+	return &message{
+		typeID:   msgCommandAMF0,
+		streamID: mediaStreamID,
+		payload: encodeAMF0("onStatus", 0, nil, map[string]any{
+			"level":       level,
+			"code":        code,
+			"description": description,
+		}),
+	}
+
+}
+
+func chunkStreamFor(typeID uint8) uint8 {
+
+	switch typeID {
+
+	case msgAudio:
+		return csidAudio
+
+	case msgVideo:
+		return csidVideo
+
+	case msgCommandAMF0, msgCommandAMF3:
+		return csidCommand
+
+	}
+
+	return csidData
+
+}
+
+// stripSetDataFrame removes the "@setDataFrame" an encoder puts before
+// onMetaData, which players do not expect.
+func stripSetDataFrame(payload []byte) []byte {
+
+	d := &amf0Decoder{data: payload}
+
+	if name, err := d.decode(); err == nil && name == "@setDataFrame" {
+		return d.rest()
+	}
+
+	return payload
+
+}
+
+// splitStreamName separates the query string encoders append to the stream
+// name, as in "key?uid=...&token=...".
+func splitStreamName(value any) (string, string) {
+
+	name, _ := value.(string)
+
+	stream, param, found := strings.Cut(name, "?")
+
+	if found {
+		param = "?" + param
+	}
+
+	return stream, param
+
+}
+
+func argument(args []any, i int) any {
+
+	if i < len(args) {
+		return args[i]
+	}
+
+	return nil
+
+}
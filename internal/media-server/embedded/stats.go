@@ -0,0 +1,138 @@
+package embedded
+
+import (
+	"context"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// IngestStats describes what the encoder publishing on a stream key is
+// sending, from what the server has seen of its media.
+func (s *Server) IngestStats(ctx context.Context, keyID string) (types.IngestStats, error) {
+
+	publisher, publishing := s.publishers.Active(keyID)
+
+	if !publishing {
+		return types.IngestStats{}, mediaserver.ErrStreamNotLive
+	}
+
+	info, session, players, live := s.hub.info(publisher.Stream)
+
+	if !live {
+		return types.IngestStats{}, mediaserver.ErrStreamNotLive
+	}
+
+	now := time.Now()
+
+	recvKbps, sendKbps := session.rates(now)
+
+	stats := types.IngestStats{
+		StreamID:  keyID,
+		ClientID:  publisher.ClientID,
+		IP:        publisher.IP,
+		Protocol:  publisher.Protocol,
+		LiveSince: publisher.StartedAt,
+		RecvKbps:  recvKbps,
+		SendKbps:  sendKbps,
+		Clients:   players + 1,
+		Players:   players,
+		SampledAt: now,
+	}
+
+	if info.videoCodec != "" {
+
+		frameRate := info.frameRate
+
+		// Fall back to the average when the encoder did not announce one.
+		if liveFor := now.Sub(info.publishedAt).Seconds(); frameRate == 0 && liveFor > 0 {
+			frameRate = float64(int(float64(info.frames)/liveFor*100+0.5)) / 100
+		}
+
+		stats.Video = &types.IngestVideoStats{
+			Codec:     info.videoCodec,
+			Profile:   info.profile,
+			Level:     info.level,
+			Width:     info.width,
+			Height:    info.height,
+			FrameRate: frameRate,
+		}
+
+	}
+
+	if info.audioCodec != "" {
+		stats.Audio = &types.IngestAudioStats{
+			Codec:      info.audioCodec,
+			Profile:    info.audioProf,
+			SampleRate: info.sampleRate,
+			Channels:   info.channels,
+		}
+	}
+
+	return stats, nil
+
+}
+
+// Clients lists the open connections, limited to one stream key when
+// keyID is set.
+func (s *Server) Clients(ctx context.Context, keyID string) ([]types.StreamClient, error) {
+
+	s.lock.Lock()
+
+	sessions := make([]*session, 0, len(s.sessions))
+
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+
+	s.lock.Unlock()
+
+	now := time.Now()
+
+	result := []types.StreamClient{}
+
+	for _, session := range sessions {
+
+		session.stateLock.Lock()
+
+		stream, publishing, playing := session.stream, session.publishing, session.playing
+
+		session.stateLock.Unlock()
+
+		var id string
+
+		if stream != "" {
+			id, _ = s.publishers.StreamKeyID(stream)
+		}
+
+		if keyID != "" && id != keyID {
+			continue
+		}
+
+		clientType := "rtmp"
+
+		if publishing {
+			clientType = "rtmp-publish"
+		} else if playing {
+			clientType = "rtmp-play"
+		}
+
+		recvKbps, sendKbps := session.rates(now)
+
+		result = append(result, types.StreamClient{
+			ClientID:  session.id,
+			StreamID:  id,
+			IP:        session.ip,
+			Type:      clientType,
+			Publisher: publishing,
+			Alive:     now.Sub(session.connectedAt).Seconds(),
+			RecvKbps:  recvKbps,
+			SendKbps:  sendKbps,
+		})
+
+	}
+
+	return result, nil
+
+}
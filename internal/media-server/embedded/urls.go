@@ -0,0 +1,139 @@
+package embedded
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// publicConfig drops the protocols the embedded server does not serve.
+// RTMPS is expected to be terminated in front of it.
+func publicConfig(cfg config.PublicConfig) (config.PublicConfig, error) {
+
+	if cfg.Host == "" {
+		return cfg, fmt.Errorf("public host cannot be empty")
+	}
+
+	ingest := []string{}
+
+	for _, protocol := range cfg.IngestProtocols {
+
+		switch protocol {
+
+		case mediaserver.ProtocolRTMP, mediaserver.ProtocolRTMPS:
+			ingest = append(ingest, protocol)
+
+		case mediaserver.ProtocolSRT, mediaserver.ProtocolWHIP:
+			log.Printf("Warning: The embedded media server does not support %s ingest, leaving it out", protocol)
+
+		default:
+			return cfg, fmt.Errorf("unknown ingest protocol %q", protocol)
+
+		}
+
+	}
+
+	if len(cfg.PlaybackProtocols) > 0 {
+		log.Println("Warning: The embedded media server does not serve playback, ignoring PLAYBACK_PROTOCOLS")
+	}
+
+	cfg.IngestProtocols = ingest
+
+	cfg.PlaybackProtocols = nil
+
+	return cfg, nil
+
+}
+
+// GetIngestURL is the loopback RTMP URL the relays pull a stream name from.
+func (s *Server) GetIngestURL(stream string) string {
+
+	if stream == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("rtmp://%s/%s/%s", net.JoinHostPort("127.0.0.1", s.portNumber()), ingestApp, stream)
+
+}
+
+// PublicRTMPURL is the RTMP URL encoders publish a stream name to.
+func (s *Server) PublicRTMPURL(stream string) string {
+
+	return s.rtmpServerURL() + "/" + stream
+
+}
+
+// IngestEndpoints lists the enabled ways to publish on a stream key. The
+// full URLs are only filled in when the plaintext key is given.
+func (s *Server) IngestEndpoints(streamKey string) []types.IngestEndpoint {
+
+	endpoints := []types.IngestEndpoint{}
+
+	for _, protocol := range s.Public.IngestProtocols {
+
+		endpoint := types.IngestEndpoint{Protocol: protocol}
+
+		switch protocol {
+
+		case mediaserver.ProtocolRTMP:
+			endpoint.Server = s.rtmpServerURL()
+
+		case mediaserver.ProtocolRTMPS:
+			endpoint.Server = fmt.Sprintf("rtmps://%s/%s", net.JoinHostPort(s.Public.Host, strconv.Itoa(s.Public.RTMPSPort)), ingestApp)
+
+		}
+
+		if streamKey != "" {
+			endpoint.URL = endpoint.Server + "/" + streamKey
+		}
+
+		endpoints = append(endpoints, endpoint)
+
+	}
+
+	return endpoints
+
+}
+
+// PlaybackURLs is always empty: viewers watch on the platforms the stream
+// is relayed to.
+func (s *Server) PlaybackURLs(keyID string) []types.PlaybackURL {
+
+	return []types.PlaybackURL{}
+
+}
+
+// GetHLSURL is always empty, there being no HLS output.
+func (s *Server) GetHLSURL(file string) string {
+
+	return ""
+
+}
+
+func (s *Server) rtmpServerURL() string {
+
+	port := strconv.Itoa(s.Public.RTMPPort)
+
+	if s.Public.RTMPPort == 0 {
+		port = s.portNumber()
+	}
+
+	return fmt.Sprintf("rtmp://%s/%s", net.JoinHostPort(s.Public.Host, port), ingestApp)
+
+}
+
+// portNumber is the port of the listen address, such as "1935" for ":1935".
+func (s *Server) portNumber() string {
+
+	if _, port, err := net.SplitHostPort(s.Port); err == nil {
+		return port
+	}
+
+	return s.Port
+
+}
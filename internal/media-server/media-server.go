@@ -0,0 +1,127 @@
+// Package mediaserver is what the API and the stream services need from
+// the media server that encoders publish to. SRS is one implementation
+// (package rtmpserver); another backend only has to implement MediaServer
+// and feed the publisher registry and event bus from its own callbacks.
+package mediaserver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/events"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+var (
+	ErrStreamNotLive         = errors.New("stream is not live")
+	ErrClientNotFound        = errors.New("client not found")
+	ErrWebRTCSessionNotFound = errors.New("WebRTC session not found")
+)
+
+// Ingest and playback protocols a media server may offer.
+const (
+	ProtocolRTMP  = "rtmp"
+	ProtocolRTMPS = "rtmps"
+	ProtocolSRT   = "srt"
+	ProtocolWHIP  = "whip"
+	ProtocolHLS   = "hls"
+)
+
+type StreamDestination struct {
+	URL       string
+	StreamKey string
+}
+
+type Stream struct {
+	ID           string
+	Destinations []StreamDestination
+}
+
+type Health struct {
+	Backend   string    `json:"backend"`
+	Version   string    `json:"version,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// MediaServer is a media server that encoders publish to and the relays
+// pull from. Streams are identified by the ID of the stream key they are
+// published on; the stream name an encoder used is known from the
+// publisher registry.
+type MediaServer interface {
+	Start() error
+	Stop() error
+	Reload() error
+	Health(ctx context.Context) Health
+
+	AddStream(id string, destinations []StreamDestination) error
+	GetStream(id string) (*Stream, bool)
+	RemoveStream(id string) error
+
+	IngestStats(ctx context.Context, keyID string) (types.IngestStats, error)
+	Clients(ctx context.Context, keyID string) ([]types.StreamClient, error)
+	KickClient(clientID string) error
+	KickPublisher(keyID string) (Publisher, error)
+
+	// GetIngestURL is where the relays pull a stream name from.
+	GetIngestURL(stream string) string
+	PublicRTMPURL(stream string) string
+	IngestEndpoints(streamKey string) []types.IngestEndpoint
+	// PlaybackURLs are where viewers watch a stream key, by its ID, and
+	// GetHLSURL where a file of the HLS output of a stream name is fetched
+	// from to serve them.
+	PlaybackURLs(keyID string) []types.PlaybackURL
+	GetHLSURL(file string) string
+
+	Publishers() *PublisherRegistry
+	Events() *events.Bus
+	Activity() *events.Activity
+	HookConfig() config.HookConfig
+}
+
+// Connection is a client of the media server: where it connected from,
+// the protocol it came in on and the app, stream name and query string it
+// asked for.
+type Connection struct {
+	ClientID string
+	IP       string
+	Protocol string
+	App      string
+	Stream   string
+	Param    string
+}
+
+// IngestHandler authorizes and records publishes for backends that accept
+// encoders themselves rather than reporting them through the HTTP hooks.
+// Publish returns the ID of the stream key the encoder may publish on, or
+// an error if it must be turned away.
+type IngestHandler interface {
+	Publish(conn Connection) (string, error)
+	Unpublish(conn Connection)
+}
+
+// IngestHandlerSetter is implemented by media servers that report to an
+// IngestHandler directly.
+type IngestHandlerSetter interface {
+	SetIngestHandler(handler IngestHandler)
+}
+
+// WebRTCSession is a WebRTC peer connection set up with the media server
+// from an SDP offer. Stream is the stream name it publishes or plays.
+type WebRTCSession struct {
+	ID     string
+	Stream string
+	Answer string
+}
+
+// WebRTCServer is implemented by media servers that take WebRTC publishes
+// (WHIP) and play streams out over WebRTC (WHEP). A publish is authorized
+// like any other, through the ingest path, before the answer comes back.
+type WebRTCServer interface {
+	PublishWebRTC(ctx context.Context, stream, offer string) (WebRTCSession, error)
+	PlayWebRTC(ctx context.Context, stream, offer string) (WebRTCSession, error)
+	CloseWebRTC(ctx context.Context, id, stream string) error
+}
@@ -0,0 +1,300 @@
+package mediaserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PublisherPolicy string
+
+const (
+	PublisherPolicyReject PublisherPolicy = "reject"
+	PublisherPolicyKick   PublisherPolicy = "kick"
+)
+
+// RelayParam marks the relays' own connections to the ingest, so that
+// they are not counted as viewers.
+const RelayParam = "relay"
+
+// IsRelayParam reports whether a connection's query string marks it as one
+// of the relays.
+func IsRelayParam(param string) bool {
+
+	values, err := url.ParseQuery(strings.TrimPrefix(param, "?"))
+
+	return err == nil && values.Has(RelayParam)
+
+}
+
+// maxPublisherDecisions bounds how many publish decisions are kept for the API.
+const maxPublisherDecisions = 100
+
+type Publisher struct {
+	KeyID     string    `json:"keyID"`
+	UserID    string    `json:"userID"`
+	Stream    string    `json:"-"`
+	ClientID  string    `json:"clientID"`
+	IP        string    `json:"ip"`
+	Protocol  string    `json:"protocol,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+type PublisherDecision struct {
+	Time     time.Time       `json:"time"`
+	KeyID    string          `json:"keyID"`
+	UserID   string          `json:"userID"`
+	ClientID string          `json:"clientID"`
+	IP       string          `json:"ip"`
+	Policy   PublisherPolicy `json:"policy"`
+	Action   string          `json:"action"`
+	Previous string          `json:"previousClientID,omitempty"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// PublisherRegistry tracks the one client allowed to publish on each
+// stream key, keyed by the key's ID so that a key published both directly
+// and through a signed URL still counts as a single stream.
+type PublisherRegistry struct {
+	policy     PublisherPolicy
+	active     map[string]Publisher
+	byClient   map[string]string
+	decisions  []PublisherDecision
+	activeLock sync.Mutex
+}
+
+func NewPublisherRegistry(policy string) (*PublisherRegistry, error) {
+
+	switch PublisherPolicy(policy) {
+
+	case PublisherPolicyReject, PublisherPolicyKick:
+
+	default:
+		return nil, fmt.Errorf("unknown publisher policy %q, expected \"reject\" or \"kick\"", policy)
+
+	}
+
+	return &PublisherRegistry{
+		policy:   PublisherPolicy(policy),
+		active:   make(map[string]Publisher),
+		byClient: make(map[string]string),
+	}, nil
+
+}
+
+func (pr *PublisherRegistry) Policy() PublisherPolicy {
+	return pr.policy
+}
+
+// Claim tries to make publisher the active publisher for its key. If another
+// client already holds the key, the policy decides: under reject the claim
+// fails, under kick the claim succeeds and the displaced publisher is
+// returned so the caller can disconnect it.
+func (pr *PublisherRegistry) Claim(publisher Publisher) (displaced *Publisher, accepted bool) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	current, exists := pr.active[publisher.KeyID]
+
+	// The media server may retry its publish hook for the same connection.
+	if exists && current.ClientID == publisher.ClientID {
+		return nil, true
+	}
+
+	if exists && pr.policy == PublisherPolicyReject {
+
+		pr.record(publisher, "rejected", current.ClientID, "stream key is already being published")
+
+		return nil, false
+
+	}
+
+	if exists {
+
+		delete(pr.byClient, current.ClientID)
+
+		displaced = &current
+
+		pr.record(publisher, "kicked", current.ClientID, "replaced the active publisher")
+
+	} else {
+
+		pr.record(publisher, "accepted", "", "")
+
+	}
+
+	pr.active[publisher.KeyID] = publisher
+
+	pr.byClient[publisher.ClientID] = publisher.KeyID
+
+	return displaced, true
+
+}
+
+// Release clears the client's claim when it stops publishing. Clients that
+// were already displaced hold no claim, so their unpublish is a no-op.
+func (pr *PublisherRegistry) Release(clientID string) (Publisher, bool) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	keyID, exists := pr.byClient[clientID]
+
+	if !exists {
+		return Publisher{}, false
+	}
+
+	publisher := pr.active[keyID]
+
+	delete(pr.byClient, clientID)
+
+	delete(pr.active, keyID)
+
+	return publisher, true
+
+}
+
+// ReleaseStalePublisher clears the claim on a key when the client holding
+// it is no longer connected to the media server, as happens when its
+// unpublish hook was lost. It reports the publisher whose claim was
+// cleared. If the media server cannot be asked, the claim is kept.
+func ReleaseStalePublisher(ctx context.Context, mediaServer MediaServer, keyID string) (Publisher, bool) {
+
+	publishers := mediaServer.Publishers()
+
+	publisher, exists := publishers.Active(keyID)
+
+	if !exists {
+		return Publisher{}, false
+	}
+
+	clients, err := mediaServer.Clients(ctx, "")
+
+	if err != nil {
+		log.Printf("Failed to check whether client %s still publishes on key %s: %v", publisher.ClientID, keyID, err)
+		return Publisher{}, false
+	}
+
+	for _, client := range clients {
+
+		if client.ClientID == publisher.ClientID {
+			return Publisher{}, false
+		}
+
+	}
+
+	if _, released := publishers.Release(publisher.ClientID); !released {
+		return Publisher{}, false
+	}
+
+	log.Printf("Released stale claim of client %s on key %s, it is no longer connected", publisher.ClientID, keyID)
+
+	return publisher, true
+
+}
+
+// Client returns the claim a client holds, if any.
+func (pr *PublisherRegistry) Client(clientID string) (Publisher, bool) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	keyID, exists := pr.byClient[clientID]
+
+	if !exists {
+		return Publisher{}, false
+	}
+
+	return pr.active[keyID], true
+
+}
+
+func (pr *PublisherRegistry) Active(keyID string) (Publisher, bool) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	publisher, exists := pr.active[keyID]
+
+	return publisher, exists
+
+}
+
+// StreamKeyID returns the key ID of the active publisher on a stream name.
+func (pr *PublisherRegistry) StreamKeyID(stream string) (string, bool) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	for keyID, publisher := range pr.active {
+		if publisher.Stream == stream {
+			return keyID, true
+		}
+	}
+
+	return "", false
+
+}
+
+// List returns the active publishers and recent decisions, optionally
+// limited to one user's keys.
+func (pr *PublisherRegistry) List(userID string) ([]Publisher, []PublisherDecision) {
+
+	pr.activeLock.Lock()
+
+	defer pr.activeLock.Unlock()
+
+	publishers := []Publisher{}
+
+	for _, publisher := range pr.active {
+		if userID == "" || publisher.UserID == userID {
+			publishers = append(publishers, publisher)
+		}
+	}
+
+	sort.Slice(publishers, func(i, j int) bool {
+		return publishers[i].StartedAt.Before(publishers[j].StartedAt)
+	})
+
+	decisions := []PublisherDecision{}
+
+	for _, decision := range pr.decisions {
+		if userID == "" || decision.UserID == userID {
+			decisions = append(decisions, decision)
+		}
+	}
+
+	return publishers, decisions
+
+}
+
+func (pr *PublisherRegistry) record(publisher Publisher, action, previous, reason string) {
+
+	pr.decisions = append(pr.decisions, PublisherDecision{
+		Time:     time.Now(),
+		KeyID:    publisher.KeyID,
+		UserID:   publisher.UserID,
+		ClientID: publisher.ClientID,
+		IP:       publisher.IP,
+		Policy:   pr.policy,
+		Action:   action,
+		Previous: previous,
+		Reason:   reason,
+	})
+
+	if len(pr.decisions) > maxPublisherDecisions {
+		pr.decisions = pr.decisions[len(pr.decisions)-maxPublisherDecisions:]
+	}
+
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	streamKeysBucket       = []byte("stream_keys")
+	streamKeysByUserBucket = []byte("stream_keys_by_user")
+)
+
+// BoltKeyStore keeps stream keys in a single BoltDB file so they survive
+// restarts. Records are stored as JSON keyed by the key hash, with a
+// nested bucket per user indexing that user's keys.
+type BoltKeyStore struct {
+	db *bolt.DB
+}
+
+func NewBoltKeyStore(path string) (*BoltKeyStore, error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create stream key store directory: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream key store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+
+		for _, bucket := range [][]byte{streamKeysBucket, streamKeysByUserBucket} {
+
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+
+		}
+
+		return nil
+
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize stream key store: %v", err)
+	}
+
+	return &BoltKeyStore{db: db}, nil
+
+}
+
+func (bs *BoltKeyStore) Get(hash string) (StreamKeyRecord, bool, error) {
+
+	var record StreamKeyRecord
+
+	var exists bool
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+
+		data := tx.Bucket(streamKeysBucket).Get([]byte(hash))
+
+		if data == nil {
+			return nil
+		}
+
+		exists = true
+
+		return json.Unmarshal(data, &record)
+
+	})
+
+	if err != nil {
+		return StreamKeyRecord{}, false, fmt.Errorf("failed to read stream key: %v", err)
+	}
+
+	return record, exists, nil
+
+}
+
+func (bs *BoltKeyStore) Put(record StreamKeyRecord) error {
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return fmt.Errorf("failed to encode stream key: %v", err)
+	}
+
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+
+		if err := tx.Bucket(streamKeysBucket).Put([]byte(record.Hash), data); err != nil {
+			return err
+		}
+
+		userKeys, err := tx.Bucket(streamKeysByUserBucket).CreateBucketIfNotExists([]byte(record.UserID))
+
+		if err != nil {
+			return err
+		}
+
+		return userKeys.Put([]byte(record.Hash), nil)
+
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to write stream key: %v", err)
+	}
+
+	return nil
+
+}
+
+func (bs *BoltKeyStore) Delete(hash string) error {
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+
+		keys := tx.Bucket(streamKeysBucket)
+
+		data := keys.Get([]byte(hash))
+
+		if data == nil {
+			return nil
+		}
+
+		var record StreamKeyRecord
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+
+		if userKeys := tx.Bucket(streamKeysByUserBucket).Bucket([]byte(record.UserID)); userKeys != nil {
+
+			if err := userKeys.Delete([]byte(hash)); err != nil {
+				return err
+			}
+
+		}
+
+		return keys.Delete([]byte(hash))
+
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete stream key: %v", err)
+	}
+
+	return nil
+
+}
+
+func (bs *BoltKeyStore) List() ([]StreamKeyRecord, error) {
+
+	var records []StreamKeyRecord
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+
+		return tx.Bucket(streamKeysBucket).ForEach(func(_, data []byte) error {
+
+			var record StreamKeyRecord
+
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+
+			return nil
+
+		})
+
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stream keys: %v", err)
+	}
+
+	return records, nil
+
+}
+
+func (bs *BoltKeyStore) ListByUser(userID string) ([]StreamKeyRecord, error) {
+
+	var records []StreamKeyRecord
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+
+		userKeys := tx.Bucket(streamKeysByUserBucket).Bucket([]byte(userID))
+
+		if userKeys == nil {
+			return nil
+		}
+
+		keys := tx.Bucket(streamKeysBucket)
+
+		return userKeys.ForEach(func(hash, _ []byte) error {
+
+			data := keys.Get(hash)
+
+			if data == nil {
+				return nil
+			}
+
+			var record StreamKeyRecord
+
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+
+			return nil
+
+		})
+
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stream keys for user: %v", err)
+	}
+
+	return records, nil
+
+}
+
+// KeyStoreDB returns the BoltDB file the stream keys are kept in, so other
+// state can be kept alongside them, or nil if the keys are not in BoltDB.
+func KeyStoreDB() *bolt.DB {
+
+	backend := getStore()
+
+	if cached, ok := backend.(*CachedKeyStore); ok {
+		backend = cached.backend
+	}
+
+	if boltStore, ok := backend.(*BoltKeyStore); ok {
+		return boltStore.db
+	}
+
+	return nil
+
+}
+
+func (bs *BoltKeyStore) Close() error {
+
+	return bs.db.Close()
+
+}
+
+// MigratePlaintextKeys rewrites records written before keys were hashed,
+// which were stored under the plaintext key, so they are kept under their
+// hash instead. It returns the number of records migrated.
+func (bs *BoltKeyStore) MigratePlaintextKeys(hash func(string) string) (int, error) {
+
+	migrated := 0
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+
+		keys := tx.Bucket(streamKeysBucket)
+
+		byUser := tx.Bucket(streamKeysByUserBucket)
+
+		var legacy []string
+
+		err := keys.ForEach(func(key, data []byte) error {
+
+			var record struct {
+				Key  string `json:"key"`
+				Hash string `json:"hash"`
+			}
+
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			if record.Hash == "" && record.Key != "" {
+				legacy = append(legacy, string(key))
+			}
+
+			return nil
+
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, key := range legacy {
+
+			var record StreamKeyRecord
+
+			if err := json.Unmarshal(keys.Get([]byte(key)), &record); err != nil {
+				return err
+			}
+
+			record.Hash = hash(key)
+
+			record.Prefix = KeyPrefix(key)
+
+			data, err := json.Marshal(record)
+
+			if err != nil {
+				return err
+			}
+
+			if err := keys.Delete([]byte(key)); err != nil {
+				return err
+			}
+
+			if err := keys.Put([]byte(record.Hash), data); err != nil {
+				return err
+			}
+
+			userKeys, err := byUser.CreateBucketIfNotExists([]byte(record.UserID))
+
+			if err != nil {
+				return err
+			}
+
+			if err := userKeys.Delete([]byte(key)); err != nil {
+				return err
+			}
+
+			if err := userKeys.Put([]byte(record.Hash), nil); err != nil {
+				return err
+			}
+
+			migrated++
+
+		}
+
+		return nil
+
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate plaintext stream keys: %v", err)
+	}
+
+	return migrated, nil
+
+}
@@ -0,0 +1,172 @@
+package auth
+
+import "sync"
+
+const (
+	defaultKeyCacheSize  = 10000
+	defaultMissCacheSize = 1000
+)
+
+// CachedKeyStore fronts another KeyStore with an in-memory read cache so
+// the on_publish path does not hit disk. Misses are cached as well, which
+// is safe as long as every write goes through the cache. They are kept
+// apart from the keys and bounded separately, so spraying random keys only
+// churns the misses.
+type CachedKeyStore struct {
+	backend    KeyStore
+	records    map[string]StreamKeyRecord
+	misses     map[string]struct{}
+	cacheLock  sync.RWMutex
+	maxEntries int
+	maxMisses  int
+
+	// version counts writes, so a backend read that raced one is not
+	// cached over what the write stored.
+	version uint64
+}
+
+func NewCachedKeyStore(backend KeyStore) *CachedKeyStore {
+
+	return &CachedKeyStore{
+		backend:    backend,
+		records:    make(map[string]StreamKeyRecord),
+		misses:     make(map[string]struct{}),
+		maxEntries: defaultKeyCacheSize,
+		maxMisses:  defaultMissCacheSize,
+	}
+
+}
+
+func (cs *CachedKeyStore) Get(hash string) (StreamKeyRecord, bool, error) {
+
+	cs.cacheLock.RLock()
+
+	record, hit := cs.records[hash]
+
+	_, missed := cs.misses[hash]
+
+	version := cs.version
+
+	cs.cacheLock.RUnlock()
+
+	if hit {
+		return record, true, nil
+	}
+
+	if missed {
+		return StreamKeyRecord{}, false, nil
+	}
+
+	record, exists, err := cs.backend.Get(hash)
+
+	if err != nil {
+		return StreamKeyRecord{}, false, err
+	}
+
+	cs.cacheLock.Lock()
+
+	defer cs.cacheLock.Unlock()
+
+	if cs.version == version {
+		cs.store(hash, record, exists)
+	}
+
+	return record, exists, nil
+
+}
+
+func (cs *CachedKeyStore) Put(record StreamKeyRecord) error {
+
+	err := cs.backend.Put(record)
+
+	cs.cacheLock.Lock()
+
+	defer cs.cacheLock.Unlock()
+
+	cs.version++
+
+	if err != nil {
+		cs.invalidate(record.Hash)
+		return err
+	}
+
+	cs.store(record.Hash, record, true)
+
+	return nil
+
+}
+
+func (cs *CachedKeyStore) Delete(hash string) error {
+
+	err := cs.backend.Delete(hash)
+
+	cs.cacheLock.Lock()
+
+	defer cs.cacheLock.Unlock()
+
+	cs.version++
+
+	if err != nil {
+		cs.invalidate(hash)
+		return err
+	}
+
+	cs.store(hash, StreamKeyRecord{}, false)
+
+	return nil
+
+}
+
+func (cs *CachedKeyStore) List() ([]StreamKeyRecord, error) {
+
+	return cs.backend.List()
+
+}
+
+func (cs *CachedKeyStore) ListByUser(userID string) ([]StreamKeyRecord, error) {
+
+	return cs.backend.ListByUser(userID)
+
+}
+
+func (cs *CachedKeyStore) Close() error {
+
+	return cs.backend.Close()
+
+}
+
+// store caches a record or a miss. The caller holds cacheLock.
+func (cs *CachedKeyStore) store(hash string, record StreamKeyRecord, exists bool) {
+
+	if !exists {
+
+		delete(cs.records, hash)
+
+		if len(cs.misses) >= cs.maxMisses {
+			cs.misses = make(map[string]struct{})
+		}
+
+		cs.misses[hash] = struct{}{}
+
+		return
+
+	}
+
+	delete(cs.misses, hash)
+
+	if len(cs.records) >= cs.maxEntries {
+		cs.records = make(map[string]StreamKeyRecord)
+	}
+
+	cs.records[hash] = record
+
+}
+
+// invalidate drops whatever is cached for hash. The caller holds cacheLock.
+func (cs *CachedKeyStore) invalidate(hash string) {
+
+	delete(cs.records, hash)
+
+	delete(cs.misses, hash)
+
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+)
+
+// racingKeyStore runs a write between its backend read and the return of
+// the first Get, as a concurrent Put would.
+type racingKeyStore struct {
+	*MemoryKeyStore
+	during func()
+}
+
+func (rs *racingKeyStore) Get(hash string) (StreamKeyRecord, bool, error) {
+
+	record, exists, err := rs.MemoryKeyStore.Get(hash)
+
+	if during := rs.during; during != nil {
+		rs.during = nil
+		during()
+	}
+
+	return record, exists, err
+
+}
+
+func TestCachedKeyStoreMissRacingPut(t *testing.T) {
+
+	backend := &racingKeyStore{MemoryKeyStore: NewMemoryKeyStore()}
+
+	cs := NewCachedKeyStore(backend)
+
+	record := StreamKeyRecord{ID: "key", Hash: "hash", UserID: "user"}
+
+	backend.during = func() {
+
+		if err := cs.Put(record); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+	}
+
+	if _, exists, _ := cs.Get(record.Hash); exists {
+		t.Fatalf("the read before the Put found the key")
+	}
+
+	if _, exists, _ := cs.Get(record.Hash); !exists {
+		t.Fatalf("the key was cached as missing after it was stored")
+	}
+
+}
+
+func TestCachedKeyStore(t *testing.T) {
+
+	cs := NewCachedKeyStore(NewMemoryKeyStore())
+
+	record := StreamKeyRecord{ID: "key", Hash: "hash", UserID: "user"}
+
+	steps := []struct {
+		name   string
+		write  func() error
+		exists bool
+	}{
+		{name: "before put", exists: false},
+		{name: "after put", write: func() error { return cs.Put(record) }, exists: true},
+		{name: "after delete", write: func() error { return cs.Delete(record.Hash) }, exists: false},
+		{name: "after put again", write: func() error { return cs.Put(record) }, exists: true},
+	}
+
+	for _, step := range steps {
+
+		if step.write != nil {
+
+			if err := step.write(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+
+		}
+
+		if _, exists, err := cs.Get(record.Hash); err != nil || exists != step.exists {
+			t.Fatalf("%s: got %v, %v, want %v", step.name, exists, err, step.exists)
+		}
+
+	}
+
+}
+
+func TestCachedKeyStoreBoundsMissesSeparately(t *testing.T) {
+
+	cs := NewCachedKeyStore(NewMemoryKeyStore())
+
+	record := StreamKeyRecord{ID: "key", Hash: "hash", UserID: "user"}
+
+	if err := cs.Put(record); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	for i := range cs.maxMisses * 3 {
+		cs.Get(fmt.Sprintf("sprayed-%d", i))
+	}
+
+	if len(cs.misses) > cs.maxMisses {
+		t.Fatalf("cached %d misses, the bound is %d", len(cs.misses), cs.maxMisses)
+	}
+
+	if _, cached := cs.records[record.Hash]; !cached {
+		t.Fatalf("spraying missing keys evicted a cached key")
+	}
+
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// keyPrefixLength is how many characters of a stream key may be shown in
+// logs and API listings. It identifies a key to its owner without giving
+// away enough of it to publish.
+const keyPrefixLength = 6
+
+var (
+	keySecret     = randomSecret()
+	keySecretLock sync.RWMutex
+)
+
+func randomSecret() []byte {
+
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate stream key secret: " + err.Error())
+	}
+
+	return b
+
+}
+
+func setKeySecret(secret []byte) {
+
+	keySecretLock.Lock()
+
+	defer keySecretLock.Unlock()
+
+	keySecret = secret
+
+}
+
+// HashStreamKey returns the keyed hash a stream key is stored under.
+// Without the server secret a dump of the store cannot be turned back
+// into usable keys.
+func HashStreamKey(streamKey string) string {
+
+	keySecretLock.RLock()
+
+	mac := hmac.New(sha256.New, keySecret)
+
+	keySecretLock.RUnlock()
+
+	mac.Write([]byte(streamKey))
+
+	return hex.EncodeToString(mac.Sum(nil))
+
+}
+
+// hashesEqual compares two stored hashes in constant time.
+func hashesEqual(a, b string) bool {
+
+	return hmac.Equal([]byte(a), []byte(b))
+
+}
+
+// KeyPrefix returns the part of a stream key that is safe to display.
+func KeyPrefix(streamKey string) string {
+
+	if len(streamKey) <= keyPrefixLength {
+		return streamKey
+	}
+
+	return streamKey[:keyPrefixLength]
+
+}
+
+// MaskStreamKey renders a stream key for log output.
+func MaskStreamKey(streamKey string) string {
+
+	if streamKey == "" {
+		return ""
+	}
+
+	return KeyPrefix(streamKey) + "…"
+
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+)
+
+// StreamKeyRecord describes a stream key without the key itself: only its
+// keyed hash and a short display prefix are kept.
+type StreamKeyRecord struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Hash      string    `json:"hash"`
+	Prefix    string    `json:"prefix"`
+	UserID    string    `json:"userID"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	SingleUse bool      `json:"singleUse,omitempty"`
+	UsedAt    time.Time `json:"usedAt,omitzero"`
+}
+
+// Expired reports whether the key has passed its expiry time.
+func (r StreamKeyRecord) Expired(now time.Time) bool {
+
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+
+}
+
+// Consumed reports whether a single-use key has already been published with.
+func (r StreamKeyRecord) Consumed() bool {
+
+	return r.SingleUse && !r.UsedAt.IsZero()
+
+}
+
+// KeyStore persists stream key records by hash. Implementations must be
+// safe for concurrent use and keep an index by user so ListByUser does not
+// scan every key.
+type KeyStore interface {
+	Get(hash string) (StreamKeyRecord, bool, error)
+	Put(record StreamKeyRecord) error
+	Delete(hash string) error
+	List() ([]StreamKeyRecord, error)
+	ListByUser(userID string) ([]StreamKeyRecord, error)
+	Close() error
+}
+
+func NewKeyStore(cfg config.KeyStoreConfig) (KeyStore, error) {
+
+	switch cfg.Backend {
+
+	case "", "memory":
+		return NewMemoryKeyStore(), nil
+
+	case "bolt":
+		return NewBoltKeyStore(cfg.Path)
+
+	default:
+		return nil, fmt.Errorf("unsupported stream key store: %s", cfg.Backend)
+
+	}
+
+}
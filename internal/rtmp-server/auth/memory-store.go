@@ -0,0 +1,119 @@
+package auth
+
+import "sync"
+
+type MemoryKeyStore struct {
+	records     map[string]StreamKeyRecord
+	byUser      map[string]map[string]struct{}
+	recordsLock sync.RWMutex
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+
+	return &MemoryKeyStore{
+		records: make(map[string]StreamKeyRecord),
+		byUser:  make(map[string]map[string]struct{}),
+	}
+
+}
+
+func (ms *MemoryKeyStore) Get(hash string) (StreamKeyRecord, bool, error) {
+
+	ms.recordsLock.RLock()
+
+	defer ms.recordsLock.RUnlock()
+
+	record, exists := ms.records[hash]
+
+	return record, exists, nil
+
+}
+
+func (ms *MemoryKeyStore) Put(record StreamKeyRecord) error {
+
+	ms.recordsLock.Lock()
+
+	defer ms.recordsLock.Unlock()
+
+	ms.records[record.Hash] = record
+
+	keys, exists := ms.byUser[record.UserID]
+
+	if !exists {
+		keys = make(map[string]struct{})
+		ms.byUser[record.UserID] = keys
+	}
+
+	keys[record.Hash] = struct{}{}
+
+	return nil
+
+}
+
+func (ms *MemoryKeyStore) Delete(hash string) error {
+
+	ms.recordsLock.Lock()
+
+	defer ms.recordsLock.Unlock()
+
+	record, exists := ms.records[hash]
+
+	if !exists {
+		return nil
+	}
+
+	delete(ms.records, hash)
+
+	if keys := ms.byUser[record.UserID]; keys != nil {
+
+		delete(keys, hash)
+
+		if len(keys) == 0 {
+			delete(ms.byUser, record.UserID)
+		}
+
+	}
+
+	return nil
+
+}
+
+func (ms *MemoryKeyStore) List() ([]StreamKeyRecord, error) {
+
+	ms.recordsLock.RLock()
+
+	defer ms.recordsLock.RUnlock()
+
+	records := make([]StreamKeyRecord, 0, len(ms.records))
+
+	for _, record := range ms.records {
+		records = append(records, record)
+	}
+
+	return records, nil
+
+}
+
+func (ms *MemoryKeyStore) ListByUser(userID string) ([]StreamKeyRecord, error) {
+
+	ms.recordsLock.RLock()
+
+	defer ms.recordsLock.RUnlock()
+
+	keys := ms.byUser[userID]
+
+	records := make([]StreamKeyRecord, 0, len(keys))
+
+	for hash := range keys {
+		records = append(records, ms.records[hash])
+	}
+
+	return records, nil
+
+}
+
+func (ms *MemoryKeyStore) Close() error {
+
+	return nil
+
+}
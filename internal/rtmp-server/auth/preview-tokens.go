@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPreviewTokenInvalid = errors.New("invalid preview token")
+	ErrPreviewTokenExpired = errors.New("preview token has expired")
+)
+
+// PreviewToken authorizes watching what is published on a stream key's ID
+// over WebRTC (WHEP) for a limited time. It is sent as the bearer token of
+// the WHEP request.
+type PreviewToken struct {
+	UserID    string
+	KeyID     string
+	ExpiresAt time.Time
+}
+
+// String returns the signed token: the user ID, expiry and signature,
+// separated by dots.
+func (pt PreviewToken) String() string {
+
+	uid := base64.RawURLEncoding.EncodeToString([]byte(pt.UserID))
+
+	exp := strconv.FormatInt(pt.ExpiresAt.Unix(), 10)
+
+	return uid + "." + exp + "." + signPreviewToken(pt.KeyID, pt.UserID, exp)
+
+}
+
+// VerifyPreviewToken checks a preview token against the key ID it is used
+// for and its expiry. The key it was issued for must still be active.
+func VerifyPreviewToken(keyID, token string) (PreviewToken, error) {
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return PreviewToken{}, ErrPreviewTokenInvalid
+	}
+
+	uid, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return PreviewToken{}, ErrPreviewTokenInvalid
+	}
+
+	if !hmac.Equal([]byte(parts[2]), []byte(signPreviewToken(keyID, string(uid), parts[1]))) {
+		return PreviewToken{}, ErrPreviewTokenInvalid
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+
+	if err != nil {
+		return PreviewToken{}, ErrPreviewTokenInvalid
+	}
+
+	expiresAt := time.Unix(exp, 0)
+
+	if !time.Now().Before(expiresAt) {
+		return PreviewToken{}, ErrPreviewTokenExpired
+	}
+
+	if record, exists := FindStreamKeyForUser(string(uid), keyID); !exists || record.ID != keyID {
+		return PreviewToken{}, fmt.Errorf("%w: stream key is no longer active", ErrPreviewTokenInvalid)
+	}
+
+	return PreviewToken{
+		UserID:    string(uid),
+		KeyID:     keyID,
+		ExpiresAt: expiresAt,
+	}, nil
+
+}
+
+func signPreviewToken(keyID, userID, exp string) string {
+
+	keySecretLock.RLock()
+
+	mac := hmac.New(sha256.New, keySecret)
+
+	keySecretLock.RUnlock()
+
+	fmt.Fprintf(mac, "preview\n%s\n%s\n%s", keyID, userID, exp)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPreviewToken(t *testing.T) {
+
+	useKeyStore(t, NewCachedKeyStore(NewMemoryKeyStore()))
+
+	record, _, err := CreateStreamKey("user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	other, _, err := CreateStreamKey("other-user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	revoked, _, err := CreateStreamKey("user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	valid := PreviewToken{UserID: "user", KeyID: record.ID, ExpiresAt: expiresAt}.String()
+
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		keyID string
+		token string
+		err   error
+	}{
+		{name: "valid", keyID: record.ID, token: valid},
+		{name: "expired", keyID: record.ID, token: PreviewToken{UserID: "user", KeyID: record.ID, ExpiresAt: time.Now().Add(-time.Second)}.String(), err: ErrPreviewTokenExpired},
+		{name: "expiry extended", keyID: record.ID, token: parts[0] + ".9999999999." + parts[2], err: ErrPreviewTokenInvalid},
+		{name: "tampered signature", keyID: record.ID, token: parts[0] + "." + parts[1] + "." + tamper(parts[2]), err: ErrPreviewTokenInvalid},
+		{name: "another key", keyID: other.ID, token: valid, err: ErrPreviewTokenInvalid},
+		{name: "another user", keyID: record.ID, token: base64.RawURLEncoding.EncodeToString([]byte("other-user")) + "." + parts[1] + "." + parts[2], err: ErrPreviewTokenInvalid},
+		{name: "issued for another user's key", keyID: other.ID, token: PreviewToken{UserID: "user", KeyID: other.ID, ExpiresAt: expiresAt}.String(), err: ErrPreviewTokenInvalid},
+		{name: "revoked key", keyID: revoked.ID, token: PreviewToken{UserID: "user", KeyID: revoked.ID, ExpiresAt: expiresAt}.String(), err: ErrPreviewTokenInvalid},
+		{name: "empty", keyID: record.ID, token: "", err: ErrPreviewTokenInvalid},
+		{name: "missing part", keyID: record.ID, token: parts[0] + "." + parts[1], err: ErrPreviewTokenInvalid},
+		{name: "extra part", keyID: record.ID, token: valid + ".extra", err: ErrPreviewTokenInvalid},
+		{name: "malformed user", keyID: record.ID, token: "!!." + parts[1] + "." + parts[2], err: ErrPreviewTokenInvalid},
+		{name: "malformed expiry", keyID: record.ID, token: parts[0] + ".soon." + signPreviewToken(record.ID, "user", "soon"), err: ErrPreviewTokenInvalid},
+	}
+
+	if err := RevokeStreamKeyRecord(revoked); err != nil {
+		t.Fatalf("RevokeStreamKeyRecord: %v", err)
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			preview, err := VerifyPreviewToken(test.keyID, test.token)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if test.err == nil && (preview.UserID != "user" || preview.KeyID != test.keyID || !preview.ExpiresAt.Equal(expiresAt)) {
+				t.Fatalf("verified %+v, want user's key %s until %s", preview, test.keyID, expiresAt)
+			}
+
+		})
+
+	}
+
+}
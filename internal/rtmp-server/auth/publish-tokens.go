@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPublishTokenInvalid = errors.New("invalid publish token")
+	ErrPublishTokenExpired = errors.New("publish token has expired")
+	ErrPublishTokenIP      = errors.New("publish token is bound to a different client IP")
+)
+
+// PublishToken authorizes publishing to a stream key's ID for a limited
+// time without handing out the key itself. It travels in the query string
+// of the publish URL and reaches on_publish in SRS's param field.
+type PublishToken struct {
+	UserID    string
+	KeyID     string
+	ExpiresAt time.Time
+	ClientIP  string
+}
+
+// Query returns the signed query string to append to the publish URL.
+func (pt PublishToken) Query() string {
+
+	values := url.Values{}
+
+	values.Set("uid", pt.UserID)
+
+	values.Set("exp", strconv.FormatInt(pt.ExpiresAt.Unix(), 10))
+
+	if pt.ClientIP != "" {
+		values.Set("ip", pt.ClientIP)
+	}
+
+	values.Set("token", signPublishToken(pt.KeyID, values))
+
+	return values.Encode()
+
+}
+
+// HasPublishToken reports whether an on_publish param carries a token.
+func HasPublishToken(param string) bool {
+
+	values, err := url.ParseQuery(strings.TrimPrefix(param, "?"))
+
+	return err == nil && values.Get("token") != ""
+
+}
+
+// VerifyPublishToken checks the token in param against the stream name
+// (a key ID), its expiry and, if the token is IP bound, the client's IP.
+// The key it was issued for must still be active: unexpired and, if it is
+// single-use, not used yet.
+func VerifyPublishToken(stream, param, clientIP string) (StreamKeyRecord, error) {
+
+	values, err := url.ParseQuery(strings.TrimPrefix(param, "?"))
+
+	if err != nil {
+		return StreamKeyRecord{}, ErrPublishTokenInvalid
+	}
+
+	token := values.Get("token")
+
+	if token == "" || !hmac.Equal([]byte(token), []byte(signPublishToken(stream, values))) {
+		return StreamKeyRecord{}, ErrPublishTokenInvalid
+	}
+
+	exp, err := strconv.ParseInt(values.Get("exp"), 10, 64)
+
+	if err != nil {
+		return StreamKeyRecord{}, ErrPublishTokenInvalid
+	}
+
+	if !time.Now().Before(time.Unix(exp, 0)) {
+		return StreamKeyRecord{}, ErrPublishTokenExpired
+	}
+
+	if boundIP := values.Get("ip"); boundIP != "" && boundIP != clientIP {
+		return StreamKeyRecord{}, ErrPublishTokenIP
+	}
+
+	record, exists := FindStreamKeyForUser(values.Get("uid"), stream)
+
+	if !exists || record.ID != stream {
+		return StreamKeyRecord{}, fmt.Errorf("%w: stream key is no longer active", ErrPublishTokenInvalid)
+	}
+
+	return record, nil
+
+}
+
+func signPublishToken(keyID string, values url.Values) string {
+
+	keySecretLock.RLock()
+
+	mac := hmac.New(sha256.New, keySecret)
+
+	keySecretLock.RUnlock()
+
+	fmt.Fprintf(mac, "publish\n%s\n%s\n%s\n%s", keyID, values.Get("uid"), values.Get("exp"), values.Get("ip"))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerifyPublishToken(t *testing.T) {
+
+	useKeyStore(t, NewCachedKeyStore(NewMemoryKeyStore()))
+
+	record, _, err := CreateStreamKey("user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	other, _, err := CreateStreamKey("other-user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	revoked, _, err := CreateStreamKey("user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	valid := PublishToken{UserID: "user", KeyID: record.ID, ExpiresAt: time.Now().Add(time.Hour)}
+
+	bound := valid
+
+	bound.ClientIP = "192.0.2.1"
+
+	// with returns the query of token with one value replaced.
+	with := func(token PublishToken, key, value string) string {
+
+		values, _ := url.ParseQuery(token.Query())
+
+		values.Set(key, value)
+
+		return values.Encode()
+
+	}
+
+	issued, _ := url.ParseQuery(valid.Query())
+
+	signature := issued.Get("token")
+
+	tests := []struct {
+		name   string
+		stream string
+		param  string
+		ip     string
+		err    error
+	}{
+		{name: "valid", stream: record.ID, param: valid.Query(), ip: "198.51.100.1"},
+		{name: "leading question mark", stream: record.ID, param: "?" + valid.Query()},
+		{name: "bound to the client's IP", stream: record.ID, param: bound.Query(), ip: "192.0.2.1"},
+		{name: "bound to another IP", stream: record.ID, param: bound.Query(), ip: "198.51.100.1", err: ErrPublishTokenIP},
+		{name: "IP binding removed", stream: record.ID, param: with(bound, "ip", ""), ip: "198.51.100.1", err: ErrPublishTokenInvalid},
+		{name: "expired", stream: record.ID, param: PublishToken{UserID: "user", KeyID: record.ID, ExpiresAt: time.Now().Add(-time.Second)}.Query(), err: ErrPublishTokenExpired},
+		{name: "expiry extended", stream: record.ID, param: with(valid, "exp", "9999999999"), err: ErrPublishTokenInvalid},
+		{name: "tampered signature", stream: record.ID, param: with(valid, "token", tamper(signature)), err: ErrPublishTokenInvalid},
+		{name: "another key", stream: other.ID, param: valid.Query(), err: ErrPublishTokenInvalid},
+		{name: "another user", stream: record.ID, param: with(valid, "uid", "other-user"), err: ErrPublishTokenInvalid},
+		{name: "issued for another user's key", stream: other.ID, param: PublishToken{UserID: "user", KeyID: other.ID, ExpiresAt: time.Now().Add(time.Hour)}.Query(), err: ErrPublishTokenInvalid},
+		{name: "revoked key", stream: revoked.ID, param: PublishToken{UserID: "user", KeyID: revoked.ID, ExpiresAt: time.Now().Add(time.Hour)}.Query(), err: ErrPublishTokenInvalid},
+		{name: "no token", stream: record.ID, param: "uid=user&exp=9999999999", err: ErrPublishTokenInvalid},
+		{name: "malformed query", stream: record.ID, param: "token=%zz", err: ErrPublishTokenInvalid},
+		{name: "malformed expiry", stream: record.ID, param: with(valid, "exp", "soon"), err: ErrPublishTokenInvalid},
+	}
+
+	if err := RevokeStreamKeyRecord(revoked); err != nil {
+		t.Fatalf("RevokeStreamKeyRecord: %v", err)
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			verified, err := VerifyPublishToken(test.stream, test.param, test.ip)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if test.err == nil && verified.ID != test.stream {
+				t.Fatalf("verified key %s, want %s", verified.ID, test.stream)
+			}
+
+		})
+
+	}
+
+}
+
+func TestHasPublishToken(t *testing.T) {
+
+	tests := []struct {
+		param string
+		want  bool
+	}{
+		{param: "?uid=user&exp=1&token=abc", want: true},
+		{param: "token=abc", want: true},
+		{param: "", want: false},
+		{param: "?vhost=live", want: false},
+		{param: "token=%zz", want: false},
+	}
+
+	for _, test := range tests {
+
+		if got := HasPublishToken(test.param); got != test.want {
+			t.Errorf("HasPublishToken(%q) = %t, want %t", test.param, got, test.want)
+		}
+
+	}
+
+}
+
+// tamper changes the first character of a signature.
+func tamper(signature string) string {
+
+	if signature[0] == 'A' {
+		return "B" + signature[1:]
+	}
+
+	return "A" + signature[1:]
+
+}
@@ -3,85 +3,443 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/utils"
+)
+
+var (
+	store     KeyStore = NewCachedKeyStore(NewMemoryKeyStore())
+	storeLock sync.RWMutex
+
+	// consumeLock serializes read-modify-write updates to key records so a
+	// single-use key cannot be consumed by two concurrent publishes.
+	consumeLock sync.Mutex
+
+	onRotated     []func(previous, replacement StreamKeyRecord)
+	onRotatedLock sync.Mutex
 )
 
 var (
-	streamKeys     = make(map[string]string)
-	streamKeysLock sync.RWMutex
+	ErrStreamKeyNotFound = errors.New("stream key not found")
+	ErrStreamKeyExpired  = errors.New("stream key has expired")
+	ErrStreamKeyConsumed = errors.New("single-use stream key has already been used")
+	ErrStreamKeyNameUsed = errors.New("a stream key with this name already exists")
 )
 
+type StreamKeyOptions struct {
+	Name      string
+	TTL       time.Duration
+	SingleUse bool
+}
+
+// InitKeyStore replaces the default in-memory store with the backend
+// selected in cfg. It should be called once at startup, before any keys
+// are generated.
+func InitKeyStore(cfg config.KeyStoreConfig) error {
+
+	if cfg.Secret != "" {
+
+		setKeySecret([]byte(cfg.Secret))
+
+	} else if cfg.Backend != "" && cfg.Backend != "memory" {
+
+		return fmt.Errorf("STREAM_KEY_SECRET must be set to use the %s stream key store", cfg.Backend)
+
+	} else {
+
+		log.Println("Warning: STREAM_KEY_SECRET not set, using a random secret for this process")
+
+	}
+
+	backend, err := NewKeyStore(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	if boltStore, ok := backend.(*BoltKeyStore); ok {
+
+		migrated, err := boltStore.MigratePlaintextKeys(HashStreamKey)
+
+		if err != nil {
+			boltStore.Close()
+			return err
+		}
+
+		if migrated > 0 {
+			log.Printf("Migrated %d plaintext stream keys to hashed storage", migrated)
+		}
+
+	}
+
+	storeLock.Lock()
+
+	defer storeLock.Unlock()
+
+	store = NewCachedKeyStore(backend)
+
+	log.Printf("Using %s stream key store", cfg.Backend)
+
+	return nil
+
+}
+
+func CloseKeyStore() error {
+
+	return getStore().Close()
+
+}
+
+func getStore() KeyStore {
+
+	storeLock.RLock()
+
+	defer storeLock.RUnlock()
+
+	return store
+
+}
+
 func GenerateStreamKey(userID string) (string, error) {
 
+	return GenerateStreamKeyWithOptions(userID, StreamKeyOptions{})
+
+}
+
+// GenerateStreamKeyWithOptions creates a key that optionally expires after
+// TTL or stops working after its first successful publish.
+func GenerateStreamKeyWithOptions(userID string, options StreamKeyOptions) (string, error) {
+
+	_, streamKey, err := CreateStreamKey(userID, options)
+
+	return streamKey, err
+
+}
+
+// CreateStreamKey generates and stores a key for userID. Names are optional
+// but must be unique among the user's active keys. The plaintext key is
+// only ever returned here; the store keeps its hash.
+func CreateStreamKey(userID string, options StreamKeyOptions) (StreamKeyRecord, string, error) {
+
+	consumeLock.Lock()
+
+	defer consumeLock.Unlock()
+
+	if options.Name != "" {
+
+		if _, exists := FindStreamKeyForUser(userID, options.Name); exists {
+			return StreamKeyRecord{}, "", ErrStreamKeyNameUsed
+		}
+
+	}
+
+	record, streamKey, err := newStreamKeyRecord(userID, options)
+
+	if err != nil {
+		return StreamKeyRecord{}, "", err
+	}
+
+	if err := getStore().Put(record); err != nil {
+		return StreamKeyRecord{}, "", fmt.Errorf("failed to store stream key: %v", err)
+	}
+
+	return record, streamKey, nil
+
+}
+
+func newStreamKeyRecord(userID string, options StreamKeyOptions) (StreamKeyRecord, string, error) {
+
 	b := make([]byte, 16)
 
 	_, err := rand.Read(b)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to generate stream key: %v", err)
+		return StreamKeyRecord{}, "", fmt.Errorf("failed to generate stream key: %v", err)
+	}
+
+	id, err := utils.GenerateID()
+
+	if err != nil {
+		return StreamKeyRecord{}, "", fmt.Errorf("failed to generate stream key id: %v", err)
 	}
 
 	streamKey := base64.RawURLEncoding.EncodeToString(b)
 
-	streamKeysLock.Lock()
+	now := time.Now()
 
-	defer streamKeysLock.Unlock()
+	record := StreamKeyRecord{
+		ID:        id,
+		Name:      options.Name,
+		Hash:      HashStreamKey(streamKey),
+		Prefix:    KeyPrefix(streamKey),
+		UserID:    userID,
+		CreatedAt: now,
+		SingleUse: options.SingleUse,
+	}
 
-	streamKeys[streamKey] = userID //FIXME - Store keys in db and cache for faster access
+	if options.TTL > 0 {
+		record.ExpiresAt = now.Add(options.TTL)
+	}
 
-	return streamKey, nil
+	return record, streamKey, nil
 
 }
 
 func ValidateStreamKey(streamKey string) bool {
 
-	streamKeysLock.RLock()
+	_, err := LookupStreamKey(streamKey)
 
-	defer streamKeysLock.RUnlock()
+	return err == nil
 
-	_, exists := streamKeys[streamKey]
+}
+
+// ConsumeStreamKeyRecord marks a single-use key as used once a publish
+// with it has been accepted, so later publishes are rejected. The record
+// is read again under the lock, so of two publishes racing on the key only
+// one consumes it.
+func ConsumeStreamKeyRecord(record StreamKeyRecord) (StreamKeyRecord, error) {
 
-	return exists
+	if !record.SingleUse {
+		return record, nil
+	}
+
+	consumeLock.Lock()
+
+	defer consumeLock.Unlock()
+
+	current, exists, err := getStore().Get(record.Hash)
+
+	if err != nil {
+		return StreamKeyRecord{}, fmt.Errorf("failed to look up stream key: %v", err)
+	}
+
+	if !exists || current.ID != record.ID {
+		return StreamKeyRecord{}, ErrStreamKeyNotFound
+	}
+
+	if current.Expired(time.Now()) {
+		return StreamKeyRecord{}, ErrStreamKeyExpired
+	}
+
+	if current.Consumed() {
+		return StreamKeyRecord{}, ErrStreamKeyConsumed
+	}
+
+	current.UsedAt = time.Now()
+
+	if err := getStore().Put(current); err != nil {
+		return StreamKeyRecord{}, fmt.Errorf("failed to consume stream key: %v", err)
+	}
+
+	return current, nil
+
+}
+
+// OnStreamKeyRotated registers fn to be called after a key is replaced, so
+// whatever refers to the key by ID can move to the replacement.
+func OnStreamKeyRotated(fn func(previous, replacement StreamKeyRecord)) {
+
+	onRotatedLock.Lock()
+
+	defer onRotatedLock.Unlock()
+
+	onRotated = append(onRotated, fn)
+
+}
+
+// RotateStreamKey issues a replacement for one of the user's keys with the
+// same name and options and lets the old key keep working for the given
+// grace period. The replacement's plaintext key is returned alongside it.
+func RotateStreamKey(userID, keyID string, grace time.Duration) (StreamKeyRecord, string, StreamKeyRecord, error) {
+
+	replacement, streamKey, previous, err := rotateStreamKey(userID, keyID, grace)
+
+	if err != nil {
+		return StreamKeyRecord{}, "", StreamKeyRecord{}, err
+	}
+
+	onRotatedLock.Lock()
+
+	callbacks := append([]func(previous, replacement StreamKeyRecord){}, onRotated...)
+
+	onRotatedLock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(previous, replacement)
+	}
+
+	return replacement, streamKey, previous, nil
 
 }
 
-func RevokeStreamKey(streamKey string) {
+func rotateStreamKey(userID, keyID string, grace time.Duration) (StreamKeyRecord, string, StreamKeyRecord, error) {
+
+	consumeLock.Lock()
+
+	defer consumeLock.Unlock()
+
+	previous, exists := FindStreamKeyForUser(userID, keyID)
+
+	if !exists || previous.ID != keyID {
+		return StreamKeyRecord{}, "", StreamKeyRecord{}, ErrStreamKeyNotFound
+	}
+
+	options := StreamKeyOptions{Name: previous.Name, SingleUse: previous.SingleUse}
+
+	if !previous.ExpiresAt.IsZero() {
+		options.TTL = previous.ExpiresAt.Sub(previous.CreatedAt)
+	}
 
-	streamKeysLock.Lock()
+	replacement, streamKey, err := newStreamKeyRecord(previous.UserID, options)
 
-	defer streamKeysLock.Unlock()
+	if err != nil {
+		return StreamKeyRecord{}, "", StreamKeyRecord{}, err
+	}
 
-	delete(streamKeys, streamKey)
+	if err := getStore().Put(replacement); err != nil {
+		return StreamKeyRecord{}, "", StreamKeyRecord{}, fmt.Errorf("failed to store stream key: %v", err)
+	}
+
+	graceEnd := time.Now().Add(grace)
+
+	if previous.ExpiresAt.IsZero() || graceEnd.Before(previous.ExpiresAt) {
+		previous.ExpiresAt = graceEnd
+	}
+
+	if err := getStore().Put(previous); err != nil {
+		return StreamKeyRecord{}, "", StreamKeyRecord{}, fmt.Errorf("failed to update rotated stream key: %v", err)
+	}
+
+	return replacement, streamKey, previous, nil
+
+}
+
+// LookupStreamKey returns the record for a plaintext key if the key is
+// active. The key is hashed before it touches the store and the stored
+// hash is compared in constant time.
+func LookupStreamKey(streamKey string) (StreamKeyRecord, error) {
+
+	hash := HashStreamKey(streamKey)
+
+	record, exists, err := getStore().Get(hash)
+
+	if err != nil {
+		return StreamKeyRecord{}, fmt.Errorf("failed to look up stream key: %v", err)
+	}
+
+	if !exists || !hashesEqual(record.Hash, hash) {
+		return StreamKeyRecord{}, ErrStreamKeyNotFound
+	}
+
+	if record.Expired(time.Now()) {
+
+		if err := getStore().Delete(hash); err != nil {
+			log.Printf("Failed to delete expired stream key %s: %v", record.ID, err)
+		}
+
+		return StreamKeyRecord{}, ErrStreamKeyExpired
+
+	}
+
+	if record.Consumed() {
+		return StreamKeyRecord{}, ErrStreamKeyConsumed
+	}
+
+	return record, nil
+
+}
+
+func RevokeStreamKey(streamKey string) error {
+
+	return getStore().Delete(HashStreamKey(streamKey))
+
+}
+
+func RevokeStreamKeyRecord(record StreamKeyRecord) error {
+
+	return getStore().Delete(record.Hash)
 
 }
 
 func GetUserForStreamKey(streamKey string) (string, bool) {
 
-	streamKeysLock.RLock()
+	record, err := LookupStreamKey(streamKey)
 
-	defer streamKeysLock.RUnlock()
+	if err != nil {
+		return "", false
+	}
+
+	return record.UserID, true
+
+}
+
+// FindStreamKeyForUser looks up one of the user's active keys by ID or
+// name. An empty selector returns the most recently created active key.
+// When a rotated key and its replacement share a name, the newer one wins.
+func FindStreamKeyForUser(userID, selector string) (StreamKeyRecord, bool) {
+
+	var found StreamKeyRecord
+
+	exists := false
+
+	for _, record := range ListStreamKeysForUser(userID) {
+
+		if record.Consumed() {
+			continue
+		}
+
+		if selector != "" && record.ID == selector {
+			return record, true
+		}
+
+		if selector != "" && record.Name != selector {
+			continue
+		}
 
-	userID, exists := streamKeys[streamKey]
+		if !exists || record.CreatedAt.After(found.CreatedAt) {
+			found = record
+			exists = true
+		}
+
+	}
 
-	return userID, exists
+	return found, exists
 
 }
 
-func GetStreamKeyForUser(userID string) (string, bool) {
+// ListStreamKeysForUser returns the user's unexpired keys, oldest first.
+func ListStreamKeysForUser(userID string) []StreamKeyRecord {
 
-	streamKeysLock.RLock()
+	records, err := getStore().ListByUser(userID)
 
-	defer streamKeysLock.RUnlock()
+	if err != nil {
+		log.Printf("Failed to list stream keys: %v", err)
+		return nil
+	}
+
+	now := time.Now()
 
-	for key, id := range streamKeys {
+	active := records[:0]
 
-		if id == userID {
-			return key, true
+	for _, record := range records {
+
+		if !record.Expired(now) {
+			active = append(active, record)
 		}
 
 	}
 
-	return "", false
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+
+	return active
 
 }
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamKeys(t *testing.T) {
+
+	backends := map[string]func(t *testing.T) KeyStore{
+		"memory": func(t *testing.T) KeyStore {
+			return NewMemoryKeyStore()
+		},
+		"bolt": func(t *testing.T) KeyStore {
+
+			backend, err := NewBoltKeyStore(filepath.Join(t.TempDir(), "keys.db"))
+
+			if err != nil {
+				t.Fatalf("NewBoltKeyStore: %v", err)
+			}
+
+			return backend
+
+		},
+	}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{name: "lookup", run: testLookupStreamKey},
+		{name: "unique names", run: testStreamKeyNames},
+		{name: "single use", run: testSingleUseStreamKey},
+		{name: "expiry", run: testExpiredStreamKey},
+		{name: "rotation", run: testRotateStreamKey},
+		{name: "revocation", run: testRevokeStreamKey},
+	}
+
+	for name, newBackend := range backends {
+
+		for _, test := range tests {
+
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+
+				useKeyStore(t, NewCachedKeyStore(newBackend(t)))
+
+				test.run(t)
+
+			})
+
+		}
+
+	}
+
+}
+
+func testLookupStreamKey(t *testing.T) {
+
+	record, streamKey, err := CreateStreamKey("user", StreamKeyOptions{Name: "default"})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	if record.Hash == streamKey || record.Hash != HashStreamKey(streamKey) {
+		t.Fatalf("the record does not hold the key's hash")
+	}
+
+	found, err := LookupStreamKey(streamKey)
+
+	if err != nil || found.ID != record.ID {
+		t.Fatalf("LookupStreamKey returned %+v, %v, want %s", found, err, record.ID)
+	}
+
+	if _, err := LookupStreamKey(streamKey + "x"); !errors.Is(err, ErrStreamKeyNotFound) {
+		t.Fatalf("got %v for an unknown key, want ErrStreamKeyNotFound", err)
+	}
+
+	if found, exists := FindStreamKeyForUser("user", "default"); !exists || found.ID != record.ID {
+		t.Fatalf("FindStreamKeyForUser did not find the key by name")
+	}
+
+}
+
+func testStreamKeyNames(t *testing.T) {
+
+	if _, _, err := CreateStreamKey("user", StreamKeyOptions{Name: "studio"}); err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	if _, _, err := CreateStreamKey("user", StreamKeyOptions{Name: "studio"}); !errors.Is(err, ErrStreamKeyNameUsed) {
+		t.Fatalf("got %v for a reused name, want ErrStreamKeyNameUsed", err)
+	}
+
+	if _, _, err := CreateStreamKey("other-user", StreamKeyOptions{Name: "studio"}); err != nil {
+		t.Fatalf("another user could not use the name: %v", err)
+	}
+
+}
+
+func testSingleUseStreamKey(t *testing.T) {
+
+	record, streamKey, err := CreateStreamKey("user", StreamKeyOptions{SingleUse: true})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	if _, err := ConsumeStreamKeyRecord(record); err != nil {
+		t.Fatalf("first ConsumeStreamKeyRecord: %v", err)
+	}
+
+	if _, err := ConsumeStreamKeyRecord(record); !errors.Is(err, ErrStreamKeyConsumed) {
+		t.Fatalf("got %v consuming the key again, want ErrStreamKeyConsumed", err)
+	}
+
+	if _, err := LookupStreamKey(streamKey); !errors.Is(err, ErrStreamKeyConsumed) {
+		t.Fatalf("got %v looking the used key up, want ErrStreamKeyConsumed", err)
+	}
+
+}
+
+func testExpiredStreamKey(t *testing.T) {
+
+	_, streamKey, err := CreateStreamKey("user", StreamKeyOptions{TTL: time.Nanosecond})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if _, err := LookupStreamKey(streamKey); !errors.Is(err, ErrStreamKeyExpired) {
+		t.Fatalf("got %v for an expired key, want ErrStreamKeyExpired", err)
+	}
+
+	if _, err := LookupStreamKey(streamKey); !errors.Is(err, ErrStreamKeyNotFound) {
+		t.Fatalf("got %v once the expired key was deleted, want ErrStreamKeyNotFound", err)
+	}
+
+}
+
+func testRotateStreamKey(t *testing.T) {
+
+	previous, previousKey, err := CreateStreamKey("user", StreamKeyOptions{Name: "default"})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	replacement, streamKey, _, err := RotateStreamKey("user", previous.ID, time.Minute)
+
+	if err != nil {
+		t.Fatalf("RotateStreamKey: %v", err)
+	}
+
+	if replacement.Name != previous.Name {
+		t.Fatalf("the replacement is named %q, want %q", replacement.Name, previous.Name)
+	}
+
+	for _, key := range []string{previousKey, streamKey} {
+
+		if _, err := LookupStreamKey(key); err != nil {
+			t.Fatalf("LookupStreamKey during the grace period: %v", err)
+		}
+
+	}
+
+	if found, _ := FindStreamKeyForUser("user", "default"); found.ID != replacement.ID {
+		t.Fatalf("the name refers to %s, want the replacement %s", found.ID, replacement.ID)
+	}
+
+	var rotated []string
+
+	onRotatedLock.Lock()
+
+	callbacks := onRotated
+
+	onRotated = []func(previous, replacement StreamKeyRecord){func(previous, replacement StreamKeyRecord) {
+		rotated = append(rotated, previous.ID, replacement.ID)
+	}}
+
+	onRotatedLock.Unlock()
+
+	t.Cleanup(func() {
+		onRotatedLock.Lock()
+		onRotated = callbacks
+		onRotatedLock.Unlock()
+	})
+
+	again, _, _, err := RotateStreamKey("user", replacement.ID, time.Minute)
+
+	if err != nil {
+		t.Fatalf("RotateStreamKey: %v", err)
+	}
+
+	if len(rotated) != 2 || rotated[0] != replacement.ID || rotated[1] != again.ID {
+		t.Fatalf("rotation reported as %v, want %s replaced by %s", rotated, replacement.ID, again.ID)
+	}
+
+}
+
+func testRevokeStreamKey(t *testing.T) {
+
+	record, streamKey, err := CreateStreamKey("user", StreamKeyOptions{})
+
+	if err != nil {
+		t.Fatalf("CreateStreamKey: %v", err)
+	}
+
+	if err := RevokeStreamKeyRecord(record); err != nil {
+		t.Fatalf("RevokeStreamKeyRecord: %v", err)
+	}
+
+	if ValidateStreamKey(streamKey) {
+		t.Fatalf("the revoked key is still valid")
+	}
+
+}
+
+// useKeyStore swaps the package's key store for the test.
+func useKeyStore(t *testing.T, keyStore KeyStore) {
+
+	storeLock.Lock()
+
+	previous := store
+
+	store = keyStore
+
+	storeLock.Unlock()
+
+	t.Cleanup(func() {
+
+		storeLock.Lock()
+
+		store = previous
+
+		storeLock.Unlock()
+
+		keyStore.Close()
+
+	})
+
+}
@@ -0,0 +1,90 @@
+package rtmpserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// Clients lists the connections SRS has open, limited to one stream key
+// when keyID is set. Connections that are not on a stream, or whose stream
+// is not published under a known key, are only listed when keyID is empty.
+func (srs *SimpleRealtimeServer) Clients(ctx context.Context, keyID string) ([]types.StreamClient, error) {
+
+	streams, err := srs.API.Streams(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get streams from SRS: %w", err)
+	}
+
+	clients, err := srs.API.Clients(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clients from SRS: %w", err)
+	}
+
+	// SRS refers to streams by its own IDs; map those to stream key IDs.
+	streamKeys := make(map[string]string, len(streams))
+
+	for _, stream := range streams {
+
+		if stream.App != ingestApp {
+			continue
+		}
+
+		if id, publishing := srs.publishers.StreamKeyID(stream.Name); publishing {
+			streamKeys[stream.ID] = id
+		}
+
+	}
+
+	result := []types.StreamClient{}
+
+	for _, client := range clients {
+
+		id := streamKeys[client.Stream]
+
+		if keyID != "" && id != keyID {
+			continue
+		}
+
+		result = append(result, types.StreamClient{
+			ClientID:  client.ID,
+			StreamID:  id,
+			IP:        client.IP,
+			Type:      client.Type,
+			Publisher: client.Publish,
+			Alive:     client.Alive,
+			RecvKbps:  client.Kbps.Recv30s,
+			SendKbps:  client.Kbps.Send30s,
+		})
+
+	}
+
+	return result, nil
+
+}
+
+// KickPublisher disconnects the encoder publishing on a stream key. The
+// key stays valid, so an encoder that reconnects on its own is let back in
+// unless the key is revoked first.
+func (srs *SimpleRealtimeServer) KickPublisher(keyID string) (mediaserver.Publisher, error) {
+
+	publisher, publishing := srs.publishers.Active(keyID)
+
+	if !publishing {
+		return mediaserver.Publisher{}, mediaserver.ErrStreamNotLive
+	}
+
+	if err := srs.KickClient(publisher.ClientID); err != nil {
+		return mediaserver.Publisher{}, err
+	}
+
+	log.Printf("Publisher %s (%s) kicked off key %s", publisher.ClientID, publisher.IP, keyID)
+
+	return publisher, nil
+
+}
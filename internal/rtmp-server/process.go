@@ -0,0 +1,405 @@
+package rtmpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+)
+
+type SRSMode string
+
+const (
+	SRSModeDocker   SRSMode = "docker"
+	SRSModeProcess  SRSMode = "process"
+	SRSModeExternal SRSMode = "external"
+)
+
+var errSRSStopping = errors.New("RTMP server is stopping")
+
+// readyPollInterval is how often the SRS API is polled while SRS starts.
+const readyPollInterval = 250 * time.Millisecond
+
+func parseSRSMode(mode string) (SRSMode, error) {
+
+	switch SRSMode(mode) {
+
+	case SRSModeDocker, SRSModeProcess, SRSModeExternal:
+		return SRSMode(mode), nil
+
+	}
+
+	return "", fmt.Errorf("unknown SRS mode %q, expected %q, %q or %q", mode, SRSModeDocker, SRSModeProcess, SRSModeExternal)
+
+}
+
+// startProcess launches SRS as a child process, hands it to the supervisor
+// and waits for its API to answer.
+func (srs *SimpleRealtimeServer) startProcess() error {
+
+	log.Printf("Starting RTMP server from %s with config %s...", srs.SRSPath, srs.ConfigPath)
+
+	cmd, exited, err := srs.launchProcess()
+
+	if err != nil {
+		return err
+	}
+
+	go srs.superviseProcess(cmd, exited)
+
+	ctx, cancel := context.WithTimeout(context.Background(), srs.Process.ReadyTimeout)
+
+	defer cancel()
+
+	version, err := srs.waitReady(ctx, exited)
+
+	if err != nil {
+		srs.abortProcess()
+		return err
+	}
+
+	log.Printf("RTMP server %s is running as process %d and reachable at port %s.", version.Version, cmd.Process.Pid, srs.Port)
+
+	return nil
+
+}
+
+func (srs *SimpleRealtimeServer) launchProcess() (*exec.Cmd, chan struct{}, error) {
+
+	srs.processLock.Lock()
+
+	defer srs.processLock.Unlock()
+
+	if srs.stopping {
+		return nil, nil, errSRSStopping
+	}
+
+	cmd := exec.Command(srs.SRSPath, "-c", srs.ConfigPath)
+
+	cmd.Dir = srs.processWorkDir()
+
+	cmd.Stdout = os.Stdout
+
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start RTMP server: %v", err)
+	}
+
+	exited := make(chan struct{})
+
+	srs.SRSProcess = cmd.Process
+
+	srs.processExited = exited
+
+	return cmd, exited, nil
+
+}
+
+// processWorkDir is where SRS runs. SRS resolves the relative paths in its
+// config against its working directory, which is normally the directory
+// holding objs/srs.
+func (srs *SimpleRealtimeServer) processWorkDir() string {
+
+	if srs.Process.WorkDir != "" {
+		return srs.Process.WorkDir
+	}
+
+	dir := filepath.Dir(srs.SRSPath)
+
+	if filepath.Base(dir) == "objs" {
+		return filepath.Dir(dir)
+	}
+
+	return dir
+
+}
+
+// superviseProcess waits for SRS to exit and, unless it is being stopped,
+// starts it again. Restarts back off exponentially; a process that stayed
+// up longer than the longest backoff starts the backoff over.
+func (srs *SimpleRealtimeServer) superviseProcess(cmd *exec.Cmd, exited chan struct{}) {
+
+	backoff := srs.Process.RestartBackoff
+
+	for {
+
+		startedAt := time.Now()
+
+		err := cmd.Wait()
+
+		srs.processLock.Lock()
+
+		close(exited)
+
+		srs.SRSProcess = nil
+
+		stopping := srs.stopping
+
+		srs.processLock.Unlock()
+
+		if stopping {
+			log.Printf("RTMP server process exited: %s", cmd.ProcessState)
+			return
+		}
+
+		log.Printf("RTMP server process exited unexpectedly: %v", err)
+
+		srs.releasePublishers()
+
+		if time.Since(startedAt) > srs.Process.MaxRestartBackoff {
+			backoff = srs.Process.RestartBackoff
+		}
+
+		for {
+
+			log.Printf("Restarting RTMP server in %s...", backoff)
+
+			select {
+
+			case <-srs.stopProcess:
+				return
+
+			case <-time.After(backoff):
+
+			}
+
+			backoff = min(backoff*2, srs.Process.MaxRestartBackoff)
+
+			cmd, exited, err = srs.launchProcess()
+
+			if err == nil {
+				break
+			}
+
+			if errors.Is(err, errSRSStopping) {
+				return
+			}
+
+			log.Printf("Failed to restart RTMP server: %v", err)
+
+		}
+
+		go func(exited chan struct{}) {
+
+			ctx, cancel := context.WithTimeout(context.Background(), srs.Process.ReadyTimeout)
+
+			defer cancel()
+
+			if _, err := srs.waitReady(ctx, exited); err != nil {
+				log.Printf("Restarted RTMP server is not ready: %v", err)
+				return
+			}
+
+			log.Println("RTMP server restarted successfully.")
+
+		}(exited)
+
+	}
+
+}
+
+// SetIngestHandler sets where the publishers SRS drops when it exits are
+// reported. Publishes themselves arrive through the hooks.
+func (srs *SimpleRealtimeServer) SetIngestHandler(handler mediaserver.IngestHandler) {
+
+	srs.processLock.Lock()
+
+	defer srs.processLock.Unlock()
+
+	srs.handler = handler
+
+}
+
+// releasePublishers ends every claim on a key after SRS exited: its
+// connections are gone and their unpublish hooks will never arrive. Left
+// alone, the claims would turn the encoders away when they reconnect.
+func (srs *SimpleRealtimeServer) releasePublishers() {
+
+	srs.processLock.Lock()
+
+	handler := srs.handler
+
+	srs.processLock.Unlock()
+
+	publishers, _ := srs.publishers.List("")
+
+	for _, publisher := range publishers {
+
+		if handler != nil {
+
+			handler.Unpublish(mediaserver.Connection{
+				ClientID: publisher.ClientID,
+				IP:       publisher.IP,
+				Protocol: publisher.Protocol,
+				App:      ingestApp,
+				Stream:   publisher.Stream,
+			})
+
+			continue
+
+		}
+
+		srs.publishers.Release(publisher.ClientID)
+
+	}
+
+	if len(publishers) > 0 {
+		log.Printf("Released %d publishers lost with the RTMP server", len(publishers))
+	}
+
+}
+
+// waitReady polls the SRS API until it answers, the context ends or the
+// process exits.
+func (srs *SimpleRealtimeServer) waitReady(ctx context.Context, exited <-chan struct{}) (srsapi.Version, error) {
+
+	ticker := time.NewTicker(readyPollInterval)
+
+	defer ticker.Stop()
+
+	for {
+
+		version, err := srs.API.Versions(ctx)
+
+		if err == nil {
+			return version, nil
+		}
+
+		select {
+
+		case <-ctx.Done():
+			return srsapi.Version{}, fmt.Errorf("RTMP server is not reachable at %s: %v", srs.API.BaseURL(), err)
+
+		case <-exited:
+			return srsapi.Version{}, fmt.Errorf("RTMP server exited while starting")
+
+		case <-ticker.C:
+
+		}
+
+	}
+
+}
+
+// abortProcess kills an SRS that did not come up and waits for it to exit,
+// so it does not outlive the server failing to start and keep its ports.
+// The supervisor does not restart it.
+func (srs *SimpleRealtimeServer) abortProcess() {
+
+	srs.processLock.Lock()
+
+	if !srs.stopping {
+		srs.stopping = true
+		close(srs.stopProcess)
+	}
+
+	process := srs.SRSProcess
+
+	exited := srs.processExited
+
+	srs.processLock.Unlock()
+
+	if process == nil {
+		return
+	}
+
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Printf("Failed to kill the RTMP server: %v", err)
+	}
+
+	<-exited
+
+}
+
+// stopSRSProcess sends SRS SIGTERM and waits for it to exit, killing it
+// if it takes longer than the stop timeout. The supervisor does not
+// restart it afterwards.
+func (srs *SimpleRealtimeServer) stopSRSProcess() error {
+
+	srs.processLock.Lock()
+
+	if !srs.stopping {
+		srs.stopping = true
+		close(srs.stopProcess)
+	}
+
+	process := srs.SRSProcess
+
+	exited := srs.processExited
+
+	srs.processLock.Unlock()
+
+	if process == nil {
+		log.Println("RTMP server process is not running.")
+		return nil
+	}
+
+	log.Printf("Stopping RTMP server process %d...", process.Pid)
+
+	if err := process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to signal the RTMP server: %v", err)
+	}
+
+	select {
+
+	case <-exited:
+
+	case <-time.After(srs.Process.StopTimeout):
+
+		log.Printf("RTMP server did not stop within %s, killing it", srs.Process.StopTimeout)
+
+		if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to kill the RTMP server: %v", err)
+		}
+
+		<-exited
+
+	}
+
+	log.Println("RTMP server stopped successfully.")
+
+	return nil
+
+}
+
+// stopDockerContainer stops the SRS container started from the configured
+// image.
+func (srs *SimpleRealtimeServer) stopDockerContainer() error {
+
+	log.Println("Stopping RTMP server via Docker...")
+
+	cmd := exec.Command("docker", "ps", "-q", "--filter", "ancestor="+srs.Process.DockerImage)
+
+	output, err := cmd.Output()
+
+	if err != nil {
+		return fmt.Errorf("failed to find SRS container: %v", err)
+	}
+
+	containerIDs := strings.Fields(string(output))
+
+	if len(containerIDs) == 0 {
+		return fmt.Errorf("no running SRS container from image %s", srs.Process.DockerImage)
+	}
+
+	stopCmd := exec.Command("docker", append([]string{"stop"}, containerIDs...)...)
+
+	if output, err := stopCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stop the RTMP server via Docker: %v, output: %s", err, output)
+	}
+
+	log.Println("RTMP server stopped successfully.")
+
+	return nil
+
+}
@@ -0,0 +1,70 @@
+package rtmpserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi/srsapitest"
+)
+
+func TestStartProcessKillsSRSThatIsNotReady(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// An SRS that starts but whose API never answers. It records its PID.
+	srsPath := filepath.Join(dir, "srs")
+
+	pidPath := filepath.Join(dir, "srs.pid")
+
+	if err := os.WriteFile(srsPath, []byte("#!/bin/sh\necho $$ > "+pidPath+"\nexec sleep 60\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	fake := srsapitest.NewServer()
+
+	fake.Close()
+
+	t.Setenv("CONFIG_PATH", filepath.Join(dir, "srs.conf"))
+
+	t.Setenv("SRS_PATH", srsPath)
+
+	t.Setenv("SRS_MODE", "process")
+
+	t.Setenv("SRS_API_URL", fake.URL)
+
+	t.Setenv("SRS_API_RETRIES", "0")
+
+	t.Setenv("SRS_READY_TIMEOUT", "300ms")
+
+	srs, err := NewServer(":1935")
+
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	if err := srs.Start(); err == nil {
+		t.Fatalf("Start succeeded with an SRS that never answered")
+	}
+
+	data, err := os.ReadFile(pidPath)
+
+	if err != nil {
+		t.Fatalf("SRS was never started: %v", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+
+	if err != nil {
+		t.Fatalf("invalid PID %q", data)
+	}
+
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("SRS is still running after Start failed: %v", err)
+	}
+
+}
@@ -1,35 +1,58 @@
 package rtmpserver
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
-	"strings"
 	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+	"github.com/OODemi52/chronocast-server/internal/utils"
 )
 
-type StreamDestination struct {
-	URL       string
-	StreamKey string
-}
-
-type Stream struct {
-	Key          string
-	Destinations []StreamDestination
-}
+var _ mediaserver.MediaServer = (*SimpleRealtimeServer)(nil)
 
+// SimpleRealtimeServer is the SRS implementation of mediaserver.MediaServer.
 type SimpleRealtimeServer struct {
 	Port        string
 	ConfigPath  string
 	SRSPath     string
 	SRSProcess  *os.Process
-	Streams     map[string]*Stream
+	Streams     map[string]*mediaserver.Stream
 	StreamsLock sync.RWMutex
 	ConfigDir   string
+	Hooks       config.HookConfig
+	Config      config.SRSConfig
+	Public      config.PublicConfig
+	API         *srsapi.Client
+	Mode        SRSMode
+	Process     config.SRSProcessConfig
+
+	publishers *mediaserver.PublisherRegistry
+	handler    mediaserver.IngestHandler
+	bus        *events.Bus
+	activity   *events.Activity
+
+	webrtcSessions map[string]webrtcSession
+	webrtcLock     sync.Mutex
+
+	// frameSamples holds recent frame counts by SRS stream ID, to give the
+	// ingest frame rate.
+	frameSamples     map[string][]frameSample
+	frameSamplesLock sync.Mutex
+
+	// processLock guards SRSProcess and the supervisor state in process mode.
+	processLock   sync.Mutex
+	processExited chan struct{}
+	stopProcess   chan struct{}
+	stopping      bool
 }
 
 func NewServer(port string) (*SimpleRealtimeServer, error) {
@@ -42,230 +65,271 @@ func NewServer(port string) (*SimpleRealtimeServer, error) {
 		return nil, fmt.Errorf("CONFIG_PATH and SRS_PATH must be set")
 	}
 
-	return &SimpleRealtimeServer{
-		Port:       port,
-		ConfigPath: configPath,
-		SRSPath:    srsPath,
-		Streams:    make(map[string]*Stream),
-	}, nil
+	publishers, err := mediaserver.NewPublisherRegistry(config.GetPublisherConfig().Policy)
 
-}
-
-func (srs *SimpleRealtimeServer) Start() error {
-
-	log.Println("RTMP Server started via Docker, checking it's status..")
+	if err != nil {
+		return nil, err
+	}
 
-	apiURL := "http://localhost:1985/api/v1/versions"
+	processConfig := config.GetSRSProcessConfig()
 
-	resp, err := http.Get(apiURL)
+	mode, err := parseSRSMode(processConfig.Mode)
 
-	if err == nil && resp.StatusCode == http.StatusOK {
-		log.Println("RTMP server is already running.")
-		return nil
+	if err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	public := config.GetPublicConfig()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("RTMP server returned unexpected status: %s", resp.Status)
+	if err := validatePublicConfig(public); err != nil {
+		return nil, err
 	}
 
-	log.Printf("RTMP server is running and reachable at port %s.", srs.Port)
+	hooks := config.GetHookConfig()
 
-	return nil
+	if hooks.Secret == "" {
 
-}
-
-func (srs *SimpleRealtimeServer) Stop() error {
+		secret, err := utils.GenerateRandomString()
 
-	log.Println("Stopping RTMP server via Docker...")
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate hook secret: %v", err)
+		}
 
-	cmd := exec.Command("docker", "ps", "-q", "--filter", "ancestor=ossrs/srs:latest")
+		log.Println("Warning: HOOK_SECRET is not set, using a random hook secret for this run")
 
-	containerID, err := cmd.Output()
+		hooks.Secret = secret
 
-	if err != nil || len(containerID) == 0 {
-		return fmt.Errorf("failed to find SRS container: %v", err)
 	}
 
-	stopCmd := exec.Command("docker", "stop", strings.TrimSpace(string(containerID)))
+	apiConfig := config.GetSRSAPIConfig()
 
-	output, err := stopCmd.CombinedOutput()
+	api, err := srsapi.NewClient(apiConfig.BaseURL,
+		srsapi.WithTimeout(apiConfig.Timeout),
+		srsapi.WithRetries(apiConfig.Retries, 250*time.Millisecond),
+	)
 
 	if err != nil {
-		return fmt.Errorf("failed to stop the RTMP server via Docker: %v, output: %s", err, output)
+		return nil, err
 	}
 
-	log.Println("RTMP server stopped successfully.")
+	bus := events.NewBus()
 
-	return nil
+	return &SimpleRealtimeServer{
+		Port:        port,
+		ConfigPath:  configPath,
+		SRSPath:     srsPath,
+		Streams:     make(map[string]*mediaserver.Stream),
+		publishers:  publishers,
+		bus:         bus,
+		activity:    events.NewActivity(bus),
+		Hooks:       hooks,
+		Config:      config.GetSRSConfig(),
+		Public:      public,
+		API:         api,
+		Mode:        mode,
+		Process:     processConfig,
+		stopProcess: make(chan struct{}),
+
+		webrtcSessions: make(map[string]webrtcSession),
+		frameSamples:   make(map[string][]frameSample),
+	}, nil
 
 }
 
-func (srs *SimpleRealtimeServer) Reload() error {
+// Start brings SRS up according to the server's mode: in process mode SRS
+// is launched and supervised, otherwise it is expected to be running
+// already and is only checked.
+func (srs *SimpleRealtimeServer) Start() error {
 
-	log.Println("Reloading RTMP server configuration...")
+	if srs.Mode == SRSModeProcess {
+		return srs.startProcess()
+	}
 
-	apiURL := "http://localhost:1985/api/v1/servers"
+	if srs.Mode == SRSModeDocker {
+		log.Println("RTMP Server started via Docker, checking it's status..")
+	} else {
+		log.Println("RTMP Server is managed externally, checking it's status..")
+	}
 
-	req, err := http.NewRequest("PUT", apiURL, strings.NewReader(`{"action":"reload"}`))
+	version, err := srs.API.Versions(context.Background())
 
 	if err != nil {
-		return fmt.Errorf("failed to create reload request: %v", err)
+		return fmt.Errorf("RTMP server is not reachable at %s: %v", srs.API.BaseURL(), err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	log.Printf("RTMP server %s is running and reachable at port %s.", version.Version, srs.Port)
 
-	if err != nil {
-		return fmt.Errorf("failed to reload RTMP server: %v", err)
-	}
+	return nil
+
+}
+
+func (srs *SimpleRealtimeServer) Stop() error {
+
+	switch srs.Mode {
+
+	case SRSModeProcess:
+		return srs.stopSRSProcess()
 
-	defer resp.Body.Close()
+	case SRSModeDocker:
+		return srs.stopDockerContainer()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("RTMP server returned unexpected status during reload: %s", resp.Status)
 	}
 
-	log.Println("RTMP server configuration reloaded successfully.")
+	log.Println("RTMP server is managed externally, leaving it running.")
 
 	return nil
 
 }
 
-func (srs *SimpleRealtimeServer) AddStream(key string, destinations []StreamDestination) error {
+func (srs *SimpleRealtimeServer) Reload() error {
 
-	if key == "" {
-		return fmt.Errorf("stream key cannot be empty")
-	}
+	log.Println("Reloading RTMP server configuration...")
 
-	if len(destinations) == 0 {
-		return fmt.Errorf("destinations cannot be empty")
+	if err := srs.API.Reload(context.Background()); err != nil {
+		return fmt.Errorf("failed to reload RTMP server: %v", err)
 	}
 
-	log.Printf("Adding stream with key: %s and %d destinations...", key, len(destinations))
+	log.Println("RTMP server configuration reloaded successfully.")
 
-	for i, dest := range destinations {
-		log.Printf("Destination %d: URL=%s, StreamKey=%s", i, dest.URL, dest.StreamKey)
-	}
+	return nil
+
+}
+
+// Health reports whether the SRS API answers.
+func (srs *SimpleRealtimeServer) Health(ctx context.Context) mediaserver.Health {
 
-	payload := map[string]any{
-		"id":           key,
-		"destinations": destinations,
+	health := mediaserver.Health{
+		Backend:   "srs",
+		CheckedAt: time.Now(),
 	}
 
-	jsonPayload, err := json.Marshal(payload)
+	version, err := srs.API.Versions(ctx)
 
 	if err != nil {
-		return fmt.Errorf("failed to convert payload to json: %v", err)
+		health.Error = err.Error()
+		return health
 	}
 
-	apiURL := "http://localhost:1985/api/v1/streams"
+	health.Version = version.Version
 
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(string(jsonPayload)))
+	health.Healthy = true
 
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %v", err)
-	}
+	return health
+
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// AddStream registers a stream under the ID of its stream key. The key
+// itself is only learned when an encoder publishes with it. SRS creates its
+// side of the stream when the encoder connects, so this is bookkeeping for
+// the relays.
+func (srs *SimpleRealtimeServer) AddStream(id string, destinations []mediaserver.StreamDestination) error {
 
-	resp, err := http.DefaultClient.Do(req)
+	if id == "" {
+		return fmt.Errorf("stream ID cannot be empty")
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to send HTTP request to SRS API: %v", err)
+	if len(destinations) == 0 {
+		return fmt.Errorf("destinations cannot be empty")
 	}
 
-	defer resp.Body.Close()
+	log.Printf("Adding stream %s with %d destinations...", id, len(destinations))
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("RTMP server returned unexpected status: %s, body: %s", resp.Status, string(body))
+	for i, dest := range destinations {
+		log.Printf("Destination %d: URL=%s, StreamKey=%s", i, dest.URL, auth.MaskStreamKey(dest.StreamKey))
 	}
 
-	log.Println("Stream added successfully added.")
-
 	srs.StreamsLock.Lock()
 
 	defer srs.StreamsLock.Unlock()
 
-	srs.Streams[key] = &Stream{
-		Key:          key,
+	srs.Streams[id] = &mediaserver.Stream{
+		ID:           id,
 		Destinations: destinations,
 	}
 
+	log.Println("Stream added successfully added.")
+
 	return nil
 
 }
 
-func (srs *SimpleRealtimeServer) RemoveStream(key string) error {
+func (srs *SimpleRealtimeServer) GetStream(id string) (*mediaserver.Stream, bool) {
 
-	if key == "" {
-		return fmt.Errorf("stream key cannot be empty")
-	}
+	srs.StreamsLock.RLock()
 
-	log.Printf("Removing stream with key: %s ...", key)
+	defer srs.StreamsLock.RUnlock()
 
-	apiURL := fmt.Sprintf("http://localhost:1985/api/v1/streams/%s", key)
+	stream, exists := srs.Streams[id]
 
-	req, err := http.NewRequest("DELETE", apiURL, nil)
+	return stream, exists
 
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %v", err)
-	}
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// RemoveStream forgets a stream and disconnects its publisher, if any.
+func (srs *SimpleRealtimeServer) RemoveStream(id string) error {
 
-	if err != nil {
-		return fmt.Errorf("failed to send HTTP request to SRS API: %v", err)
+	if _, exists := srs.GetStream(id); !exists {
+		return fmt.Errorf("stream %s not found", id)
 	}
 
-	defer resp.Body.Close()
+	log.Printf("Removing stream %s ...", id)
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("RTMP server returned unexpected status: %s, body: %s", resp.Status, string(body))
-	}
+	if publisher, publishing := srs.publishers.Active(id); publishing {
 
-	log.Println("Stream removed successfully.")
+		if err := srs.KickClient(publisher.ClientID); err != nil && !errors.Is(err, mediaserver.ErrClientNotFound) {
+			return err
+		}
+
+	}
 
 	srs.StreamsLock.Lock()
 
 	defer srs.StreamsLock.Unlock()
 
-	delete(srs.Streams, key)
+	delete(srs.Streams, id)
+
+	log.Println("Stream removed successfully.")
 
 	return nil
 
 }
 
-func (srs *SimpleRealtimeServer) GetIngestURL(streamKey string) string {
+// KickClient disconnects an SRS client, such as a publisher that has been
+// replaced on its stream key.
+func (srs *SimpleRealtimeServer) KickClient(clientID string) error {
 
-	if streamKey == "" {
-		log.Println("Stream key is empty. Returning an empty ingest URL.")
-		return ""
+	if clientID == "" {
+		return fmt.Errorf("client ID cannot be empty")
 	}
-	//TODO - Make this work for production server and get the info dynamically
-	host := "localhost"
 
-	port := srs.Port
+	err := srs.API.KickClient(context.Background(), clientID)
 
-	if port[0] == ':' {
-		port = port[1:]
+	if errors.Is(err, srsapi.ErrNotFound) {
+		return fmt.Errorf("failed to disconnect client %s: %w", clientID, mediaserver.ErrClientNotFound)
 	}
 
-	return fmt.Sprintf("rtmp://%s:%s/live/%s", host, port, streamKey)
+	if err != nil {
+		return fmt.Errorf("failed to disconnect client %s: %w", clientID, err)
+	}
+
+	log.Printf("Client %s disconnected.", clientID)
+
+	return nil
 
 }
 
-func (srs *SimpleRealtimeServer) GetHLSURL(streamKey string) string {
+func (srs *SimpleRealtimeServer) Publishers() *mediaserver.PublisherRegistry {
+	return srs.publishers
+}
 
-	if streamKey == "" {
-		log.Println("Stream key is empty. Returning an empty HLS URL.")
-		return ""
-	}
-	//TODO - Make this work for production server and get the info dynamically
-	host := "localhost"
+func (srs *SimpleRealtimeServer) Events() *events.Bus {
+	return srs.bus
+}
 
-	return fmt.Sprintf("http://%s:8080/hls/%s.m3u8", host, streamKey)
+func (srs *SimpleRealtimeServer) Activity() *events.Activity {
+	return srs.activity
+}
 
+func (srs *SimpleRealtimeServer) HookConfig() config.HookConfig {
+	return srs.Hooks
 }
@@ -0,0 +1,173 @@
+package rtmpserver
+
+import (
+	_ "embed"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+)
+
+//go:embed srs.conf.tmpl
+var srsConfigTemplate string
+
+var srsConfigFuncs = template.FuncMap{
+	"seconds": func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	},
+	"milliseconds": func(d time.Duration) int64 {
+		return d.Milliseconds()
+	},
+	"onoff": func(enabled bool) string {
+		if enabled {
+			return "on"
+		}
+		return "off"
+	},
+}
+
+// srsConfigData is everything srs.conf is rendered from.
+type srsConfigData struct {
+	config.SRSConfig
+	RTMPPort    string
+	APIPort     string
+	HookBaseURL string
+	HookQuery   string
+	SRTEnabled  bool
+}
+
+// RenderConfig renders srs.conf from the server's configuration. The RTMP
+// port is the one the server was started with, the API port the one in the
+// SRS API URL, and the hooks point at the API server and carry the hook
+// secret, so SRS and chronocast-server always agree on them.
+func (srs *SimpleRealtimeServer) RenderConfig() (string, error) {
+
+	if err := validateSRSConfig(srs.Config); err != nil {
+		return "", err
+	}
+
+	apiURL, err := url.Parse(srs.API.BaseURL())
+
+	if err != nil || apiURL.Port() == "" {
+		return "", fmt.Errorf("SRS API URL %q must include the API port", srs.API.BaseURL())
+	}
+
+	tmpl, err := template.New("srs.conf").Funcs(srsConfigFuncs).Parse(srsConfigTemplate)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SRS config template: %v", err)
+	}
+
+	query := ""
+
+	// A signing proxy between SRS and the server adds the secret, so it
+	// need not be written into srs.conf.
+	if srs.Hooks.Secret != "" && !srs.Hooks.RequireSignature {
+		query = "?" + url.Values{"secret": {srs.Hooks.Secret}}.Encode()
+	}
+
+	var conf strings.Builder
+
+	if err := tmpl.Execute(&conf, srsConfigData{
+		SRSConfig:   srs.Config,
+		RTMPPort:    portNumber(srs.Port),
+		APIPort:     apiURL.Port(),
+		HookBaseURL: strings.TrimSuffix(srs.Hooks.BaseURL, "/"),
+		HookQuery:   query,
+		SRTEnabled:  slices.Contains(srs.Public.IngestProtocols, mediaserver.ProtocolSRT),
+	}); err != nil {
+		return "", fmt.Errorf("failed to render SRS config: %v", err)
+	}
+
+	return conf.String(), nil
+
+}
+
+// WriteConfig renders srs.conf and writes it to ConfigPath, where SRS
+// reads it from.
+func (srs *SimpleRealtimeServer) WriteConfig() error {
+
+	conf, err := srs.RenderConfig()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(srs.ConfigPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create SRS config directory: %v", err)
+	}
+
+	// The file holds the hook secret.
+	if err := os.WriteFile(srs.ConfigPath, []byte(conf), 0o600); err != nil {
+		return fmt.Errorf("failed to write SRS config: %v", err)
+	}
+
+	return nil
+
+}
+
+// ApplyConfig writes srs.conf and has the running SRS reload it.
+func (srs *SimpleRealtimeServer) ApplyConfig() error {
+
+	if err := srs.WriteConfig(); err != nil {
+		return err
+	}
+
+	return srs.Reload()
+
+}
+
+func validateSRSConfig(cfg config.SRSConfig) error {
+
+	for name, port := range map[string]int{"HTTP": cfg.HTTPPort, "RTC": cfg.RTCPort, "SRT": cfg.SRT.Port} {
+
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid SRS %s port %d", name, port)
+		}
+
+	}
+
+	// WebRTC media and SRT both use UDP.
+	if cfg.SRT.Port == cfg.RTCPort {
+		return fmt.Errorf("SRS SRT and RTC ports must differ, both are %d", cfg.RTCPort)
+	}
+
+	if cfg.SRT.Latency <= 0 {
+		return fmt.Errorf("SRT latency must be positive")
+	}
+
+	if cfg.HLS.Fragment <= 0 || cfg.HLS.Window < cfg.HLS.Fragment {
+		return fmt.Errorf("HLS window (%s) must be at least one fragment (%s) long", cfg.HLS.Window, cfg.HLS.Fragment)
+	}
+
+	if cfg.DVR.Plan != "session" && cfg.DVR.Plan != "segment" {
+		return fmt.Errorf("unknown DVR plan %q, expected \"session\" or \"segment\"", cfg.DVR.Plan)
+	}
+
+	if cfg.DVR.Plan == "segment" && cfg.DVR.Duration <= 0 {
+		return fmt.Errorf("DVR segment duration must be positive")
+	}
+
+	return nil
+
+}
+
+// portNumber takes the port out of a listen address such as ":1935".
+func portNumber(addr string) string {
+
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return port
+	}
+
+	return strings.TrimPrefix(addr, ":")
+
+}
@@ -0,0 +1,205 @@
+package rtmpserver
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderConfig(t *testing.T) {
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want maps a block of srs.conf to directives it must contain,
+		// compared with the spacing collapsed.
+		want    map[string][]string
+		missing []string
+		err     bool
+	}{
+		{
+			name: "ports",
+			env:  map[string]string{"SRS_API_URL": "http://srs:2985", "SRS_HTTP_PORT": "8090"},
+			want: map[string][]string{
+				"http_api":    {"listen 2985;"},
+				"http_server": {"listen 8090;"},
+			},
+		},
+		{
+			name: "raw API allows reloads",
+			want: map[string][]string{
+				"raw_api": {"enabled on;", "allow_reload on;"},
+			},
+		},
+		{
+			name: "hooks carry the secret",
+			env:  map[string]string{"HOOK_SECRET": "s&t", "HOOK_BASE_URL": "http://api:8081/"},
+			want: map[string][]string{
+				"http_hooks": {
+					"enabled on;",
+					"on_publish http://api:8081/api/rtmp/published?secret=s%26t;",
+					"on_unpublish http://api:8081/api/rtmp/unpublished?secret=s%26t;",
+					"on_hls http://api:8081/api/rtmp/hls?secret=s%26t;",
+				},
+			},
+		},
+		{
+			name: "signed hooks leave the secret out",
+			env:  map[string]string{"HOOK_SECRET": "s&t", "HOOK_BASE_URL": "http://api:8081", "HOOK_REQUIRE_SIGNATURE": "true"},
+			want: map[string][]string{
+				"http_hooks": {"on_publish http://api:8081/api/rtmp/published;"},
+			},
+			missing: []string{"s%26t"},
+		},
+		{
+			name: "SRT is off unless it is an ingest protocol",
+			want: map[string][]string{
+				"srt_server": {"enabled off;"},
+				"srt":        {"enabled off;"},
+			},
+		},
+		{
+			name: "SRT ingest",
+			env:  map[string]string{"INGEST_PROTOCOLS": "rtmp,srt", "SRS_SRT_PORT": "10090", "SRS_SRT_LATENCY": "200ms"},
+			want: map[string][]string{
+				"srt_server": {"enabled on;", "listen 10090;", "latency 200;", "recvlatency 200;", "peerlatency 200;"},
+				"srt":        {"enabled on;", "srt_to_rtmp on;"},
+			},
+		},
+		{
+			name: "WebRTC",
+			env:  map[string]string{"SRS_RTC_PORT": "8000", "SRS_RTC_CANDIDATE": "203.0.113.5"},
+			want: map[string][]string{
+				"rtc_server": {"enabled on;", "listen 8000;", "protocol udp;", "candidate 203.0.113.5;"},
+				"rtc":        {"enabled on;", "rtc_to_rtmp on;", "rtmp_to_rtc on;"},
+			},
+		},
+		{
+			name: "SRT and WebRTC on the same port",
+			env:  map[string]string{"SRS_RTC_PORT": "10081", "SRS_SRT_PORT": "10081"},
+			err:  true,
+		},
+		{
+			name: "API URL without a port",
+			env:  map[string]string{"SRS_API_URL": "http://srs"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "srs.conf"))
+
+			t.Setenv("SRS_PATH", "/usr/local/srs/objs/srs")
+
+			t.Setenv("SRS_MODE", "external")
+
+			t.Setenv("SRS_API_URL", "http://localhost:1985")
+
+			t.Setenv("HOOK_SECRET", "secret")
+
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			srs, err := NewServer(":1935")
+
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			conf, err := srs.RenderConfig()
+
+			if test.err {
+
+				if err == nil {
+					t.Fatal("RenderConfig succeeded, want an error")
+				}
+
+				return
+
+			}
+
+			if err != nil {
+				t.Fatalf("RenderConfig: %v", err)
+			}
+
+			for name, directives := range test.want {
+
+				block := configBlock(conf, name)
+
+				if block == nil {
+					t.Fatalf("srs.conf has no %s block:\n%s", name, conf)
+				}
+
+				for _, directive := range directives {
+					if !hasDirective(block, directive) {
+						t.Fatalf("%s block has no %q:\n%s", name, directive, strings.Join(block, "\n"))
+					}
+				}
+
+			}
+
+			for _, text := range test.missing {
+				if strings.Contains(conf, text) {
+					t.Fatalf("srs.conf contains %q:\n%s", text, conf)
+				}
+			}
+
+		})
+
+	}
+
+}
+
+// configBlock returns the lines of the first block with the given name, with
+// their spacing collapsed, or nil if there is none.
+func configBlock(conf, name string) []string {
+
+	var block []string
+
+	depth := 0
+
+	for _, line := range strings.Split(conf, "\n") {
+
+		line = strings.Join(strings.Fields(line), " ")
+
+		if depth == 0 {
+
+			if line == name+" {" {
+				depth = 1
+			}
+
+			continue
+
+		}
+
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+
+		if depth == 0 {
+			return block
+		}
+
+		block = append(block, line)
+
+	}
+
+	return nil
+
+}
+
+// hasDirective reports whether a line of block is the directive, ignoring a
+// trailing comment.
+func hasDirective(block []string, directive string) bool {
+
+	for _, line := range block {
+		if line == directive || strings.HasPrefix(line, directive+" #") {
+			return true
+		}
+	}
+
+	return false
+
+}
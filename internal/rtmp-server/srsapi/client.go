@@ -0,0 +1,357 @@
+package srsapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultRetries      = 2
+	defaultRetryBackoff = 250 * time.Millisecond
+
+	// listCount is how many streams or clients are asked for in one page.
+	listCount = 1000
+
+	// SRS error codes for lookups of streams and clients that do not exist.
+	codeStreamNotFound = 2048
+	codeClientNotFound = 2049
+)
+
+var ErrNotFound = errors.New("not found in SRS")
+
+// APIError is a failed SRS API call: an unexpected HTTP status, or a
+// response whose "code" is not 0.
+type APIError struct {
+	Method string
+	Path   string
+	Status int
+	Code   int
+}
+
+func (e *APIError) Error() string {
+
+	if e.Code != 0 {
+		return fmt.Sprintf("SRS %s %s returned code %d", e.Method, e.Path, e.Code)
+	}
+
+	return fmt.Sprintf("SRS %s %s returned status %d", e.Method, e.Path, e.Status)
+
+}
+
+// Client talks to the SRS HTTP API (/api/v1). Requests time out, and
+// failed GET and DELETE requests are retried with a growing delay.
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	retries      int
+	retryBackoff time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout sets the request timeout on a copy of the HTTP client, so a
+// client passed to WithHTTPClient, such as http.DefaultClient, is left as
+// it is.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		httpClient := *c.httpClient
+		httpClient.Timeout = timeout
+		c.httpClient = &httpClient
+	}
+}
+
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryBackoff = backoff
+	}
+}
+
+// NewClient returns a client for the SRS API at baseURL, e.g.
+// "http://localhost:1985".
+func NewClient(baseURL string, options ...Option) (*Client, error) {
+
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid SRS API URL %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:      parsed,
+		httpClient:   &http.Client{Timeout: defaultTimeout},
+		retries:      defaultRetries,
+		retryBackoff: defaultRetryBackoff,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c, nil
+
+}
+
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+func (c *Client) Versions(ctx context.Context) (Version, error) {
+
+	var response struct {
+		Data Version `json:"data"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/api/v1/versions", nil, &response)
+
+	return response.Data, err
+
+}
+
+func (c *Client) Summaries(ctx context.Context) (Summary, error) {
+
+	var response struct {
+		Data Summary `json:"data"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/api/v1/summaries", nil, &response)
+
+	return response.Data, err
+
+}
+
+func (c *Client) Vhosts(ctx context.Context) ([]Vhost, error) {
+
+	var response struct {
+		Vhosts []Vhost `json:"vhosts"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/api/v1/vhosts", nil, &response)
+
+	return response.Vhosts, err
+
+}
+
+func (c *Client) Streams(ctx context.Context) ([]Stream, error) {
+
+	var response struct {
+		Streams []Stream `json:"streams"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/api/v1/streams", listQuery(), &response)
+
+	return response.Streams, err
+
+}
+
+// Stream looks a stream up by its SRS ID (not its name).
+func (c *Client) Stream(ctx context.Context, id string) (Stream, error) {
+
+	var response struct {
+		Stream *Stream `json:"stream"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/streams/"+url.PathEscape(id), nil, &response); err != nil {
+		return Stream{}, err
+	}
+
+	if response.Stream == nil {
+		return Stream{}, ErrNotFound
+	}
+
+	return *response.Stream, nil
+
+}
+
+// StreamByName finds a stream by app and name, e.g. "live" and the key it
+// was published under.
+func (c *Client) StreamByName(ctx context.Context, app, name string) (Stream, error) {
+
+	streams, err := c.Streams(ctx)
+
+	if err != nil {
+		return Stream{}, err
+	}
+
+	for _, stream := range streams {
+		if stream.App == app && stream.Name == name {
+			return stream, nil
+		}
+	}
+
+	return Stream{}, ErrNotFound
+
+}
+
+func (c *Client) Clients(ctx context.Context) ([]ClientInfo, error) {
+
+	var response struct {
+		Clients []ClientInfo `json:"clients"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/api/v1/clients", listQuery(), &response)
+
+	return response.Clients, err
+
+}
+
+func (c *Client) Client(ctx context.Context, id string) (ClientInfo, error) {
+
+	var response struct {
+		Client *ClientInfo `json:"client"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/clients/"+url.PathEscape(id), nil, &response); err != nil {
+		return ClientInfo{}, err
+	}
+
+	if response.Client == nil {
+		return ClientInfo{}, ErrNotFound
+	}
+
+	return *response.Client, nil
+
+}
+
+// KickClient disconnects a publisher or player.
+func (c *Client) KickClient(ctx context.Context, id string) error {
+
+	return c.do(ctx, http.MethodDelete, "/api/v1/clients/"+url.PathEscape(id), nil, nil)
+
+}
+
+// Reload asks SRS to reread its config file. It needs raw_api with
+// allow_reload enabled in srs.conf.
+func (c *Client) Reload(ctx context.Context) error {
+
+	return c.do(ctx, http.MethodGet, "/api/v1/raw", url.Values{"rpc": {"reload"}}, nil)
+
+}
+
+func listQuery() url.Values {
+
+	return url.Values{
+		"start": {"0"},
+		"count": {fmt.Sprint(listCount)},
+	}
+
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out any) error {
+
+	endpoint := *c.baseURL
+
+	endpoint.Path += path
+
+	endpoint.RawQuery = query.Encode()
+
+	var err error
+
+	for attempt := 0; ; attempt++ {
+
+		err = c.attempt(ctx, method, endpoint.String(), path, out)
+
+		if err == nil || attempt >= c.retries || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		delay := c.retryBackoff << attempt
+
+		select {
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(delay):
+
+		}
+
+	}
+
+}
+
+func (c *Client) attempt(ctx context.Context, method, endpoint, path string, out any) error {
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to create SRS API request: %v", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("failed to reach SRS API: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+
+	if err != nil {
+		return fmt.Errorf("failed to read SRS API response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Method: method, Path: path, Status: resp.StatusCode}
+	}
+
+	var envelope struct {
+		Code int `json:"code"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("failed to decode SRS API response: %v", err)
+	}
+
+	if envelope.Code == codeStreamNotFound || envelope.Code == codeClientNotFound {
+		return ErrNotFound
+	}
+
+	if envelope.Code != 0 {
+		return &APIError{Method: method, Path: path, Status: resp.StatusCode, Code: envelope.Code}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode SRS API response: %v", err)
+	}
+
+	return nil
+
+}
+
+// retryable reports whether a failed call may succeed if tried again:
+// network errors and server side failures, but not SRS rejecting the call.
+func retryable(err error) bool {
+
+	var apiErr *APIError
+
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 0 && apiErr.Status >= http.StatusInternalServerError
+	}
+
+	return !errors.Is(err, ErrNotFound)
+
+}
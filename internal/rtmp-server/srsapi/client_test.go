@@ -0,0 +1,233 @@
+package srsapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi/srsapitest"
+)
+
+func TestClient(t *testing.T) {
+
+	fake := srsapitest.NewServer()
+
+	defer fake.Close()
+
+	fake.AddStream(srsapi.Stream{ID: "vid-1", App: "live", Name: "key-1"})
+
+	fake.AddClient(srsapi.ClientInfo{ID: "client-1", Stream: "vid-1", Publish: true})
+
+	client := fake.NewClient()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() error
+		err  error
+	}{
+		{
+			name: "versions",
+			run: func() error {
+
+				version, err := client.Versions(ctx)
+
+				if err == nil && version.Major != 5 {
+					t.Errorf("got major version %d, want 5", version.Major)
+				}
+
+				return err
+
+			},
+		},
+		{
+			name: "stream by name",
+			run: func() error {
+
+				stream, err := client.StreamByName(ctx, "live", "key-1")
+
+				if err == nil && stream.ID != "vid-1" {
+					t.Errorf("got stream %q, want vid-1", stream.ID)
+				}
+
+				return err
+
+			},
+		},
+		{
+			name: "missing stream by name",
+			run: func() error {
+				_, err := client.StreamByName(ctx, "live", "key-2")
+				return err
+			},
+			err: srsapi.ErrNotFound,
+		},
+		{
+			name: "missing stream",
+			run: func() error {
+				_, err := client.Stream(ctx, "vid-2")
+				return err
+			},
+			err: srsapi.ErrNotFound,
+		},
+		{
+			name: "clients",
+			run: func() error {
+
+				clients, err := client.Clients(ctx)
+
+				if err == nil && (len(clients) != 1 || clients[0].ID != "client-1") {
+					t.Errorf("got clients %+v, want client-1", clients)
+				}
+
+				return err
+
+			},
+		},
+		{
+			name: "missing client",
+			run: func() error {
+				_, err := client.Client(ctx, "client-2")
+				return err
+			},
+			err: srsapi.ErrNotFound,
+		},
+		{
+			name: "reload",
+			run: func() error {
+
+				err := client.Reload(ctx)
+
+				if err == nil && fake.Reloads() != 1 {
+					t.Errorf("got %d reloads, want 1", fake.Reloads())
+				}
+
+				return err
+
+			},
+		},
+		{
+			name: "kick client",
+			run: func() error {
+
+				err := client.KickClient(ctx, "client-1")
+
+				if kicked := fake.Kicked(); err == nil && (len(kicked) != 1 || kicked[0] != "client-1") {
+					t.Errorf("got kicked %v, want client-1", kicked)
+				}
+
+				return err
+
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			if err := test.run(); !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+		})
+
+	}
+
+}
+
+func TestClientRetries(t *testing.T) {
+
+	fake := srsapitest.NewServer()
+
+	defer fake.Close()
+
+	tests := []struct {
+		name     string
+		retries  int
+		failures []int
+		status   int
+	}{
+		{name: "recovers within the retries", retries: 2, failures: []int{http.StatusBadGateway, http.StatusServiceUnavailable}},
+		{name: "gives up after the retries", retries: 1, failures: []int{http.StatusBadGateway, http.StatusBadGateway}, status: http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			fake.FailNext(test.failures...)
+
+			_, err := fake.NewClient(srsapi.WithRetries(test.retries, time.Millisecond)).Versions(context.Background())
+
+			var apiErr *srsapi.APIError
+
+			switch {
+
+			case test.status == 0 && err != nil:
+				t.Fatalf("got error %v, want none", err)
+
+			case test.status != 0 && (!errors.As(err, &apiErr) || apiErr.Status != test.status):
+				t.Fatalf("got error %v, want status %d", err, test.status)
+
+			}
+
+		})
+
+	}
+
+}
+
+func TestClientWebRTC(t *testing.T) {
+
+	fake := srsapitest.NewServer()
+
+	defer fake.Close()
+
+	client := fake.NewClient()
+
+	session, err := client.WHIP(context.Background(), "live", "key-1", "v=0\r\n")
+
+	if err != nil {
+		t.Fatalf("WHIP: %v", err)
+	}
+
+	if session.Answer == "" || session.Location == "" {
+		t.Fatalf("got session %+v, want an answer and a location", session)
+	}
+
+	if len(fake.WebRTCSessions()) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(fake.WebRTCSessions()))
+	}
+
+	if err := client.DeleteWebRTCSession(context.Background(), session.Location); err != nil {
+		t.Fatalf("DeleteWebRTCSession: %v", err)
+	}
+
+	if len(fake.WebRTCSessions()) != 0 {
+		t.Fatalf("the session is still open after it was deleted")
+	}
+
+}
+
+func TestWithTimeoutCopiesTheHTTPClient(t *testing.T) {
+
+	httpClient := &http.Client{}
+
+	if _, err := srsapi.NewClient("http://localhost:1985", srsapi.WithHTTPClient(httpClient), srsapi.WithTimeout(time.Second)); err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if _, err := srsapi.NewClient("http://localhost:1985", srsapi.WithHTTPClient(http.DefaultClient), srsapi.WithTimeout(time.Second)); err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if httpClient.Timeout != 0 || http.DefaultClient.Timeout != 0 {
+		t.Fatalf("WithTimeout changed the HTTP client passed in")
+	}
+
+}
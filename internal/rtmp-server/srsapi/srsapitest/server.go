@@ -0,0 +1,296 @@
+// Package srsapitest provides an in-memory fake of the SRS HTTP API for
+// exercising code that talks to SRS without running it.
+package srsapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+)
+
+// Server is a fake SRS API. Streams and clients are whatever the test puts
+// in; kicking a client removes it, reloads are counted and WebRTC offers
+// are answered with a stub SDP.
+type Server struct {
+	*httptest.Server
+
+	Version srsapi.Version
+	Summary srsapi.Summary
+
+	streams  map[string]srsapi.Stream
+	clients  map[string]srsapi.ClientInfo
+	vhosts   []srsapi.Vhost
+	kicked   []string
+	sessions map[string]string
+	nextID   int
+	reloads  int
+	failures []int
+	lock     sync.Mutex
+}
+
+func NewServer() *Server {
+
+	s := &Server{
+		Version:  srsapi.Version{Major: 5, Minor: 0, Revision: 0, Version: "5.0.0"},
+		Summary:  srsapi.Summary{OK: true},
+		streams:  make(map[string]srsapi.Stream),
+		clients:  make(map[string]srsapi.ClientInfo),
+		sessions: make(map[string]string),
+		vhosts: []srsapi.Vhost{
+			{ID: "vid-default", Name: "__defaultVhost__", Enabled: true},
+		},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+
+}
+
+// NewClient returns an srsapi client for the fake with retries disabled.
+func (s *Server) NewClient(options ...srsapi.Option) *srsapi.Client {
+
+	client, err := srsapi.NewClient(s.URL, append([]srsapi.Option{srsapi.WithRetries(0, 0)}, options...)...)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+
+}
+
+func (s *Server) AddStream(stream srsapi.Stream) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	s.streams[stream.ID] = stream
+
+}
+
+func (s *Server) RemoveStream(id string) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	delete(s.streams, id)
+
+}
+
+func (s *Server) AddClient(client srsapi.ClientInfo) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	s.clients[client.ID] = client
+
+}
+
+// Kicked returns the IDs of the clients disconnected through the API.
+func (s *Server) Kicked() []string {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.kicked...)
+
+}
+
+// WebRTCSessions returns the open WHIP and WHEP sessions by ID, with the
+// stream each is on.
+func (s *Server) WebRTCSessions() map[string]string {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	sessions := make(map[string]string, len(s.sessions))
+
+	for id, stream := range s.sessions {
+		sessions[id] = stream
+	}
+
+	return sessions
+
+}
+
+func (s *Server) Reloads() int {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	return s.reloads
+
+}
+
+// FailNext makes the next requests fail with the given HTTP statuses, one
+// per request, to exercise retries.
+func (s *Server) FailNext(statuses ...int) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	s.failures = append(s.failures, statuses...)
+
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+
+	s.lock.Lock()
+
+	defer s.lock.Unlock()
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+
+	case r.Method == http.MethodGet && path == "/api/v1/versions":
+		writeOK(w, map[string]any{"data": s.Version})
+
+	case r.Method == http.MethodGet && path == "/api/v1/summaries":
+		writeOK(w, map[string]any{"data": s.Summary})
+
+	case r.Method == http.MethodGet && path == "/api/v1/vhosts":
+		writeOK(w, map[string]any{"vhosts": s.vhosts})
+
+	case r.Method == http.MethodGet && path == "/api/v1/streams":
+		streams := []srsapi.Stream{}
+
+		for _, stream := range s.streams {
+			streams = append(streams, stream)
+		}
+
+		writeOK(w, map[string]any{"streams": streams})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/v1/streams/"):
+		stream, exists := s.streams[strings.TrimPrefix(path, "/api/v1/streams/")]
+
+		if !exists {
+			writeCode(w, 2048)
+			return
+		}
+
+		writeOK(w, map[string]any{"stream": stream})
+
+	case r.Method == http.MethodGet && path == "/api/v1/clients":
+		clients := []srsapi.ClientInfo{}
+
+		for _, client := range s.clients {
+			clients = append(clients, client)
+		}
+
+		writeOK(w, map[string]any{"clients": clients})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/api/v1/clients/"):
+		client, exists := s.clients[strings.TrimPrefix(path, "/api/v1/clients/")]
+
+		if !exists {
+			writeCode(w, 2049)
+			return
+		}
+
+		writeOK(w, map[string]any{"client": client})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/api/v1/clients/"):
+		id := strings.TrimPrefix(path, "/api/v1/clients/")
+
+		if _, exists := s.clients[id]; !exists {
+			writeCode(w, 2049)
+			return
+		}
+
+		delete(s.clients, id)
+
+		s.kicked = append(s.kicked, id)
+
+		writeOK(w, nil)
+
+	case r.Method == http.MethodGet && path == "/api/v1/raw" && r.URL.Query().Get("rpc") == "reload":
+		s.reloads++
+
+		writeOK(w, nil)
+
+	case r.Method == http.MethodPost && (path == "/rtc/v1/whip" || path == "/rtc/v1/whep"):
+		offer, _ := io.ReadAll(r.Body)
+
+		if len(offer) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.nextID++
+
+		id := fmt.Sprintf("session-%d", s.nextID)
+
+		s.sessions[id] = r.URL.Query().Get("stream")
+
+		w.Header().Set("Content-Type", "application/sdp")
+
+		w.Header().Set("Location", path+"/?action=delete&session="+id)
+
+		w.WriteHeader(http.StatusCreated)
+
+		w.Write([]byte("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=fake\r\n"))
+
+	case r.Method == http.MethodDelete && (path == "/rtc/v1/whip" || path == "/rtc/v1/whep"):
+		id := r.URL.Query().Get("session")
+
+		if _, exists := s.sessions[id]; !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		delete(s.sessions, id)
+
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.NotFound(w, r)
+
+	}
+
+}
+
+func writeOK(w http.ResponseWriter, body map[string]any) {
+
+	if body == nil {
+		body = map[string]any{}
+	}
+
+	body["code"] = 0
+
+	body["server"] = "vid-fake"
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(body)
+
+}
+
+func writeCode(w http.ResponseWriter, code int) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(map[string]any{"code": code})
+
+}
@@ -0,0 +1,121 @@
+package srsapi
+
+// Kbps is SRS's bandwidth sample, averaged over 30 seconds.
+type Kbps struct {
+	Recv30s int `json:"recv_30s"`
+	Send30s int `json:"send_30s"`
+}
+
+type Version struct {
+	Major    int    `json:"major"`
+	Minor    int    `json:"minor"`
+	Revision int    `json:"revision"`
+	Version  string `json:"version"`
+}
+
+type Summary struct {
+	OK     bool          `json:"ok"`
+	NowMs  int64         `json:"now_ms"`
+	Self   SummarySelf   `json:"self"`
+	System SummarySystem `json:"system"`
+}
+
+type SummarySelf struct {
+	Version    string  `json:"version"`
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	Argv       string  `json:"argv"`
+	Cwd        string  `json:"cwd"`
+	MemKbyte   int64   `json:"mem_kbyte"`
+	MemPercent float64 `json:"mem_percent"`
+	CPUPercent float64 `json:"cpu_percent"`
+	SRSUptime  int64   `json:"srs_uptime"`
+}
+
+type SummarySystem struct {
+	CPUPercent    float64 `json:"cpu_percent"`
+	DiskReadKBps  int64   `json:"disk_read_KBps"`
+	DiskWriteKBps int64   `json:"disk_write_KBps"`
+	MemRAMKbyte   int64   `json:"mem_ram_kbyte"`
+	MemRAMPercent float64 `json:"mem_ram_percent"`
+	CPUs          int     `json:"cpus"`
+	CPUsOnline    int     `json:"cpus_online"`
+	Uptime        float64 `json:"uptime"`
+	Load1m        float64 `json:"load_1m"`
+	Load5m        float64 `json:"load_5m"`
+	Load15m       float64 `json:"load_15m"`
+	ConnSys       int     `json:"conn_sys"`
+	ConnSrs       int     `json:"conn_srs"`
+}
+
+type Vhost struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Clients   int    `json:"clients"`
+	Streams   int    `json:"streams"`
+	SendBytes int64  `json:"send_bytes"`
+	RecvBytes int64  `json:"recv_bytes"`
+	Kbps      Kbps   `json:"kbps"`
+	HLS       struct {
+		Enabled  bool    `json:"enabled"`
+		Fragment float64 `json:"fragment"`
+	} `json:"hls"`
+}
+
+type Stream struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Vhost     string        `json:"vhost"`
+	App       string        `json:"app"`
+	TcURL     string        `json:"tcUrl"`
+	URL       string        `json:"url"`
+	LiveMs    int64         `json:"live_ms"`
+	Clients   int           `json:"clients"`
+	Frames    int64         `json:"frames"`
+	SendBytes int64         `json:"send_bytes"`
+	RecvBytes int64         `json:"recv_bytes"`
+	Kbps      Kbps          `json:"kbps"`
+	Publish   StreamPublish `json:"publish"`
+	Video     *StreamVideo  `json:"video"`
+	Audio     *StreamAudio  `json:"audio"`
+}
+
+type StreamPublish struct {
+	Active bool   `json:"active"`
+	CID    string `json:"cid"`
+}
+
+type StreamVideo struct {
+	Codec   string `json:"codec"`
+	Profile string `json:"profile"`
+	Level   string `json:"level"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+type StreamAudio struct {
+	Codec      string `json:"codec"`
+	SampleRate int    `json:"sample_rate"`
+	Channel    int    `json:"channel"`
+	Profile    string `json:"profile"`
+}
+
+// ClientInfo is a connection to SRS, publishing or playing.
+type ClientInfo struct {
+	ID        string  `json:"id"`
+	Vhost     string  `json:"vhost"`
+	Stream    string  `json:"stream"`
+	IP        string  `json:"ip"`
+	PageURL   string  `json:"pageUrl"`
+	SwfURL    string  `json:"swfUrl"`
+	TcURL     string  `json:"tcUrl"`
+	URL       string  `json:"url"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Publish   bool    `json:"publish"`
+	Alive     float64 `json:"alive"`
+	SendBytes int64   `json:"send_bytes"`
+	RecvBytes int64   `json:"recv_bytes"`
+	Kbps      Kbps    `json:"kbps"`
+}
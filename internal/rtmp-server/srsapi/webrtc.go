@@ -0,0 +1,139 @@
+package srsapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxSDPSize bounds the SDP answers read from SRS.
+const maxSDPSize = 64 << 10
+
+// WebRTCSession is what SRS answers a WHIP or WHEP offer with: its SDP
+// answer and the resource that ends the session when deleted.
+type WebRTCSession struct {
+	Answer   string
+	Location string
+}
+
+// WHIP offers SRS a WebRTC publish of app/stream. SRS runs its on_publish
+// hook before it answers.
+func (c *Client) WHIP(ctx context.Context, app, stream, offer string) (WebRTCSession, error) {
+
+	return c.exchangeSDP(ctx, "/rtc/v1/whip/", app, stream, offer)
+
+}
+
+// WHEP offers SRS a WebRTC playback of app/stream.
+func (c *Client) WHEP(ctx context.Context, app, stream, offer string) (WebRTCSession, error) {
+
+	return c.exchangeSDP(ctx, "/rtc/v1/whep/", app, stream, offer)
+
+}
+
+// DeleteWebRTCSession ends a WHIP or WHEP session through the Location SRS
+// returned for it.
+func (c *Client) DeleteWebRTCSession(ctx context.Context, location string) error {
+
+	ref, err := url.Parse(location)
+
+	if err != nil {
+		return fmt.Errorf("invalid WebRTC session location %q", location)
+	}
+
+	endpoint := c.baseURL.ResolveReference(ref)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint.String(), nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to create SRS API request: %v", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("failed to reach SRS API: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxSDPSize))
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &APIError{Method: http.MethodDelete, Path: endpoint.Path, Status: resp.StatusCode}
+	}
+
+	return nil
+
+}
+
+// exchangeSDP posts an SDP offer and reads the answer. It is never
+// retried: a retry would set up a second session.
+func (c *Client) exchangeSDP(ctx context.Context, path, app, stream, offer string) (WebRTCSession, error) {
+
+	endpoint := *c.baseURL
+
+	endpoint.Path += path
+
+	endpoint.RawQuery = url.Values{"app": {app}, "stream": {stream}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(offer))
+
+	if err != nil {
+		return WebRTCSession{}, fmt.Errorf("failed to create SRS API request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/sdp")
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return WebRTCSession{}, fmt.Errorf("failed to reach SRS API: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSDPSize))
+
+	if err != nil {
+		return WebRTCSession{}, fmt.Errorf("failed to read SRS API response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return WebRTCSession{}, &APIError{Method: http.MethodPost, Path: path, Status: resp.StatusCode}
+	}
+
+	// SRS reports errors such as a rejected hook as JSON.
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "v=") {
+		return WebRTCSession{}, &APIError{Method: http.MethodPost, Path: path, Status: resp.StatusCode, Code: jsonCode(body)}
+	}
+
+	return WebRTCSession{
+		Answer:   string(body),
+		Location: resp.Header.Get("Location"),
+	}, nil
+
+}
+
+// jsonCode is the "code" of an SRS error response, or -1 if there is none.
+func jsonCode(body []byte) int {
+
+	var envelope struct {
+		Code int `json:"code"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Code == 0 {
+		return -1
+	}
+
+	return envelope.Code
+
+}
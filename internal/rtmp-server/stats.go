@@ -0,0 +1,157 @@
+package rtmpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// ingestApp is the SRS app encoders publish to.
+const ingestApp = "live"
+
+// frameRateWindow is how far back the frame rate is measured over. Samples
+// are kept at most once a second, so every caller asking within the window
+// is measured against the same sample and sees the same rate.
+const frameRateWindow = 10 * time.Second
+
+// frameSample is a frame count seen for an SRS stream, used to turn SRS's
+// running frame counter into a frame rate.
+type frameSample struct {
+	frames int64
+	at     time.Time
+}
+
+// IngestStats looks up what the encoder publishing on a stream key is
+// sending, from SRS's stream and client lists.
+func (srs *SimpleRealtimeServer) IngestStats(ctx context.Context, keyID string) (types.IngestStats, error) {
+
+	publisher, publishing := srs.publishers.Active(keyID)
+
+	if !publishing {
+		return types.IngestStats{}, mediaserver.ErrStreamNotLive
+	}
+
+	stream, err := srs.API.StreamByName(ctx, ingestApp, publisher.Stream)
+
+	if errors.Is(err, srsapi.ErrNotFound) {
+		return types.IngestStats{}, mediaserver.ErrStreamNotLive
+	}
+
+	if err != nil {
+		return types.IngestStats{}, fmt.Errorf("failed to get stream from SRS: %w", err)
+	}
+
+	clients, err := srs.API.Clients(ctx)
+
+	if err != nil {
+		return types.IngestStats{}, fmt.Errorf("failed to get clients from SRS: %w", err)
+	}
+
+	now := time.Now()
+
+	stats := types.IngestStats{
+		StreamID:  keyID,
+		ClientID:  publisher.ClientID,
+		IP:        publisher.IP,
+		Protocol:  publisher.Protocol,
+		LiveSince: publisher.StartedAt,
+		RecvKbps:  stream.Kbps.Recv30s,
+		SendKbps:  stream.Kbps.Send30s,
+		SampledAt: now,
+	}
+
+	for _, client := range clients {
+
+		if client.Stream != stream.ID {
+			continue
+		}
+
+		stats.Clients++
+
+		if !client.Publish {
+			stats.Players++
+		}
+
+	}
+
+	if stream.Video != nil {
+		stats.Video = &types.IngestVideoStats{
+			Codec:     stream.Video.Codec,
+			Profile:   stream.Video.Profile,
+			Level:     stream.Video.Level,
+			Width:     stream.Video.Width,
+			Height:    stream.Video.Height,
+			FrameRate: srs.frameRate(stream, publisher.StartedAt, now),
+		}
+	}
+
+	if stream.Audio != nil {
+		stats.Audio = &types.IngestAudioStats{
+			Codec:      stream.Audio.Codec,
+			Profile:    stream.Audio.Profile,
+			SampleRate: stream.Audio.SampleRate,
+			Channels:   stream.Audio.Channel,
+		}
+	}
+
+	return stats, nil
+
+}
+
+// frameRate is the rate over the last frameRateWindow, or the average since
+// the encoder started publishing until the stream has a sample a second old.
+func (srs *SimpleRealtimeServer) frameRate(stream srsapi.Stream, since, now time.Time) float64 {
+
+	srs.frameSamplesLock.Lock()
+
+	defer srs.frameSamplesLock.Unlock()
+
+	samples := srs.frameSamples[stream.ID]
+
+	// A counter that went backwards belongs to a new publish.
+	if len(samples) > 0 && stream.Frames < samples[len(samples)-1].frames {
+		samples = nil
+	}
+
+	if len(samples) == 0 || now.Sub(samples[len(samples)-1].at) >= time.Second {
+		samples = append(samples, frameSample{frames: stream.Frames, at: now})
+	}
+
+	// Keep the newest sample at least a window old as the baseline.
+	for len(samples) > 1 && now.Sub(samples[1].at) >= frameRateWindow {
+		samples = samples[1:]
+	}
+
+	srs.frameSamples[stream.ID] = samples
+
+	// Forget streams that have not been asked about for a while.
+	for id, streamSamples := range srs.frameSamples {
+		if now.Sub(streamSamples[len(streamSamples)-1].at) > time.Hour {
+			delete(srs.frameSamples, id)
+		}
+	}
+
+	if baseline := samples[0]; now.Sub(baseline.at) >= time.Second {
+		return round(float64(stream.Frames-baseline.frames) / now.Sub(baseline.at).Seconds())
+	}
+
+	liveFor := now.Sub(since).Seconds()
+
+	if liveFor <= 0 {
+		return 0
+	}
+
+	return round(float64(stream.Frames) / liveFor)
+
+}
+
+func round(value float64) float64 {
+
+	return float64(int(value*100+0.5)) / 100
+
+}
@@ -0,0 +1,90 @@
+package rtmpserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+)
+
+func TestFrameRate(t *testing.T) {
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A stream sending 30 fps, asked about at these offsets from the start.
+	tests := []struct {
+		name    string
+		offsets []time.Duration
+		want    []float64
+	}{
+		{
+			name:    "first sample is the average since publishing",
+			offsets: []time.Duration{20 * time.Second},
+			want:    []float64{30},
+		},
+		{
+			name:    "pollers close together see the same rate",
+			offsets: []time.Duration{10 * time.Second, 15 * time.Second, 15*time.Second + 300*time.Millisecond, 15*time.Second + 600*time.Millisecond},
+			want:    []float64{30, 30, 30, 30},
+		},
+		{
+			name:    "slow pollers",
+			offsets: []time.Duration{10 * time.Second, time.Minute, 2 * time.Minute},
+			want:    []float64{30, 30, 30},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			srs := &SimpleRealtimeServer{frameSamples: make(map[string][]frameSample)}
+
+			for i, offset := range test.offsets {
+
+				stream := srsapi.Stream{ID: "vid-1", Frames: int64(offset.Seconds() * 30)}
+
+				if got := srs.frameRate(stream, start, start.Add(offset)); got != test.want[i] {
+					t.Fatalf("sample %d at %s: got %v fps, want %v", i, offset, got, test.want[i])
+				}
+
+			}
+
+		})
+
+	}
+
+}
+
+func TestFrameRateFollowsChanges(t *testing.T) {
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	srs := &SimpleRealtimeServer{frameSamples: make(map[string][]frameSample)}
+
+	frames := int64(0)
+
+	var got float64
+
+	// 30 fps for a minute, then 60 fps, polled every two seconds.
+	for second := 2; second <= 120; second += 2 {
+
+		if second <= 60 {
+			frames += 60
+		} else {
+			frames += 120
+		}
+
+		got = srs.frameRate(srsapi.Stream{ID: "vid-1", Frames: frames}, start, start.Add(time.Duration(second)*time.Second))
+
+	}
+
+	if got != 60 {
+		t.Fatalf("got %v fps after the rate changed, want 60", got)
+	}
+
+	if samples := len(srs.frameSamples["vid-1"]); samples > int(frameRateWindow/time.Second)+1 {
+		t.Fatalf("kept %d samples for a %s window", samples, frameRateWindow)
+	}
+
+}
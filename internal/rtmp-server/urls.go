@@ -0,0 +1,204 @@
+package rtmpserver
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func validatePublicConfig(cfg config.PublicConfig) error {
+
+	for _, protocol := range cfg.IngestProtocols {
+
+		switch protocol {
+
+		case mediaserver.ProtocolRTMP, mediaserver.ProtocolRTMPS, mediaserver.ProtocolSRT, mediaserver.ProtocolWHIP:
+
+		default:
+			return fmt.Errorf("unknown ingest protocol %q", protocol)
+
+		}
+
+	}
+
+	for _, protocol := range cfg.PlaybackProtocols {
+
+		if protocol != mediaserver.ProtocolHLS {
+			return fmt.Errorf("unknown playback protocol %q", protocol)
+		}
+
+	}
+
+	if cfg.Host == "" {
+		return fmt.Errorf("public host cannot be empty")
+	}
+
+	return nil
+
+}
+
+// GetIngestURL is the RTMP URL of a stream as reached from this server,
+// on the host the SRS API is reached on. It is what the relays pull from;
+// encoders are given IngestEndpoints instead.
+func (srs *SimpleRealtimeServer) GetIngestURL(streamKey string) string {
+
+	if streamKey == "" {
+		log.Println("Stream key is empty. Returning an empty ingest URL.")
+		return ""
+	}
+
+	return fmt.Sprintf("rtmp://%s/%s/%s", net.JoinHostPort(srs.localHost(), portNumber(srs.Port)), ingestApp, streamKey)
+
+}
+
+// PublicRTMPURL is the RTMP URL encoders publish a stream name to.
+func (srs *SimpleRealtimeServer) PublicRTMPURL(stream string) string {
+
+	return srs.rtmpServerURL() + "/" + stream
+
+}
+
+// IngestEndpoints lists the enabled ways to publish on a stream key. The
+// full URLs are only filled in when the plaintext key is given.
+func (srs *SimpleRealtimeServer) IngestEndpoints(streamKey string) []types.IngestEndpoint {
+
+	endpoints := []types.IngestEndpoint{}
+
+	for _, protocol := range srs.Public.IngestProtocols {
+
+		endpoint := types.IngestEndpoint{Protocol: protocol}
+
+		switch protocol {
+
+		case mediaserver.ProtocolRTMP:
+			endpoint.Server = srs.rtmpServerURL()
+
+			if streamKey != "" {
+				endpoint.URL = endpoint.Server + "/" + streamKey
+			}
+
+		case mediaserver.ProtocolRTMPS:
+			endpoint.Server = fmt.Sprintf("rtmps://%s/%s", srs.publicHostPort(srs.Public.RTMPSPort), ingestApp)
+
+			if streamKey != "" {
+				endpoint.URL = endpoint.Server + "/" + streamKey
+			}
+
+		case mediaserver.ProtocolSRT:
+			endpoint.Server = "srt://" + srs.publicHostPort(srs.srtPort())
+
+			if streamKey != "" {
+				endpoint.URL = endpoint.Server + "?streamid=" + srtStreamID(streamKey, "publish")
+			}
+
+		case mediaserver.ProtocolWHIP:
+			endpoint.Server = strings.TrimSuffix(srs.Public.APIURL, "/") + "/api/whip"
+
+			// WHIP clients send the stream key as their bearer token.
+			if streamKey != "" {
+				endpoint.URL = endpoint.Server
+			}
+
+		}
+
+		endpoints = append(endpoints, endpoint)
+
+	}
+
+	return endpoints
+
+}
+
+// PlaybackURLs lists where viewers can watch what is published on a stream
+// key. SRS names its output after the stream name, which is usually the
+// stream key itself, so playback is served by the API server under the
+// key's ID instead.
+func (srs *SimpleRealtimeServer) PlaybackURLs(keyID string) []types.PlaybackURL {
+
+	playback := []types.PlaybackURL{}
+
+	if keyID == "" {
+		return playback
+	}
+
+	for _, protocol := range srs.Public.PlaybackProtocols {
+
+		if protocol == mediaserver.ProtocolHLS && srs.Config.HLS.Enabled {
+			playback = append(playback, types.PlaybackURL{
+				Protocol: protocol,
+				URL:      strings.TrimSuffix(srs.Public.APIURL, "/") + "/api/hls/" + keyID + ".m3u8",
+			})
+		}
+
+	}
+
+	return playback
+
+}
+
+// GetHLSURL is where a file of the HLS output, such as "<stream>.m3u8", is
+// fetched from on SRS's HTTP server, as reached from this server.
+func (srs *SimpleRealtimeServer) GetHLSURL(file string) string {
+
+	if file == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("http://%s/%s/%s", net.JoinHostPort(srs.localHost(), strconv.Itoa(srs.Config.HTTPPort)), ingestApp, file)
+
+}
+
+// localHost is the host SRS is reached on from this server, the one its
+// API is reached on.
+func (srs *SimpleRealtimeServer) localHost() string {
+
+	if apiURL, err := url.Parse(srs.API.BaseURL()); err == nil && apiURL.Hostname() != "" {
+		return apiURL.Hostname()
+	}
+
+	return "localhost"
+
+}
+
+func (srs *SimpleRealtimeServer) rtmpServerURL() string {
+
+	port := srs.Public.RTMPPort
+
+	if port == 0 {
+		port, _ = strconv.Atoi(portNumber(srs.Port))
+	}
+
+	return fmt.Sprintf("rtmp://%s/%s", srs.publicHostPort(port), ingestApp)
+
+}
+
+func (srs *SimpleRealtimeServer) srtPort() int {
+
+	if srs.Public.SRTPort != 0 {
+		return srs.Public.SRTPort
+	}
+
+	return srs.Config.SRT.Port
+
+}
+
+func (srs *SimpleRealtimeServer) publicHostPort(port int) string {
+
+	return net.JoinHostPort(srs.Public.Host, strconv.Itoa(port))
+
+}
+
+// srtStreamID is the SRT stream ID SRS maps to an RTMP-style stream:
+// "#!::r=app/stream,m=publish|request".
+func srtStreamID(stream, mode string) string {
+
+	return fmt.Sprintf("#!::r=%s/%s,m=%s", ingestApp, stream, mode)
+
+}
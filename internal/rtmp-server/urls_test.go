@@ -0,0 +1,102 @@
+package rtmpserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+)
+
+func TestSRTStreamID(t *testing.T) {
+
+	tests := []struct {
+		stream string
+		mode   string
+		want   string
+	}{
+		{stream: "key", mode: "publish", want: "#!::r=live/key,m=publish"},
+		{stream: "key", mode: "request", want: "#!::r=live/key,m=request"},
+		{stream: "a1B2-c3_D4", mode: "publish", want: "#!::r=live/a1B2-c3_D4,m=publish"},
+	}
+
+	for _, test := range tests {
+
+		if got := srtStreamID(test.stream, test.mode); got != test.want {
+			t.Fatalf("srtStreamID(%q, %q) = %q, want %q", test.stream, test.mode, got, test.want)
+		}
+
+	}
+
+}
+
+func TestSRTIngestEndpoint(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		streamKey  string
+		wantServer string
+		wantURL    string
+	}{
+		{
+			name:       "SRS's SRT port",
+			env:        map[string]string{"SRS_SRT_PORT": "10090"},
+			streamKey:  "key",
+			wantServer: "srt://stream.example.com:10090",
+			wantURL:    "srt://stream.example.com:10090?streamid=#!::r=live/key,m=publish",
+		},
+		{
+			name:       "public SRT port",
+			env:        map[string]string{"SRS_SRT_PORT": "10090", "PUBLIC_SRT_PORT": "9000"},
+			streamKey:  "key",
+			wantServer: "srt://stream.example.com:9000",
+			wantURL:    "srt://stream.example.com:9000?streamid=#!::r=live/key,m=publish",
+		},
+		{
+			name:       "no stream key",
+			env:        map[string]string{"SRS_SRT_PORT": "10090"},
+			wantServer: "srt://stream.example.com:10090",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "srs.conf"))
+
+			t.Setenv("SRS_PATH", "/usr/local/srs/objs/srs")
+
+			t.Setenv("SRS_MODE", "external")
+
+			t.Setenv("PUBLIC_HOST", "stream.example.com")
+
+			t.Setenv("INGEST_PROTOCOLS", "rtmp,srt")
+
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			srs, err := NewServer(":1935")
+
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			endpoints := srs.IngestEndpoints(test.streamKey)
+
+			if len(endpoints) != 2 || endpoints[1].Protocol != mediaserver.ProtocolSRT {
+				t.Fatalf("got endpoints %+v, want RTMP and SRT", endpoints)
+			}
+
+			srt := endpoints[1]
+
+			if srt.Server != test.wantServer || srt.URL != test.wantURL {
+				t.Fatalf("got SRT endpoint %q %q, want %q %q", srt.Server, srt.URL, test.wantServer, test.wantURL)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,137 @@
+package rtmpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/srsapi"
+	"github.com/OODemi52/chronocast-server/internal/utils"
+)
+
+var _ mediaserver.WebRTCServer = (*SimpleRealtimeServer)(nil)
+
+// maxWebRTCSessionAge is how long a WebRTC session is remembered when its
+// client goes away without deleting it.
+const maxWebRTCSessionAge = 24 * time.Hour
+
+type webrtcSession struct {
+	stream    string
+	location  string
+	createdAt time.Time
+}
+
+// PublishWebRTC hands a WHIP offer to SRS. SRS authorizes the publish
+// through its on_publish hook like an RTMP one and, with rtc_to_rtmp on,
+// remuxes it to RTMP for HLS and the relays.
+func (srs *SimpleRealtimeServer) PublishWebRTC(ctx context.Context, stream, offer string) (mediaserver.WebRTCSession, error) {
+
+	session, err := srs.API.WHIP(ctx, ingestApp, stream, offer)
+
+	if err != nil {
+		return mediaserver.WebRTCSession{}, fmt.Errorf("failed to publish over WebRTC: %w", err)
+	}
+
+	id, err := srs.addWebRTCSession(stream, session.Location)
+
+	if err != nil {
+		return mediaserver.WebRTCSession{}, err
+	}
+
+	log.Printf("WebRTC session %s is publishing on %s", id, auth.MaskStreamKey(stream))
+
+	return mediaserver.WebRTCSession{
+		ID:     id,
+		Stream: stream,
+		Answer: session.Answer,
+	}, nil
+
+}
+
+// PlayWebRTC hands a WHEP offer to SRS. Streams published over RTMP or SRT
+// are transmuxed for WebRTC with rtmp_to_rtc.
+func (srs *SimpleRealtimeServer) PlayWebRTC(ctx context.Context, stream, offer string) (mediaserver.WebRTCSession, error) {
+
+	session, err := srs.API.WHEP(ctx, ingestApp, stream, offer)
+
+	if err != nil {
+		return mediaserver.WebRTCSession{}, fmt.Errorf("failed to play over WebRTC: %w", err)
+	}
+
+	id, err := srs.addWebRTCSession(stream, session.Location)
+
+	if err != nil {
+		return mediaserver.WebRTCSession{}, err
+	}
+
+	log.Printf("WebRTC session %s is playing %s", id, auth.MaskStreamKey(stream))
+
+	return mediaserver.WebRTCSession{
+		ID:     id,
+		Stream: stream,
+		Answer: session.Answer,
+	}, nil
+
+}
+
+// CloseWebRTC ends a WebRTC session on a stream.
+func (srs *SimpleRealtimeServer) CloseWebRTC(ctx context.Context, id, stream string) error {
+
+	srs.webrtcLock.Lock()
+
+	session, exists := srs.webrtcSessions[id]
+
+	if exists && session.stream == stream {
+		delete(srs.webrtcSessions, id)
+	}
+
+	srs.webrtcLock.Unlock()
+
+	if !exists || session.stream != stream {
+		return mediaserver.ErrWebRTCSessionNotFound
+	}
+
+	// SRS has already dropped sessions whose peer went away.
+	if err := srs.API.DeleteWebRTCSession(ctx, session.location); err != nil && !errors.Is(err, srsapi.ErrNotFound) {
+		return fmt.Errorf("failed to close WebRTC session %s: %w", id, err)
+	}
+
+	log.Printf("WebRTC session %s closed.", id)
+
+	return nil
+
+}
+
+func (srs *SimpleRealtimeServer) addWebRTCSession(stream, location string) (string, error) {
+
+	id, err := utils.GenerateID()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate WebRTC session ID: %v", err)
+	}
+
+	now := time.Now()
+
+	srs.webrtcLock.Lock()
+
+	defer srs.webrtcLock.Unlock()
+
+	for sessionID, session := range srs.webrtcSessions {
+		if now.Sub(session.createdAt) > maxWebRTCSessionAge {
+			delete(srs.webrtcSessions, sessionID)
+		}
+	}
+
+	srs.webrtcSessions[id] = webrtcSession{
+		stream:    stream,
+		location:  location,
+		createdAt: now,
+	}
+
+	return id, nil
+
+}
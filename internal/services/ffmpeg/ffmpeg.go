@@ -1,82 +1,117 @@
 package ffmpeg
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os/exec"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/types"
 )
 
+// FFmpegService runs the ffmpeg processes relaying streams to the
+// platforms. Each relay is supervised: its exit is reaped and it is
+// restarted with backoff until it is stopped or exhausts its retry budget.
+// Stopped and failed relays are kept for their status for the retention
+// period, or until a relay is started again under the same name.
 type FFmpegService struct {
-	Processes   map[string]*exec.Cmd
-	ProcessLock sync.RWMutex
+	relays     map[string]*relay
+	relaysLock sync.Mutex
+	config     config.RelayConfig
 }
 
 func NewFFmpegService() *FFmpegService {
 
 	return &FFmpegService{
-		Processes: make(map[string]*exec.Cmd),
+		relays: make(map[string]*relay),
+		config: config.GetRelayConfig(),
 	}
 
 }
 
 func (fs *FFmpegService) StartProcess(streamKey, inputURL, outputURL string) error {
 
-	fs.ProcessLock.RLock()
-
-	_, exists := fs.Processes[streamKey]
+	fs.relaysLock.Lock()
 
-	fs.ProcessLock.RUnlock()
+	fs.prune(time.Now())
 
-	if exists {
+	if existing, exists := fs.relays[streamKey]; exists && !existing.done() {
+		fs.relaysLock.Unlock()
 		return fmt.Errorf("FFmpeg process already exists for stream key %s", streamKey)
 	}
 
-	cmd := exec.Command("ffmpeg",
-		"-loglevel", "debug",
-		"-i", inputURL,
-		"-c:v", "copy",
-		"-c:a", "aac",
-		"-f", "flv",
-		outputURL,
-	)
+	now := time.Now()
+
+	r := &relay{
+		inputURL:  inputURL,
+		outputURL: outputURL,
+		stop:      make(chan struct{}),
+		exited:    make(chan struct{}),
+		status: types.RelayStatus{
+			Name:      streamKey,
+			StartedAt: now,
+		},
+	}
 
-	cmd.Stderr = log.Writer()
+	cmd, err := fs.launch(r)
 
-	if err := cmd.Start(); err != nil {
+	if err != nil {
+		fs.relaysLock.Unlock()
 		log.Printf("Failed to start FFmpeg process for stream key %s: %v", streamKey, err)
 		return err
 	}
 
-	fs.ProcessLock.Lock()
+	fs.relays[streamKey] = r
 
-	fs.Processes[streamKey] = cmd
+	fs.relaysLock.Unlock()
 
-	fs.ProcessLock.Unlock()
+	go fs.supervise(r, cmd)
 
-	log.Printf("Started FFmpeg process for stream key %s, output: %s", streamKey, outputURL)
+	log.Printf("Started FFmpeg process for stream key %s, output: %s", streamKey, redactURL(outputURL))
 
 	return nil
 
 }
 
+// StopProcess kills a relay's ffmpeg process, or cancels its pending
+// restart, and waits for it to be reaped.
 func (fs *FFmpegService) StopProcess(streamKey string) error {
 
-	fs.ProcessLock.Lock()
+	fs.relaysLock.Lock()
 
-	cmd, exists := fs.Processes[streamKey]
+	r, exists := fs.relays[streamKey]
 
-	if exists {
-		delete(fs.Processes, streamKey)
+	if !exists || r.stopping {
+		fs.relaysLock.Unlock()
+		return nil
 	}
 
-	fs.ProcessLock.Unlock()
+	r.stopping = true
+
+	close(r.stop)
+
+	process := r.process
+
+	fs.relaysLock.Unlock()
+
+	var err error
+
+	if process != nil {
+
+		if err = process.Kill(); errors.Is(err, os.ErrProcessDone) {
+			err = nil
+		}
 
-	if !exists {
-		return nil
 	}
 
-	if err := cmd.Process.Kill(); err != nil {
+	<-r.exited
+
+	if err != nil {
 		return err
 	}
 
@@ -88,19 +123,63 @@ func (fs *FFmpegService) StopProcess(streamKey string) error {
 
 func (fs *FFmpegService) StopAllProcesses() {
 
-	fs.ProcessLock.Lock()
+	fs.relaysLock.Lock()
 
-	defer fs.ProcessLock.Unlock()
+	keys := make([]string, 0, len(fs.relays))
+
+	for key := range fs.relays {
+		keys = append(keys, key)
+	}
 
-	for key, cmd := range fs.Processes {
+	fs.relaysLock.Unlock()
 
-		if err := cmd.Process.Kill(); err != nil {
+	for _, key := range keys {
+
+		if err := fs.StopProcess(key); err != nil {
 			log.Printf("Failed to stop FFmpeg process for key %s: %v", key, err)
-		} else {
-			log.Printf("Stopped FFmpeg process for key %s", key)
 		}
 
-		delete(fs.Processes, key)
+	}
+
+}
+
+// Relays returns the status of the relays whose names start with prefix,
+// sorted by name.
+func (fs *FFmpegService) Relays(prefix string) []types.RelayStatus {
+
+	fs.relaysLock.Lock()
+
+	defer fs.relaysLock.Unlock()
+
+	fs.prune(time.Now())
+
+	relays := []types.RelayStatus{}
+
+	for name, r := range fs.relays {
+
+		if strings.HasPrefix(name, prefix) {
+			relays = append(relays, r.status)
+		}
+
+	}
+
+	sort.Slice(relays, func(i, j int) bool {
+		return relays[i].Name < relays[j].Name
+	})
+
+	return relays
+
+}
+
+// prune forgets relays that stopped or failed longer than the retention
+// period ago. It is called with relaysLock held.
+func (fs *FFmpegService) prune(now time.Time) {
+
+	for name, r := range fs.relays {
+
+		if r.done() && now.Sub(r.status.UpdatedAt) > fs.config.Retention {
+			delete(fs.relays, name)
+		}
 
 	}
 
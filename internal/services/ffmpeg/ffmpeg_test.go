@@ -0,0 +1,45 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func TestRelaysPrunesFinishedRelays(t *testing.T) {
+
+	now := time.Now()
+
+	relays := map[string]*relay{
+		"running":        {status: types.RelayStatus{Name: "running", State: types.RelayStateRunning, UpdatedAt: now.Add(-time.Hour)}},
+		"stopped-recent": {status: types.RelayStatus{Name: "stopped-recent", State: types.RelayStateStopped, UpdatedAt: now.Add(-time.Minute)}},
+		"stopped-old":    {status: types.RelayStatus{Name: "stopped-old", State: types.RelayStateStopped, UpdatedAt: now.Add(-time.Hour)}},
+		"failed-old":     {status: types.RelayStatus{Name: "failed-old", State: types.RelayStateFailed, UpdatedAt: now.Add(-time.Hour)}},
+	}
+
+	fs := &FFmpegService{
+		relays: relays,
+		config: config.RelayConfig{Retention: 10 * time.Minute},
+	}
+
+	statuses := fs.Relays("")
+
+	var names []string
+
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+
+	want := []string{"running", "stopped-recent"}
+
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Fatalf("got relays %v, want %v", names, want)
+	}
+
+	if len(fs.relays) != len(want) {
+		t.Fatalf("%d relays are still kept, want %d", len(fs.relays), len(want))
+	}
+
+}
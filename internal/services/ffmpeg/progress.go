@@ -0,0 +1,122 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// maxLineLength bounds how much of a line without a newline is buffered.
+const maxLineLength = 4096
+
+// lineWriter hands what is written to it to emit a line at a time.
+type lineWriter struct {
+	emit func(line string)
+	buf  []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+
+	lw.buf = append(lw.buf, p...)
+
+	for {
+
+		end := bytes.IndexByte(lw.buf, '\n')
+
+		if end < 0 {
+			break
+		}
+
+		if line := strings.TrimSpace(string(lw.buf[:end])); line != "" {
+			lw.emit(line)
+		}
+
+		lw.buf = lw.buf[:copy(lw.buf, lw.buf[end+1:])]
+
+	}
+
+	if len(lw.buf) > maxLineLength {
+		lw.buf = lw.buf[:0]
+	}
+
+	return len(p), nil
+
+}
+
+// progressParser reads the key=value blocks ffmpeg writes with -progress
+// and reports the metrics at the end of each block.
+type progressParser struct {
+	metrics types.RelayMetrics
+	report  func(types.RelayMetrics)
+}
+
+func (pp *progressParser) line(line string) {
+
+	key, value, found := strings.Cut(line, "=")
+
+	if !found {
+		return
+	}
+
+	switch key {
+
+	case "frame":
+		pp.metrics.Frames = parseInt(value)
+
+	case "fps":
+		pp.metrics.FPS = parseFloat(value)
+
+	case "bitrate":
+		pp.metrics.BitrateKbps = parseFloat(strings.TrimSuffix(value, "kbits/s"))
+
+	case "total_size":
+		pp.metrics.TotalSize = parseInt(value)
+
+	case "out_time_us":
+		pp.metrics.OutTime = float64(parseInt(value)) / 1e6
+
+	case "dup_frames":
+		pp.metrics.DupFrames = parseInt(value)
+
+	case "drop_frames":
+		pp.metrics.DropFrames = parseInt(value)
+
+	case "speed":
+		pp.metrics.Speed = parseFloat(strings.TrimSuffix(value, "x"))
+
+	case "progress":
+		pp.metrics.UpdatedAt = time.Now()
+		pp.report(pp.metrics)
+
+	}
+
+}
+
+// parseInt and parseFloat read ffmpeg's progress values, which are "N/A"
+// until there is something to report.
+func parseInt(value string) int64 {
+
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return n
+
+}
+
+func parseFloat(value string) float64 {
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return f
+
+}
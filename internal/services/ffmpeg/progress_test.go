@@ -0,0 +1,130 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func TestProgressParser(t *testing.T) {
+
+	block := "frame=300\nfps=30.00\nbitrate=2500.5kbits/s\ntotal_size=3145728\nout_time_us=10000000\n" +
+		"dup_frames=2\ndrop_frames=1\nspeed=1.01x\nprogress=continue\n"
+
+	full := types.RelayMetrics{
+		Frames:      300,
+		FPS:         30,
+		BitrateKbps: 2500.5,
+		TotalSize:   3145728,
+		OutTime:     10,
+		DupFrames:   2,
+		DropFrames:  1,
+		Speed:       1.01,
+	}
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   []types.RelayMetrics
+	}{
+		{
+			name:   "a whole block",
+			writes: []string{block},
+			want:   []types.RelayMetrics{full},
+		},
+		{
+			name:   "a block split across writes",
+			writes: []string{block[:7], block[7:40], block[40:]},
+			want:   []types.RelayMetrics{full},
+		},
+		{
+			name:   "a block that has not ended",
+			writes: []string{"frame=300\nfps=30.00\n", "progress=contin"},
+		},
+		{
+			name:   "values carry over from the last block",
+			writes: []string{block, "frame=330\nprogress=end\n"},
+			want: []types.RelayMetrics{full, func() types.RelayMetrics {
+				next := full
+				next.Frames = 330
+				return next
+			}()},
+		},
+		{
+			name:   "values that are not available yet",
+			writes: []string{"frame=0\nfps=N/A\nbitrate=N/A\ntotal_size=N/A\nout_time_us=N/A\nspeed=N/A\nprogress=continue\n"},
+			want:   []types.RelayMetrics{{}},
+		},
+		{
+			name:   "padding, blank lines and lines without a value",
+			writes: []string{"  frame=12  \r\n\n\nstream_0_0_q=-1.0\nnoise\nprogress=continue\n"},
+			want:   []types.RelayMetrics{{Frames: 12}},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			var got []types.RelayMetrics
+
+			parser := &progressParser{
+				report: func(metrics types.RelayMetrics) {
+
+					if metrics.UpdatedAt.IsZero() {
+						t.Fatal("reported metrics without an update time")
+					}
+
+					metrics.UpdatedAt = time.Time{}
+
+					got = append(got, metrics)
+
+				},
+			}
+
+			writer := &lineWriter{emit: parser.line}
+
+			for _, write := range test.writes {
+				if n, err := writer.Write([]byte(write)); n != len(write) || err != nil {
+					t.Fatalf("Write: got %d, %v", n, err)
+				}
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d reports, want %d: %+v", len(got), len(test.want), got)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("report %d: got %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+
+		})
+
+	}
+
+}
+
+func TestLineWriterDropsOverlongLines(t *testing.T) {
+
+	var lines []string
+
+	writer := &lineWriter{emit: func(line string) { lines = append(lines, line) }}
+
+	overlong := make([]byte, maxLineLength+1)
+
+	for i := range overlong {
+		overlong[i] = 'x'
+	}
+
+	writer.Write(overlong)
+
+	writer.Write([]byte("tail\nnext\n"))
+
+	if len(lines) != 2 || lines[0] != "tail" || lines[1] != "next" {
+		t.Fatalf("got lines %q, want [tail next]", lines)
+	}
+
+}
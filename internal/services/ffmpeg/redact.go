@@ -0,0 +1,54 @@
+package ffmpeg
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+)
+
+// redactor masks stream keys before ffmpeg output reaches the log. ffmpeg
+// echoes its input and output URLs, and the last path segment of an RTMP
+// URL is the stream key.
+type redactor struct {
+	secrets []string
+}
+
+func newRedactor(urls ...string) *redactor {
+
+	rd := &redactor{}
+
+	for _, rawURL := range urls {
+
+		parsed, err := url.Parse(rawURL)
+
+		if err != nil {
+			continue
+		}
+
+		if key := path.Base(parsed.Path); key != "" && key != "/" && key != "." {
+			rd.secrets = append(rd.secrets, key)
+		}
+
+	}
+
+	return rd
+
+}
+
+func (rd *redactor) redact(s string) string {
+
+	for _, secret := range rd.secrets {
+		s = strings.ReplaceAll(s, secret, auth.MaskStreamKey(secret))
+	}
+
+	return s
+
+}
+
+func redactURL(rawURL string) string {
+
+	return newRedactor(rawURL).redact(rawURL)
+
+}
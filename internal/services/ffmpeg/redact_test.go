@@ -0,0 +1,53 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSplitWrites(t *testing.T) {
+
+	const key = "s3cr3t-stream-key"
+
+	redactor := newRedactor("rtmp://localhost:1935/live/"+key, "rtmp://a.rtmp.youtube.com/live2/"+key)
+
+	var lines []string
+
+	lw := &lineWriter{
+		emit: func(line string) {
+			lines = append(lines, redactor.redact(line))
+		},
+	}
+
+	tests := []struct {
+		name   string
+		writes []string
+	}{
+		{name: "one write", writes: []string{"Output #0, flv, to 'rtmp://localhost:1935/live/" + key + "':\n"}},
+		{name: "key split across writes", writes: []string{"Input #0, from 'rtmp://localhost/live/s3cr3t", "-stream-key':\n"}},
+		{name: "key split at the newline", writes: []string{"Error on " + key[:4], key[4:], "\n"}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			lines = nil
+
+			for _, write := range test.writes {
+				lw.Write([]byte(write))
+			}
+
+			if len(lines) != 1 {
+				t.Fatalf("got %d lines, want 1", len(lines))
+			}
+
+			if strings.Contains(lines[0], key) {
+				t.Fatalf("the key reached the log: %q", lines[0])
+			}
+
+		})
+
+	}
+
+}
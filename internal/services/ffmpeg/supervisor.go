@@ -0,0 +1,273 @@
+package ffmpeg
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// relay is one supervised ffmpeg relay. Its fields other than the URLs and
+// channels are guarded by the service's relaysLock.
+type relay struct {
+	inputURL  string
+	outputURL string
+	status    types.RelayStatus
+	process   *os.Process
+	stopping  bool
+
+	// stop is closed by StopProcess; exited is closed once the supervisor
+	// has reaped the last process and returned.
+	stop   chan struct{}
+	exited chan struct{}
+}
+
+// done reports whether the relay's supervisor is finished with it.
+func (r *relay) done() bool {
+	return r.status.State == types.RelayStateStopped || r.status.State == types.RelayStateFailed
+}
+
+// launch starts the relay's ffmpeg process. It is called with relaysLock
+// held. ffmpeg writes its progress to stdout, which is parsed into the
+// relay's metrics, and its warnings and errors to stderr, which are logged
+// under the relay's name.
+func (fs *FFmpegService) launch(r *relay) (*exec.Cmd, error) {
+
+	name := r.status.Name
+
+	cmd := exec.Command("ffmpeg",
+		"-loglevel", "warning",
+		"-nostats",
+		"-progress", "pipe:1",
+		"-i", r.inputURL,
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-f", "flv",
+		r.outputURL,
+	)
+
+	progress := &progressParser{
+		report: func(metrics types.RelayMetrics) {
+
+			fs.relaysLock.Lock()
+
+			r.status.Metrics = &metrics
+
+			fs.relaysLock.Unlock()
+
+		},
+	}
+
+	cmd.Stdout = &lineWriter{emit: progress.line}
+
+	// Don't let a child that inherited the output pipes hold up reaping.
+	cmd.WaitDelay = time.Second
+
+	// Keys are masked a whole line at a time, so one split across two
+	// writes is still caught.
+	redactor := newRedactor(r.inputURL, r.outputURL)
+
+	cmd.Stderr = &lineWriter{
+		emit: func(line string) {
+			log.Printf("FFmpeg %s: %s", name, redactor.redact(line))
+		},
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	r.process = cmd.Process
+
+	r.status.PID = cmd.Process.Pid
+
+	r.status.Metrics = nil
+
+	r.setState(types.RelayStateStarting)
+
+	return cmd, nil
+
+}
+
+// supervise reaps the relay's ffmpeg process and starts it again until the
+// relay is stopped or has used up its restarts. Restarts back off
+// exponentially; a process that stayed up longer than the longest backoff
+// starts the backoff and the retry budget over.
+func (fs *FFmpegService) supervise(r *relay, cmd *exec.Cmd) {
+
+	defer close(r.exited)
+
+	name := r.status.Name
+
+	backoff := newRestartBackoff(fs.config.RestartBackoff, fs.config.MaxRestartBackoff)
+
+	for {
+
+		startedAt := time.Now()
+
+		err := fs.wait(r, cmd)
+
+		fs.relaysLock.Lock()
+
+		r.process = nil
+
+		r.status.PID = 0
+
+		if r.stopping {
+			r.setState(types.RelayStateStopped)
+			fs.relaysLock.Unlock()
+			return
+		}
+
+		if cmd.ProcessState != nil {
+			r.status.LastError = cmd.ProcessState.String()
+		} else {
+			r.status.LastError = err.Error()
+		}
+
+		if backoff.exited(time.Since(startedAt)) {
+			r.status.Restarts = 0
+		}
+
+		for {
+
+			if fs.config.MaxRestarts > 0 && r.status.Restarts >= fs.config.MaxRestarts {
+				restarts, lastError := r.status.Restarts, r.status.LastError
+				r.setState(types.RelayStateFailed)
+				fs.relaysLock.Unlock()
+				log.Printf("FFmpeg process for stream key %s failed after %d restarts: %s", name, restarts, lastError)
+				return
+			}
+
+			lastError := r.status.LastError
+
+			delay := backoff.delay()
+
+			r.status.NextRestartAt = time.Now().Add(delay)
+
+			r.setState(types.RelayStateBackoff)
+
+			fs.relaysLock.Unlock()
+
+			log.Printf("FFmpeg process for stream key %s exited (%s), restarting in %s", name, lastError, delay)
+
+			select {
+
+			case <-r.stop:
+
+			case <-time.After(delay):
+
+			}
+
+			fs.relaysLock.Lock()
+
+			r.status.NextRestartAt = time.Time{}
+
+			if r.stopping {
+				r.setState(types.RelayStateStopped)
+				fs.relaysLock.Unlock()
+				return
+			}
+
+			r.status.Restarts++
+
+			cmd, err = fs.launch(r)
+
+			if err == nil {
+				break
+			}
+
+			r.status.LastError = err.Error()
+
+		}
+
+		restarts := r.status.Restarts
+
+		fs.relaysLock.Unlock()
+
+		log.Printf("Restarted FFmpeg process for stream key %s (restart %d)", name, restarts)
+
+	}
+
+}
+
+// wait waits for the relay's process to exit, marking the relay running
+// once the process has stayed up for the startup period.
+func (fs *FFmpegService) wait(r *relay, cmd *exec.Cmd) error {
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+
+	case err := <-exited:
+		return err
+
+	case <-time.After(fs.config.StartupPeriod):
+
+	}
+
+	fs.relaysLock.Lock()
+
+	if !r.stopping {
+		r.setState(types.RelayStateRunning)
+	}
+
+	fs.relaysLock.Unlock()
+
+	return <-exited
+
+}
+
+// restartBackoff is how long to wait before each restart: the delay
+// doubles from initial up to max, and starts over once a process has
+// stayed up for longer than max.
+type restartBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	next    time.Duration
+}
+
+func newRestartBackoff(initial, max time.Duration) *restartBackoff {
+
+	return &restartBackoff{initial: initial, max: max, next: initial}
+
+}
+
+// exited records that the process exited after running for ran, and
+// reports whether that was long enough to start the backoff over.
+func (b *restartBackoff) exited(ran time.Duration) bool {
+
+	if ran <= b.max {
+		return false
+	}
+
+	b.next = b.initial
+
+	return true
+
+}
+
+// delay returns the wait before the next restart.
+func (b *restartBackoff) delay() time.Duration {
+
+	delay := b.next
+
+	b.next = min(b.next*2, b.max)
+
+	return delay
+
+}
+
+func (r *relay) setState(state types.RelayState) {
+
+	r.status.State = state
+
+	r.status.UpdatedAt = time.Now()
+
+}
@@ -0,0 +1,139 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func TestRestartBackoff(t *testing.T) {
+
+	// Each exit is how long the process ran before it exited, and the delay
+	// wanted before it is restarted.
+	type exit struct {
+		ran   time.Duration
+		delay time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		exits []exit
+	}{
+		{
+			name: "doubles up to the cap",
+			exits: []exit{
+				{ran: time.Second, delay: 1 * time.Second},
+				{ran: time.Second, delay: 2 * time.Second},
+				{ran: time.Second, delay: 4 * time.Second},
+				{ran: time.Second, delay: 8 * time.Second},
+				{ran: time.Second, delay: 8 * time.Second},
+			},
+		},
+		{
+			name: "starts over after a stable run",
+			exits: []exit{
+				{ran: time.Second, delay: 1 * time.Second},
+				{ran: time.Second, delay: 2 * time.Second},
+				{ran: time.Second, delay: 4 * time.Second},
+				{ran: 9 * time.Second, delay: 1 * time.Second},
+				{ran: time.Second, delay: 2 * time.Second},
+			},
+		},
+		{
+			name: "a run as long as the cap is not stable",
+			exits: []exit{
+				{ran: time.Second, delay: 1 * time.Second},
+				{ran: time.Second, delay: 2 * time.Second},
+				{ran: 8 * time.Second, delay: 4 * time.Second},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			backoff := newRestartBackoff(time.Second, 8*time.Second)
+
+			for i, exit := range test.exits {
+
+				backoff.exited(exit.ran)
+
+				if delay := backoff.delay(); delay != exit.delay {
+					t.Fatalf("exit %d after %s: got delay %s, want %s", i, exit.ran, delay, exit.delay)
+				}
+
+			}
+
+		})
+
+	}
+
+}
+
+func TestSuperviseGivesUpAfterMaxRestarts(t *testing.T) {
+
+	// A stand-in ffmpeg that fails as soon as it starts.
+	bin := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fs := &FFmpegService{
+		relays: make(map[string]*relay),
+		config: config.RelayConfig{
+			StartupPeriod:     time.Second,
+			RestartBackoff:    time.Millisecond,
+			MaxRestartBackoff: time.Second,
+			MaxRestarts:       3,
+			Retention:         time.Minute,
+		},
+	}
+
+	if err := fs.StartProcess("relay", "rtmp://localhost/live/key", "rtmp://example.com/live/key"); err != nil {
+		t.Fatalf("StartProcess: %v", err)
+	}
+
+	fs.relaysLock.Lock()
+
+	r := fs.relays["relay"]
+
+	fs.relaysLock.Unlock()
+
+	select {
+
+	case <-r.exited:
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay is still being restarted")
+
+	}
+
+	statuses := fs.Relays("")
+
+	if len(statuses) != 1 {
+		t.Fatalf("got %d relays, want 1", len(statuses))
+	}
+
+	status := statuses[0]
+
+	if status.State != types.RelayStateFailed {
+		t.Fatalf("got state %s, want %s", status.State, types.RelayStateFailed)
+	}
+
+	if status.Restarts != 3 {
+		t.Fatalf("got %d restarts, want 3", status.Restarts)
+	}
+
+	if status.LastError != "exit status 1" {
+		t.Fatalf("got last error %q, want %q", status.LastError, "exit status 1")
+	}
+
+}
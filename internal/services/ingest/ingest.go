@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/events"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+)
+
+var (
+	ErrInvalidStreamKey    = errors.New("invalid stream key")
+	ErrInvalidPublishToken = errors.New("invalid publish token")
+	ErrKeyInUse            = errors.New("stream key is already in use")
+)
+
+// staleCheckTimeout bounds asking the media server whether a publisher
+// holding a key is still connected.
+const staleCheckTimeout = 5 * time.Second
+
+// Service decides whether an encoder may publish and records who is
+// publishing on each key. SRS reaches it through the publish hooks; media
+// servers that accept encoders themselves call it as their
+// mediaserver.IngestHandler.
+type Service struct {
+	mediaServer mediaserver.MediaServer
+	lifecycle   *lifecycle.Manager
+}
+
+var _ mediaserver.IngestHandler = (*Service)(nil)
+
+func NewService(mediaServer mediaserver.MediaServer, streamLifecycle *lifecycle.Manager) *Service {
+
+	return &Service{
+		mediaServer: mediaServer,
+		lifecycle:   streamLifecycle,
+	}
+
+}
+
+// Publish checks the stream key, or the signed publish token, an encoder
+// presented and claims the key for it, disconnecting the current publisher
+// if the publisher policy says so. A single-use key is only used up once
+// the claim is accepted. The stream goes live on success.
+func (s *Service) Publish(conn mediaserver.Connection) (string, error) {
+
+	publishers := s.mediaServer.Publishers()
+
+	// The media server may retry its publish hook for a connection that
+	// already holds the key, and a single-use key is spent by then.
+	if held, holding := publishers.Client(conn.ClientID); holding && held.Stream == conn.Stream {
+		return held.KeyID, nil
+	}
+
+	var record auth.StreamKeyRecord
+
+	var err error
+
+	// Signed publish URLs carry the key's ID as the stream name and the
+	// token in the param; anything else must be the stream key itself.
+	if auth.HasPublishToken(conn.Param) {
+
+		if record, err = auth.VerifyPublishToken(conn.Stream, conn.Param, conn.IP); err != nil {
+			log.Printf("Rejected publish: %v", err)
+			return "", fmt.Errorf("%w: %v", ErrInvalidPublishToken, err)
+		}
+
+	} else if record, err = auth.LookupStreamKey(conn.Stream); err != nil {
+		log.Printf("Rejected publish: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrInvalidStreamKey, err)
+	}
+
+	publisher := mediaserver.Publisher{
+		KeyID:     record.ID,
+		UserID:    record.UserID,
+		Stream:    conn.Stream,
+		ClientID:  conn.ClientID,
+		IP:        conn.IP,
+		Protocol:  conn.Protocol,
+		StartedAt: time.Now(),
+	}
+
+	displaced, accepted := publishers.Claim(publisher)
+
+	// Check that the current publisher is still there before turning the
+	// encoder away.
+	if !accepted {
+
+		ctx, cancel := context.WithTimeout(context.Background(), staleCheckTimeout)
+
+		_, released := mediaserver.ReleaseStalePublisher(ctx, s.mediaServer, record.ID)
+
+		cancel()
+
+		if released {
+			displaced, accepted = publishers.Claim(publisher)
+		}
+
+	}
+
+	if !accepted {
+
+		active, _ := publishers.Active(record.ID)
+
+		log.Printf("Rejected publish from client %s (%s): key %s is already published by client %s", conn.ClientID, conn.IP, record.ID, active.ClientID)
+
+		return "", ErrKeyInUse
+
+	}
+
+	// A publish URL is bound by the rules of its key: publishing through
+	// one uses up a single-use key like publishing with the key itself.
+	if _, err := auth.ConsumeStreamKeyRecord(record); err != nil {
+		publishers.Release(conn.ClientID)
+		log.Printf("Rejected publish: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrInvalidStreamKey, err)
+	}
+
+	if displaced != nil {
+
+		log.Printf("Client %s (%s) replaced client %s (%s) on key %s", conn.ClientID, conn.IP, displaced.ClientID, displaced.IP, record.ID)
+
+		if err := s.mediaServer.KickClient(displaced.ClientID); err != nil {
+			log.Printf("Failed to disconnect replaced publisher %s: %v", displaced.ClientID, err)
+		}
+
+	} else {
+
+		log.Printf("Client %s (%s) is now publishing on key %s over %s", conn.ClientID, conn.IP, record.ID, conn.Protocol)
+
+	}
+
+	s.lifecycle.Published(record.ID, conn.Stream, conn.ClientID)
+
+	s.mediaServer.Events().Publish(events.Event{
+		Type:     events.Publish,
+		ClientID: conn.ClientID,
+		IP:       conn.IP,
+		App:      conn.App,
+		KeyID:    record.ID,
+		Relay:    mediaserver.IsRelayParam(conn.Param),
+	})
+
+	return record.ID, nil
+
+}
+
+// Unpublish releases the client's claim on its key, if it still holds
+// one, and starts the stream's reconnect grace window.
+func (s *Service) Unpublish(conn mediaserver.Connection) {
+
+	publisher, released := s.mediaServer.Publishers().Release(conn.ClientID)
+
+	if !released {
+		return
+	}
+
+	log.Printf("Client %s stopped publishing on key %s", conn.ClientID, publisher.KeyID)
+
+	s.lifecycle.Unpublished(publisher.KeyID)
+
+	s.mediaServer.Events().Publish(events.Event{
+		Type:     events.Unpublish,
+		ClientID: conn.ClientID,
+		IP:       conn.IP,
+		App:      conn.App,
+		KeyID:    publisher.KeyID,
+		Relay:    mediaserver.IsRelayParam(conn.Param),
+	})
+
+}
@@ -0,0 +1,517 @@
+package lifecycle
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+var (
+	ErrStreamNotFound = errors.New("stream not found")
+	ErrStreamActive   = errors.New("a stream is already active for this stream key")
+)
+
+// managedStream is a stream's lifecycle plus what is needed to run its
+// relays: the relay process name, the platform broadcasts and the name the
+// current encoder publishes under, which is only known from on_publish.
+type managedStream struct {
+	info      types.StreamLifecycle
+	relayName string
+	results   []multistream.PlatformResult
+	ingest    string
+	clientID  string
+
+	// relayLock serializes starting and stopping the relays, which happens
+	// outside streamsLock.
+	relayLock sync.Mutex
+
+	// generation invalidates a pending reconnect grace timer when the
+	// encoder comes back or the stream is ended some other way.
+	generation int
+	finishing  bool
+}
+
+// Manager moves each stream through created → waiting → live → ending →
+// ended. Streams are keyed by the ID of the stream key they publish on,
+// which is also how the ingest hooks identify them. Relays are armed when
+// the stream is created and started when the encoder publishes. When the
+// encoder stops publishing the relays stop and the stream waits
+// ReconnectGrace for it to come back, restarting the relays if it does,
+// before the platform broadcasts are completed.
+type Manager struct {
+	mediaServer        mediaserver.MediaServer
+	multiStreamService *multistream.MultiStreamService
+	config             config.LifecycleConfig
+	streams            map[string]*managedStream
+	streamsLock        sync.Mutex
+	onEnded            []func(types.StreamLifecycle)
+}
+
+func NewManager(mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService) *Manager {
+
+	return &Manager{
+		mediaServer:        mediaServer,
+		multiStreamService: multiStreamService,
+		config:             config.GetLifecycleConfig(),
+		streams:            make(map[string]*managedStream),
+	}
+
+}
+
+// OnEnded registers fn to be called after a stream has been torn down.
+func (m *Manager) OnEnded(fn func(types.StreamLifecycle)) {
+
+	m.streamsLock.Lock()
+
+	defer m.streamsLock.Unlock()
+
+	m.onEnded = append(m.onEnded, fn)
+
+}
+
+// Create starts tracking a new stream on a key. A key carries one stream
+// at a time; an ended stream is replaced.
+func (m *Manager) Create(id, userID, title, scheduleID string) (types.StreamLifecycle, error) {
+
+	m.streamsLock.Lock()
+
+	defer m.streamsLock.Unlock()
+
+	if existing, exists := m.streams[id]; exists && existing.info.State != types.StreamStateEnded {
+		return types.StreamLifecycle{}, ErrStreamActive
+	}
+
+	now := time.Now()
+
+	ms := &managedStream{
+		info: types.StreamLifecycle{
+			ID:         id,
+			UserID:     userID,
+			Title:      title,
+			ScheduleID: scheduleID,
+			State:      types.StreamStateCreated,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+
+	m.streams[id] = ms
+
+	log.Printf("Stream %s created", id)
+
+	return ms.info, nil
+
+}
+
+// Arm records the relays to start once the encoder publishes and the
+// broadcasts to complete when the stream ends, and marks the stream as
+// waiting for its encoder. An encoder that is already publishing on the
+// key takes the stream live straight away.
+func (m *Manager) Arm(id, relayName string, results []multistream.PlatformResult) (types.StreamLifecycle, error) {
+
+	m.streamsLock.Lock()
+
+	ms, exists := m.streams[id]
+
+	if !exists || ms.info.State == types.StreamStateEnded {
+		m.streamsLock.Unlock()
+		return types.StreamLifecycle{}, ErrStreamNotFound
+	}
+
+	ms.relayName = relayName
+
+	ms.results = results
+
+	ms.info.Broadcasts = nil
+
+	for _, result := range results {
+
+		if result.Error == nil {
+			ms.info.Broadcasts = append(ms.info.Broadcasts, types.StreamResponse{
+				Platform: result.Response.Platform,
+				StreamID: result.Response.StreamID,
+				URL:      result.Response.URL,
+			})
+		}
+
+	}
+
+	if ms.info.State == types.StreamStateCreated {
+		m.transition(ms, types.StreamStateWaiting)
+	}
+
+	info := ms.info
+
+	m.streamsLock.Unlock()
+
+	if publisher, publishing := m.mediaServer.Publishers().Active(id); publishing {
+
+		if live, tracked := m.Published(id, publisher.Stream, publisher.ClientID); tracked {
+			info = live
+		}
+
+	}
+
+	return info, nil
+
+}
+
+// Discard forgets a stream whose setup failed. The caller has already
+// cleaned up whatever it had started.
+func (m *Manager) Discard(id string) {
+
+	m.streamsLock.Lock()
+
+	defer m.streamsLock.Unlock()
+
+	if ms, exists := m.streams[id]; exists && ms.info.State != types.StreamStateEnded {
+		delete(m.streams, id)
+	}
+
+}
+
+// Published is called when an encoder starts publishing on the stream's
+// key under the stream name ingest. The relays are (re)started to pull
+// from it. A stream that is ending goes back to live, cancelling its grace
+// window.
+func (m *Manager) Published(id, ingest, clientID string) (types.StreamLifecycle, bool) {
+
+	m.streamsLock.Lock()
+
+	ms, exists := m.streams[id]
+
+	if !exists || ms.finishing || ms.info.State == types.StreamStateEnded {
+		m.streamsLock.Unlock()
+		return types.StreamLifecycle{}, false
+	}
+
+	// The media server may retry its hook for a connection that is already live.
+	if ms.info.State == types.StreamStateLive && ms.clientID == clientID {
+		info := ms.info
+		m.streamsLock.Unlock()
+		return info, true
+	}
+
+	switch ms.info.State {
+
+	case types.StreamStateCreated, types.StreamStateWaiting:
+		ms.info.LiveAt = time.Now()
+
+	case types.StreamStateEnding:
+		ms.generation++
+		ms.info.Reconnects++
+		ms.info.ReconnectDeadline = time.Time{}
+
+	case types.StreamStateLive:
+		// A new encoder replaced the previous one on the key.
+		ms.info.Reconnects++
+
+	}
+
+	ms.ingest = ingest
+
+	ms.clientID = clientID
+
+	m.transition(ms, types.StreamStateLive)
+
+	info := ms.info
+
+	m.streamsLock.Unlock()
+
+	m.restartRelays(ms)
+
+	return info, true
+
+}
+
+// Unpublished is called when the encoder stops publishing. Its relays are
+// stopped, and the stream ends once the reconnect grace window passes
+// without the encoder returning.
+func (m *Manager) Unpublished(id string) (types.StreamLifecycle, bool) {
+
+	m.streamsLock.Lock()
+
+	ms, exists := m.streams[id]
+
+	if !exists || ms.finishing || ms.info.State != types.StreamStateLive {
+		m.streamsLock.Unlock()
+		return types.StreamLifecycle{}, false
+	}
+
+	grace := m.config.ReconnectGrace
+
+	ms.generation++
+
+	generation := ms.generation
+
+	ms.clientID = ""
+
+	ms.info.ReconnectDeadline = time.Now().Add(grace)
+
+	m.transition(ms, types.StreamStateEnding)
+
+	info := ms.info
+
+	m.streamsLock.Unlock()
+
+	m.stopRelays(ms)
+
+	if grace <= 0 {
+		m.finish(id, generation, "encoder disconnected")
+		return info, true
+	}
+
+	log.Printf("Stream %s lost its encoder, waiting %s for it to reconnect", id, grace)
+
+	time.AfterFunc(grace, func() {
+		m.finish(id, generation, "encoder did not reconnect")
+	})
+
+	return info, true
+
+}
+
+// End tears a stream down immediately, whatever state it is in.
+func (m *Manager) End(id, reason string) (types.StreamLifecycle, error) {
+
+	m.streamsLock.Lock()
+
+	ms, exists := m.streams[id]
+
+	if !exists {
+		m.streamsLock.Unlock()
+		return types.StreamLifecycle{}, ErrStreamNotFound
+	}
+
+	ms.generation++
+
+	generation := ms.generation
+
+	m.streamsLock.Unlock()
+
+	m.finish(id, generation, reason)
+
+	return m.Get(id)
+
+}
+
+func (m *Manager) Get(id string) (types.StreamLifecycle, error) {
+
+	m.streamsLock.Lock()
+
+	defer m.streamsLock.Unlock()
+
+	ms, exists := m.streams[id]
+
+	if !exists {
+		return types.StreamLifecycle{}, ErrStreamNotFound
+	}
+
+	return m.withRelays(ms), nil
+
+}
+
+func (m *Manager) List(userID string) []types.StreamLifecycle {
+
+	m.streamsLock.Lock()
+
+	defer m.streamsLock.Unlock()
+
+	streams := []types.StreamLifecycle{}
+
+	for _, ms := range m.streams {
+		if userID == "" || ms.info.UserID == userID {
+			streams = append(streams, m.withRelays(ms))
+		}
+	}
+
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].CreatedAt.Before(streams[j].CreatedAt)
+	})
+
+	return streams
+
+}
+
+// finish stops the relays, completes the broadcasts and removes the stream
+// from the media server, unless the stream has moved on since generation
+// was taken. Broadcasts of a stream that never went live cannot be
+// completed, so they are deleted instead.
+func (m *Manager) finish(id string, generation int, reason string) {
+
+	m.streamsLock.Lock()
+
+	ms, exists := m.streams[id]
+
+	if !exists || ms.generation != generation || ms.finishing || ms.info.State == types.StreamStateEnded {
+		m.streamsLock.Unlock()
+		return
+	}
+
+	ms.finishing = true
+
+	ms.info.EndReason = reason
+
+	ms.info.ReconnectDeadline = time.Time{}
+
+	if ms.info.State != types.StreamStateEnding {
+		m.transition(ms, types.StreamStateEnding)
+	}
+
+	results := ms.results
+
+	wentLive := !ms.info.LiveAt.IsZero()
+
+	m.streamsLock.Unlock()
+
+	log.Printf("Ending stream %s: %s", id, reason)
+
+	m.stopRelays(ms)
+
+	if m.multiStreamService != nil {
+
+		if wentLive {
+			m.multiStreamService.CompleteMultiStream(results)
+		} else if err := m.multiStreamService.DeleteMultiStream(results); err != nil {
+			log.Printf("Failed to delete the broadcasts of stream %s: %v", id, err)
+		}
+
+	}
+
+	if _, exists := m.mediaServer.GetStream(id); exists {
+
+		if err := m.mediaServer.RemoveStream(id); err != nil {
+			log.Printf("Failed to remove stream %s: %v", id, err)
+		}
+
+	}
+
+	m.streamsLock.Lock()
+
+	ms.finishing = false
+
+	ms.info.EndedAt = time.Now()
+
+	m.transition(ms, types.StreamStateEnded)
+
+	info := ms.info
+
+	callbacks := append([]func(types.StreamLifecycle){}, m.onEnded...)
+
+	m.streamsLock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(info)
+	}
+
+}
+
+// restartRelays stops any relays still running for the stream and starts
+// them again against the current encoder's stream.
+func (m *Manager) restartRelays(ms *managedStream) {
+
+	if m.multiStreamService == nil {
+		return
+	}
+
+	ms.relayLock.Lock()
+
+	defer ms.relayLock.Unlock()
+
+	m.streamsLock.Lock()
+
+	relayName := ms.relayName
+
+	results := ms.results
+
+	ingest := ms.ingest
+
+	finishing := ms.finishing || ms.info.State != types.StreamStateLive
+
+	m.streamsLock.Unlock()
+
+	if relayName == "" || finishing {
+		return
+	}
+
+	m.multiStreamService.StopRelays(relayName, results)
+
+	// Start from the provisioned results so that a relay that failed to
+	// start last time is retried.
+	armed := make([]multistream.PlatformResult, len(results))
+
+	copy(armed, results)
+
+	started, err := m.multiStreamService.StartRelays(relayName, m.mediaServer.GetIngestURL(ingest)+"?"+mediaserver.RelayParam+"=1", armed)
+
+	if err != nil {
+		log.Printf("Failed to start relays for stream %s: %v", ms.info.ID, err)
+	}
+
+	for _, result := range started {
+
+		if result.Error != nil {
+			log.Printf("Relay to %s for stream %s did not start: %v", result.Platform, ms.info.ID, result.Error)
+		}
+
+	}
+
+}
+
+// stopRelays stops the stream's relays unless the encoder has come back
+// in the meantime and they were already restarted.
+func (m *Manager) stopRelays(ms *managedStream) {
+
+	if m.multiStreamService == nil {
+		return
+	}
+
+	ms.relayLock.Lock()
+
+	defer ms.relayLock.Unlock()
+
+	m.streamsLock.Lock()
+
+	relayName := ms.relayName
+
+	results := ms.results
+
+	live := ms.info.State == types.StreamStateLive && !ms.finishing
+
+	m.streamsLock.Unlock()
+
+	if relayName != "" && !live {
+		m.multiStreamService.StopRelays(relayName, results)
+	}
+
+}
+
+// withRelays is the stream's lifecycle with the state of its relays.
+func (m *Manager) withRelays(ms *managedStream) types.StreamLifecycle {
+
+	info := ms.info
+
+	if m.multiStreamService != nil && ms.relayName != "" {
+		info.Relays = m.multiStreamService.Relays(ms.relayName)
+	}
+
+	return info
+
+}
+
+func (m *Manager) transition(ms *managedStream, state types.StreamState) {
+
+	log.Printf("Stream %s: %s -> %s", ms.info.ID, ms.info.State, state)
+
+	ms.info.State = state
+
+	ms.info.UpdatedAt = time.Now()
+
+}
@@ -0,0 +1,116 @@
+package lifecycle
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/OODemi52/chronocast-server/internal/media-server/embedded"
+	"github.com/OODemi52/chronocast-server/internal/services/ffmpeg"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// fakePlatform records which broadcasts were completed and deleted.
+type fakePlatform struct {
+	completed []string
+	deleted   []string
+}
+
+func (p *fakePlatform) Authenticate(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (p *fakePlatform) CreateStream(options types.StreamOptions) (types.StreamResponse, error) {
+	return types.StreamResponse{}, nil
+}
+
+func (p *fakePlatform) UpdateStream(id string, options types.StreamOptions) error {
+	return nil
+}
+
+func (p *fakePlatform) DeleteStream(id string) error {
+
+	p.deleted = append(p.deleted, id)
+
+	return nil
+
+}
+
+func (p *fakePlatform) CompleteStream(id string) error {
+
+	p.completed = append(p.completed, id)
+
+	return nil
+
+}
+
+func TestFinishBroadcasts(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		live      bool
+		completed []string
+		deleted   []string
+	}{
+		{name: "went live", live: true, completed: []string{"broadcast"}},
+		{name: "never went live", deleted: []string{"broadcast"}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			server, err := embedded.NewServer(":0")
+
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			platform := &fakePlatform{}
+
+			m := NewManager(server, &multistream.MultiStreamService{
+				Platforms:     map[string]types.StreamPlatform{"youtube": platform},
+				FFmpegService: ffmpeg.NewFFmpegService(),
+			})
+
+			if _, err := m.Create("key-id", "user", "Show", ""); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			// No relay name, so going live starts no FFmpeg relays.
+			results := []multistream.PlatformResult{
+				{Platform: "youtube", Response: types.StreamResponse{Platform: "youtube", StreamID: "broadcast"}},
+			}
+
+			if _, err := m.Arm("key-id", "", results); err != nil {
+				t.Fatalf("Arm: %v", err)
+			}
+
+			if test.live {
+
+				if _, tracked := m.Published("key-id", "key-id", "client"); !tracked {
+					t.Fatalf("Published did not track the stream")
+				}
+
+			}
+
+			info, err := m.End("key-id", "test")
+
+			if err != nil {
+				t.Fatalf("End: %v", err)
+			}
+
+			if info.State != types.StreamStateEnded {
+				t.Fatalf("state %s, want %s", info.State, types.StreamStateEnded)
+			}
+
+			if !slices.Equal(platform.completed, test.completed) || !slices.Equal(platform.deleted, test.deleted) {
+				t.Fatalf("completed %v and deleted %v, want %v and %v", platform.completed, platform.deleted, test.completed, test.deleted)
+			}
+
+		})
+
+	}
+
+}
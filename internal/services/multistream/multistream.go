@@ -1,9 +1,12 @@
 package multistream
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
-	rtmpserver "github.com/OODemi52/chronocast-server/internal/rtmp-server"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
 	"github.com/OODemi52/chronocast-server/internal/services/factory"
 	"github.com/OODemi52/chronocast-server/internal/services/ffmpeg"
 	"github.com/OODemi52/chronocast-server/internal/types"
@@ -17,7 +20,7 @@ type MultiStreamService struct {
 type PlatformResult struct {
 	Platform        string
 	Response        types.StreamResponse
-	RTMPDestination rtmpserver.StreamDestination
+	RTMPDestination mediaserver.StreamDestination
 	Error           error
 }
 
@@ -47,7 +50,7 @@ func NewMultiStreamService() (*MultiStreamService, error) {
 
 }
 
-func (mss *MultiStreamService) CreateMultiStream(platforms []string, options types.StreamOptions, inputStreamURL string) ([]PlatformResult, error) {
+func (mss *MultiStreamService) ProvisionMultiStream(platforms []string, options types.StreamOptions) ([]PlatformResult, error) {
 
 	var results []PlatformResult
 
@@ -78,57 +81,168 @@ func (mss *MultiStreamService) CreateMultiStream(platforms []string, options typ
 			result.Error = err
 			errors = append(errors, fmt.Errorf("failed on %s: %w", platformName, err))
 		} else {
-			rtmpDestination := getRTMPDestination(platformName, response)
+			result.RTMPDestination = getRTMPDestination(platformName, response)
+		}
+
+		results = append(results, result)
+
+	}
+
+	if len(errors) == len(platforms) {
+		return results, fmt.Errorf("all platforms failed: %v", errors)
+	}
+
+	return results, nil
 
-			result.RTMPDestination = rtmpDestination
+}
 
-			outputURL := fmt.Sprintf("%s%s", rtmpDestination.URL, rtmpDestination.StreamKey)
+func (mss *MultiStreamService) StartRelays(name, inputStreamURL string, results []PlatformResult) ([]PlatformResult, error) {
 
-			err := mss.FFmpegService.StartProcess(fmt.Sprintf("%s:%s", options.Title, platformName), inputStreamURL, outputURL)
+	var errors []error
 
-			if err != nil {
-				result.Error = fmt.Errorf("failed to start FFmpeg for %s: %w", platformName, err)
-				errors = append(errors, result.Error)
-			}
+	started := 0
 
+	for i, result := range results {
+
+		if result.Error != nil {
+			continue
 		}
 
-		results = append(results, result)
+		outputURL := fmt.Sprintf("%s%s", result.RTMPDestination.URL, result.RTMPDestination.StreamKey)
+
+		err := mss.FFmpegService.StartProcess(fmt.Sprintf("%s:%s", name, result.Platform), inputStreamURL, outputURL)
+
+		if err != nil {
+			results[i].Error = fmt.Errorf("failed to start FFmpeg for %s: %w", result.Platform, err)
+			errors = append(errors, results[i].Error)
+			continue
+		}
+
+		started++
 
 	}
 
-	if len(errors) == len(platforms) {
-		return results, fmt.Errorf("all platforms failed: %v", errors)
+	if started == 0 && len(errors) > 0 {
+		return results, fmt.Errorf("all relays failed: %v", errors)
 	}
 
 	return results, nil
 
 }
 
-func getRTMPDestination(platform string, response types.StreamResponse) rtmpserver.StreamDestination {
+func (mss *MultiStreamService) StopRelays(name string, results []PlatformResult) {
+
+	for _, result := range results {
+
+		if err := mss.FFmpegService.StopProcess(fmt.Sprintf("%s:%s", name, result.Platform)); err != nil {
+			log.Printf("Failed to stop relay for %s on %s: %v", name, result.Platform, err)
+		}
+
+	}
+
+}
+
+// Relays returns the status of the relays started under name, or of every
+// relay when name is empty.
+func (mss *MultiStreamService) Relays(name string) []types.RelayStatus {
+
+	prefix := ""
+
+	if name != "" {
+		prefix = name + ":"
+	}
+
+	relays := mss.FFmpegService.Relays(prefix)
+
+	for i, relay := range relays {
+
+		if separator := strings.LastIndex(relay.Name, ":"); separator >= 0 {
+			relays[i].Platform = relay.Name[separator+1:]
+		}
+
+	}
+
+	return relays
+
+}
+
+// DeleteMultiStream deletes the platform broadcasts of a stream that will
+// not go ahead. Every broadcast is attempted; the failures are returned
+// together.
+func (mss *MultiStreamService) DeleteMultiStream(results []PlatformResult) error {
+
+	var errs []error
+
+	for _, result := range results {
+
+		if result.Error != nil || result.Response.StreamID == "" {
+			continue
+		}
+
+		service, exists := mss.Platforms[result.Platform]
+
+		if !exists {
+			continue
+		}
+
+		if err := service.DeleteStream(result.Response.StreamID); err != nil {
+			log.Printf("Failed to delete %s broadcast %s: %v", result.Platform, result.Response.StreamID, err)
+			errs = append(errs, fmt.Errorf("%s broadcast %s: %w", result.Platform, result.Response.StreamID, err))
+		}
+
+	}
+
+	return errors.Join(errs...)
+
+}
+
+// CompleteMultiStream ends the platform broadcasts once the stream is over.
+func (mss *MultiStreamService) CompleteMultiStream(results []PlatformResult) {
+
+	for _, result := range results {
+
+		if result.Error != nil || result.Response.StreamID == "" {
+			continue
+		}
+
+		service, exists := mss.Platforms[result.Platform]
+
+		if !exists {
+			continue
+		}
+
+		if err := service.CompleteStream(result.Response.StreamID); err != nil {
+			log.Printf("Failed to complete %s broadcast %s: %v", result.Platform, result.Response.StreamID, err)
+		}
+
+	}
+
+}
+
+func getRTMPDestination(platform string, response types.StreamResponse) mediaserver.StreamDestination {
 
 	switch platform {
 
 	case "youtube":
-		return rtmpserver.StreamDestination{
+		return mediaserver.StreamDestination{
 			URL:       "rtmp://a.rtmp.youtube.com/live2/",
 			StreamKey: response.StreamKey,
 		}
 
 	case "twitch":
-		return rtmpserver.StreamDestination{
+		return mediaserver.StreamDestination{
 			URL:       "rtmp://live.twitch.tv/app/",
 			StreamKey: response.StreamKey,
 		}
 
 	case "facebook":
-		return rtmpserver.StreamDestination{
+		return mediaserver.StreamDestination{
 			URL:       "rtmps://live-api-s.facebook.com:443/rtmp/",
 			StreamKey: response.StreamKey,
 		}
 
 	default:
-		return rtmpserver.StreamDestination{}
+		return mediaserver.StreamDestination{}
 
 	}
 
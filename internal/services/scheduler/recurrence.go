@@ -0,0 +1,676 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+// maxRecurrencePeriods bounds how far ahead a rule is walked when looking for
+// the next occurrence, so a rule that can never match does not spin forever.
+const maxRecurrencePeriods = 5000
+
+// recurrenceRule yields the occurrences of a recurring schedule. All wall
+// clock arithmetic happens in the rule's location, so a show at 19:00
+// Europe/Berlin stays at 19:00 local time across DST changes.
+type recurrenceRule interface {
+	next(after time.Time) (time.Time, bool)
+}
+
+func parseRecurrence(recurrence types.Recurrence, start time.Time) (recurrenceRule, error) {
+
+	location := time.UTC
+
+	if recurrence.Timezone != "" {
+
+		loc, err := time.LoadLocation(recurrence.Timezone)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", recurrence.Timezone, err)
+		}
+
+		location = loc
+
+	}
+
+	switch {
+
+	case recurrence.RRule != "" && recurrence.Cron != "":
+		return nil, fmt.Errorf("recurrence must set either rrule or cron, not both")
+
+	case recurrence.RRule != "":
+		return parseRRule(recurrence.RRule, start.In(location))
+
+	case recurrence.Cron != "":
+		return parseCron(recurrence.Cron, start.In(location))
+
+	default:
+		return nil, fmt.Errorf("recurrence must set rrule or cron")
+
+	}
+
+}
+
+type rruleFrequency int
+
+const (
+	frequencyDaily rruleFrequency = iota
+	frequencyWeekly
+	frequencyMonthly
+)
+
+type weekdayOrdinal struct {
+	weekday time.Weekday
+	ordinal int
+}
+
+// rrule implements the subset of RFC 5545 recurrence rules used for
+// broadcast schedules: FREQ (DAILY, WEEKLY, MONTHLY), INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY, BYHOUR and BYMINUTE. Weeks start on Monday.
+type rrule struct {
+	start       time.Time
+	frequency   rruleFrequency
+	interval    int
+	count       int
+	until       time.Time
+	byDay       []weekdayOrdinal
+	byMonthDay  []int
+	byHour      []int
+	byMinute    []int
+	hasByDay    bool
+	hasMonthDay bool
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+func parseRRule(value string, start time.Time) (*rrule, error) {
+
+	rule := &rrule{
+		start:    start.Truncate(time.Minute),
+		interval: 1,
+		byHour:   []int{start.Hour()},
+		byMinute: []int{start.Minute()},
+	}
+
+	hasFrequency := false
+
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(value), "RRULE:"), ";") {
+
+		if part == "" {
+			continue
+		}
+
+		name, val, found := strings.Cut(part, "=")
+
+		if !found {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+
+		var err error
+
+		switch strings.ToUpper(name) {
+
+		case "FREQ":
+			hasFrequency = true
+
+			switch strings.ToUpper(val) {
+			case "DAILY":
+				rule.frequency = frequencyDaily
+			case "WEEKLY":
+				rule.frequency = frequencyWeekly
+			case "MONTHLY":
+				rule.frequency = frequencyMonthly
+			default:
+				return nil, fmt.Errorf("unsupported rrule frequency %q", val)
+			}
+
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(val)
+
+			if err == nil && rule.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+
+		case "COUNT":
+			rule.count, err = strconv.Atoi(val)
+
+			if err == nil && rule.count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+
+		case "UNTIL":
+			rule.until, err = parseRRuleTime(val, start.Location())
+
+		case "BYDAY":
+			rule.hasByDay = true
+			rule.byDay, err = parseByDay(val)
+
+		case "BYMONTHDAY":
+			rule.hasMonthDay = true
+			rule.byMonthDay, err = parseIntList(val, -31, 31)
+
+		case "BYHOUR":
+			rule.byHour, err = parseIntList(val, 0, 23)
+
+		case "BYMINUTE":
+			rule.byMinute, err = parseIntList(val, 0, 59)
+
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %q", name)
+
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid rrule %s %q: %v", name, val, err)
+		}
+
+	}
+
+	if !hasFrequency {
+		return nil, fmt.Errorf("rrule is missing FREQ")
+	}
+
+	for _, day := range rule.byDay {
+
+		if day.ordinal != 0 && rule.frequency != frequencyMonthly {
+			return nil, fmt.Errorf("ordinal BYDAY values are only supported with FREQ=MONTHLY")
+		}
+
+	}
+
+	sort.Ints(rule.byHour)
+
+	sort.Ints(rule.byMinute)
+
+	return rule, nil
+
+}
+
+func parseRRuleTime(value string, location *time.Location) (time.Time, error) {
+
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+
+		loc := location
+
+		if strings.HasSuffix(layout, "Z") {
+			loc = time.UTC
+		}
+
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+
+			return t, nil
+
+		}
+
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date format")
+
+}
+
+func parseByDay(value string) ([]weekdayOrdinal, error) {
+
+	var days []weekdayOrdinal
+
+	for _, item := range strings.Split(value, ",") {
+
+		item = strings.ToUpper(strings.TrimSpace(item))
+
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid weekday %q", item)
+		}
+
+		weekday, exists := rruleWeekdays[item[len(item)-2:]]
+
+		if !exists {
+			return nil, fmt.Errorf("invalid weekday %q", item)
+		}
+
+		ordinal := 0
+
+		if prefix := item[:len(item)-2]; prefix != "" {
+
+			n, err := strconv.Atoi(prefix)
+
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("invalid weekday ordinal %q", item)
+			}
+
+			ordinal = n
+
+		}
+
+		days = append(days, weekdayOrdinal{weekday: weekday, ordinal: ordinal})
+
+	}
+
+	return days, nil
+
+}
+
+func parseIntList(value string, min, max int) ([]int, error) {
+
+	var values []int
+
+	for _, item := range strings.Split(value, ",") {
+
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+
+		if err != nil || n < min || n > max || n == 0 && min < 0 {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+
+		values = append(values, n)
+
+	}
+
+	return values, nil
+
+}
+
+func (r *rrule) next(after time.Time) (time.Time, bool) {
+
+	seen := 0
+
+	for period := 0; period < maxRecurrencePeriods; period++ {
+
+		for _, candidate := range r.candidates(period) {
+
+			if candidate.Before(r.start) {
+				continue
+			}
+
+			if !r.until.IsZero() && candidate.After(r.until) {
+				return time.Time{}, false
+			}
+
+			seen++
+
+			if r.count > 0 && seen > r.count {
+				return time.Time{}, false
+			}
+
+			if candidate.After(after) {
+				return candidate, true
+			}
+
+		}
+
+	}
+
+	return time.Time{}, false
+
+}
+
+// candidates returns the sorted occurrences that fall into the n-th period
+// (day, week or month, stepped by INTERVAL) counted from the rule start.
+func (r *rrule) candidates(period int) []time.Time {
+
+	var days []time.Time
+
+	start := r.start
+
+	switch r.frequency {
+
+	case frequencyDaily:
+		day := time.Date(start.Year(), start.Month(), start.Day()+period*r.interval, 0, 0, 0, 0, start.Location())
+
+		if r.matchesDay(day) {
+			days = append(days, day)
+		}
+
+	case frequencyWeekly:
+		offset := (int(start.Weekday()) + 6) % 7
+
+		monday := time.Date(start.Year(), start.Month(), start.Day()-offset+period*r.interval*7, 0, 0, 0, 0, start.Location())
+
+		for i := 0; i < 7; i++ {
+
+			day := monday.AddDate(0, 0, i)
+
+			if r.hasByDay || r.hasMonthDay {
+
+				if r.matchesDay(day) {
+					days = append(days, day)
+				}
+
+			} else if day.Weekday() == start.Weekday() {
+				days = append(days, day)
+			}
+
+		}
+
+	case frequencyMonthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(period*r.interval), 1, 0, 0, 0, 0, start.Location())
+
+		for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+
+			if r.hasByDay || r.hasMonthDay {
+
+				if r.matchesDay(day) {
+					days = append(days, day)
+				}
+
+			} else if day.Day() == start.Day() {
+				days = append(days, day)
+			}
+
+		}
+
+	}
+
+	var candidates []time.Time
+
+	seen := make(map[int64]bool)
+
+	for _, day := range days {
+
+		for _, hour := range r.byHour {
+
+			for _, minute := range r.byMinute {
+
+				candidate := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+
+				// A wall clock time that falls into a DST gap is read with
+				// the UTC offset from before the gap, as RFC 5545 asks,
+				// which moves it forward by the length of the gap. One that
+				// lands on another occurrence is not doubled up.
+				if candidate.Hour() != hour || candidate.Minute() != minute {
+
+					_, offset := candidate.Add(-12 * time.Hour).Zone()
+
+					wall := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+
+					candidate = wall.Add(-time.Duration(offset) * time.Second).In(day.Location())
+
+				}
+
+				if seen[candidate.Unix()] {
+					continue
+				}
+
+				seen[candidate.Unix()] = true
+
+				candidates = append(candidates, candidate)
+
+			}
+
+		}
+
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	return candidates
+
+}
+
+func (r *rrule) matchesDay(day time.Time) bool {
+
+	if r.hasMonthDay {
+
+		daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+
+		matched := false
+
+		for _, monthDay := range r.byMonthDay {
+
+			if monthDay == day.Day() || monthDay < 0 && daysInMonth+monthDay+1 == day.Day() {
+				matched = true
+				break
+			}
+
+		}
+
+		if !matched {
+			return false
+		}
+
+	}
+
+	if !r.hasByDay {
+		return true
+	}
+
+	for _, byDay := range r.byDay {
+
+		if byDay.weekday != day.Weekday() {
+			continue
+		}
+
+		if byDay.ordinal == 0 {
+			return true
+		}
+
+		daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+
+		if byDay.ordinal > 0 && (day.Day()-1)/7+1 == byDay.ordinal {
+			return true
+		}
+
+		if byDay.ordinal < 0 && (daysInMonth-day.Day())/7+1 == -byDay.ordinal {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// cronRule implements standard five field cron expressions
+// (minute hour day-of-month month day-of-week) evaluated in a location.
+// As in Vixie cron, when both day fields are restricted a day matches if
+// either of them does.
+type cronRule struct {
+	start       time.Time
+	minutes     []bool
+	hours       []bool
+	monthDays   []bool
+	months      []bool
+	weekdays    []bool
+	anyMonthDay bool
+	anyWeekday  bool
+}
+
+func parseCron(value string, start time.Time) (*cronRule, error) {
+
+	fields := strings.Fields(value)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	rule := &cronRule{
+		start:       start,
+		anyMonthDay: fields[2] == "*",
+		anyWeekday:  fields[4] == "*",
+	}
+
+	var err error
+
+	if rule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid cron minute: %v", err)
+	}
+
+	if rule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid cron hour: %v", err)
+	}
+
+	if rule.monthDays, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid cron day of month: %v", err)
+	}
+
+	if rule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid cron month: %v", err)
+	}
+
+	if rule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid cron day of week: %v", err)
+	}
+
+	if rule.weekdays[7] {
+		rule.weekdays[0] = true
+	}
+
+	return rule, nil
+
+}
+
+func parseCronField(field string, min, max int) ([]bool, error) {
+
+	values := make([]bool, max+1)
+
+	for _, item := range strings.Split(field, ",") {
+
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+
+		if hasStep {
+
+			n, err := strconv.Atoi(stepPart)
+
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step %q", item)
+			}
+
+			step = n
+
+		}
+
+		low, high := min, max
+
+		if rangePart != "*" {
+
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+
+			n, err := strconv.Atoi(lowPart)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+
+			low, high = n, n
+
+			if isRange {
+
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return nil, fmt.Errorf("invalid value %q", item)
+				}
+
+			} else if hasStep {
+				high = max
+			}
+
+		}
+
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("value %q out of range %d-%d", item, min, max)
+		}
+
+		for i := low; i <= high; i += step {
+			values[i] = true
+		}
+
+	}
+
+	return values, nil
+
+}
+
+func (c *cronRule) next(after time.Time) (time.Time, bool) {
+
+	if after.Before(c.start) {
+		after = c.start.Add(-time.Minute)
+	}
+
+	from := after.In(c.start.Location())
+
+	for i := 0; i < maxRecurrencePeriods; i++ {
+
+		day := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, from.Location())
+
+		if !c.matchesDay(day) {
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+
+			if !c.hours[hour] {
+				continue
+			}
+
+			for minute := 0; minute < 60; minute++ {
+
+				if !c.minutes[minute] {
+					continue
+				}
+
+				candidate := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+
+				// Wall clock times that fall into a DST gap are normalized
+				// forward by time.Date; skip them so they are not doubled up.
+				if candidate.Hour() != hour || candidate.Minute() != minute {
+					continue
+				}
+
+				if candidate.After(after) {
+					return candidate, true
+				}
+
+			}
+
+		}
+
+	}
+
+	return time.Time{}, false
+
+}
+
+func (c *cronRule) matchesDay(day time.Time) bool {
+
+	if !c.months[int(day.Month())] {
+		return false
+	}
+
+	monthDay := c.monthDays[day.Day()]
+
+	weekday := c.weekdays[int(day.Weekday())]
+
+	switch {
+
+	case c.anyMonthDay && c.anyWeekday:
+		return true
+
+	case c.anyMonthDay:
+		return weekday
+
+	case c.anyWeekday:
+		return monthDay
+
+	default:
+		return monthDay || weekday
+
+	}
+
+}
@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/types"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+
+	t.Helper()
+
+	location, err := time.LoadLocation(name)
+
+	if err != nil {
+		t.Skipf("timezone %s is not available: %v", name, err)
+	}
+
+	return location
+
+}
+
+// occurrences returns up to n occurrences of a rule, in order.
+func occurrences(rule recurrenceRule, n int) []time.Time {
+
+	var result []time.Time
+
+	after := time.Time{}
+
+	for len(result) < n {
+
+		next, ok := rule.next(after)
+
+		if !ok {
+			break
+		}
+
+		result = append(result, next)
+
+		after = next
+
+	}
+
+	return result
+
+}
+
+func assertTimes(t *testing.T, got []time.Time, want ...time.Time) {
+
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d occurrences %v, want %d %v", len(got), got, len(want), want)
+	}
+
+	for i := range want {
+
+		if !got[i].Equal(want[i]) {
+			t.Errorf("occurrence %d = %s, want %s", i, got[i], want[i])
+		}
+
+	}
+
+}
+
+func TestRRule(t *testing.T) {
+
+	berlin := mustLocation(t, "Europe/Berlin")
+
+	start := time.Date(2026, 1, 5, 19, 0, 0, 0, berlin)
+
+	tests := []struct {
+		name  string
+		rrule string
+		want  []time.Time
+	}{
+		{
+			name:  "weekly on two days with a count",
+			rrule: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3",
+			want: []time.Time{
+				time.Date(2026, 1, 5, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 7, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 12, 19, 0, 0, 0, berlin),
+			},
+		},
+		{
+			name:  "every other day until a date",
+			rrule: "RRULE:FREQ=DAILY;INTERVAL=2;UNTIL=20260109",
+			want: []time.Time{
+				time.Date(2026, 1, 5, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 7, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 9, 19, 0, 0, 0, berlin),
+			},
+		},
+		{
+			name:  "last friday of the month",
+			rrule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			want: []time.Time{
+				time.Date(2026, 1, 30, 19, 0, 0, 0, berlin),
+				time.Date(2026, 2, 27, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 27, 19, 0, 0, 0, berlin),
+			},
+		},
+		{
+			name:  "month days and several times a day",
+			rrule: "FREQ=MONTHLY;BYMONTHDAY=1,-1;BYHOUR=9,18;BYMINUTE=30;COUNT=4",
+			want: []time.Time{
+				time.Date(2026, 1, 31, 9, 30, 0, 0, berlin),
+				time.Date(2026, 1, 31, 18, 30, 0, 0, berlin),
+				time.Date(2026, 2, 1, 9, 30, 0, 0, berlin),
+				time.Date(2026, 2, 1, 18, 30, 0, 0, berlin),
+			},
+		},
+		{
+			name:  "local time is kept across the DST change",
+			rrule: "FREQ=WEEKLY;BYDAY=SU;UNTIL=20260405",
+			want: []time.Time{
+				time.Date(2026, 1, 11, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 18, 19, 0, 0, 0, berlin),
+				time.Date(2026, 1, 25, 19, 0, 0, 0, berlin),
+				time.Date(2026, 2, 1, 19, 0, 0, 0, berlin),
+				time.Date(2026, 2, 8, 19, 0, 0, 0, berlin),
+				time.Date(2026, 2, 15, 19, 0, 0, 0, berlin),
+				time.Date(2026, 2, 22, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 1, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 8, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 15, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 22, 19, 0, 0, 0, berlin),
+				time.Date(2026, 3, 29, 19, 0, 0, 0, berlin),
+				time.Date(2026, 4, 5, 19, 0, 0, 0, berlin),
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			rule, err := parseRecurrence(types.Recurrence{RRule: test.rrule, Timezone: "Europe/Berlin"}, start)
+
+			if err != nil {
+				t.Fatalf("parseRecurrence: %v", err)
+			}
+
+			assertTimes(t, occurrences(rule, 20), test.want...)
+
+		})
+
+	}
+
+}
+
+func TestRRuleDSTGap(t *testing.T) {
+
+	newYork := mustLocation(t, "America/New_York")
+
+	// Clocks in New York skip from 02:00 to 03:00 on 2026-03-08.
+	start := time.Date(2026, 3, 7, 2, 30, 0, 0, newYork)
+
+	t.Run("a time in the gap moves forward", func(t *testing.T) {
+
+		rule, err := parseRecurrence(types.Recurrence{RRule: "FREQ=DAILY;COUNT=3", Timezone: "America/New_York"}, start)
+
+		if err != nil {
+			t.Fatalf("parseRecurrence: %v", err)
+		}
+
+		assertTimes(t, occurrences(rule, 5),
+			time.Date(2026, 3, 7, 2, 30, 0, 0, newYork),
+			time.Date(2026, 3, 8, 3, 30, 0, 0, newYork),
+			time.Date(2026, 3, 9, 2, 30, 0, 0, newYork),
+		)
+
+	})
+
+	t.Run("a time in the gap moves forward east of UTC", func(t *testing.T) {
+
+		berlin := mustLocation(t, "Europe/Berlin")
+
+		rule, err := parseRecurrence(types.Recurrence{RRule: "FREQ=WEEKLY;COUNT=2", Timezone: "Europe/Berlin"}, time.Date(2026, 3, 22, 2, 30, 0, 0, berlin))
+
+		if err != nil {
+			t.Fatalf("parseRecurrence: %v", err)
+		}
+
+		assertTimes(t, occurrences(rule, 5),
+			time.Date(2026, 3, 22, 2, 30, 0, 0, berlin),
+			time.Date(2026, 3, 29, 3, 30, 0, 0, berlin),
+		)
+
+	})
+
+	t.Run("a moved time is not doubled up", func(t *testing.T) {
+
+		rule, err := parseRecurrence(types.Recurrence{RRule: "FREQ=DAILY;BYHOUR=2,3;BYMINUTE=30;UNTIL=20260308", Timezone: "America/New_York"}, start)
+
+		if err != nil {
+			t.Fatalf("parseRecurrence: %v", err)
+		}
+
+		assertTimes(t, occurrences(rule, 5),
+			time.Date(2026, 3, 7, 2, 30, 0, 0, newYork),
+			time.Date(2026, 3, 7, 3, 30, 0, 0, newYork),
+			time.Date(2026, 3, 8, 3, 30, 0, 0, newYork),
+		)
+
+	})
+
+}
+
+func TestCron(t *testing.T) {
+
+	newYork := mustLocation(t, "America/New_York")
+
+	tests := []struct {
+		name  string
+		cron  string
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "weekdays",
+			cron:  "0 19 * * 1-5",
+			start: time.Date(2026, 1, 9, 12, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 1, 9, 19, 0, 0, 0, newYork),
+				time.Date(2026, 1, 12, 19, 0, 0, 0, newYork),
+				time.Date(2026, 1, 13, 19, 0, 0, 0, newYork),
+			},
+		},
+		{
+			name:  "steps",
+			cron:  "*/20 9 1 * *",
+			start: time.Date(2026, 1, 1, 0, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 9, 0, 0, 0, newYork),
+				time.Date(2026, 1, 1, 9, 20, 0, 0, newYork),
+				time.Date(2026, 1, 1, 9, 40, 0, 0, newYork),
+			},
+		},
+		{
+			name:  "either day field matches when both are set",
+			cron:  "0 8 13 * 5",
+			start: time.Date(2026, 2, 1, 0, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 2, 6, 8, 0, 0, 0, newYork),
+				time.Date(2026, 2, 13, 8, 0, 0, 0, newYork),
+				time.Date(2026, 2, 20, 8, 0, 0, 0, newYork),
+			},
+		},
+		{
+			name:  "a time in the DST gap is skipped",
+			cron:  "30 2 * * *",
+			start: time.Date(2026, 3, 7, 0, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2026, 3, 7, 2, 30, 0, 0, newYork),
+				time.Date(2026, 3, 9, 2, 30, 0, 0, newYork),
+				time.Date(2026, 3, 10, 2, 30, 0, 0, newYork),
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			rule, err := parseRecurrence(types.Recurrence{Cron: test.cron, Timezone: "America/New_York"}, test.start)
+
+			if err != nil {
+				t.Fatalf("parseRecurrence: %v", err)
+			}
+
+			assertTimes(t, occurrences(rule, len(test.want)), test.want...)
+
+		})
+
+	}
+
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+
+	start := time.Date(2026, 1, 5, 19, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		recurrence types.Recurrence
+	}{
+		{"neither rule", types.Recurrence{}},
+		{"both rules", types.Recurrence{RRule: "FREQ=DAILY", Cron: "0 19 * * *"}},
+		{"unknown timezone", types.Recurrence{RRule: "FREQ=DAILY", Timezone: "Mars/Olympus"}},
+		{"missing frequency", types.Recurrence{RRule: "COUNT=3"}},
+		{"unsupported frequency", types.Recurrence{RRule: "FREQ=YEARLY"}},
+		{"unsupported part", types.Recurrence{RRule: "FREQ=DAILY;BYSETPOS=1"}},
+		{"zero interval", types.Recurrence{RRule: "FREQ=DAILY;INTERVAL=0"}},
+		{"ordinal outside monthly", types.Recurrence{RRule: "FREQ=WEEKLY;BYDAY=1MO"}},
+		{"bad weekday", types.Recurrence{RRule: "FREQ=WEEKLY;BYDAY=XX"}},
+		{"zero month day", types.Recurrence{RRule: "FREQ=MONTHLY;BYMONTHDAY=0"}},
+		{"bad until", types.Recurrence{RRule: "FREQ=DAILY;UNTIL=tomorrow"}},
+		{"short cron", types.Recurrence{Cron: "0 19 * *"}},
+		{"cron out of range", types.Recurrence{Cron: "60 19 * * *"}},
+		{"cron bad step", types.Recurrence{Cron: "*/0 19 * * *"}},
+		{"cron reversed range", types.Recurrence{Cron: "0 19 * * 5-1"}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			if _, err := parseRecurrence(test.recurrence, start); err == nil {
+				t.Errorf("parseRecurrence(%+v) succeeded, want an error", test.recurrence)
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var schedulesBucket = []byte("schedules")
+
+// scheduleRecord is what is kept of an entry. The recurrence rule is parsed
+// again from the schedule when it is loaded.
+type scheduleRecord struct {
+	Schedule     types.ScheduledStream `json:"schedule"`
+	Results      []resultRecord        `json:"results,omitempty"`
+	Cursor       time.Time             `json:"cursor,omitzero"`
+	Materialized map[string]string     `json:"materialized,omitempty"`
+}
+
+type resultRecord struct {
+	Platform    string                        `json:"platform"`
+	Response    types.StreamResponse          `json:"response"`
+	Destination mediaserver.StreamDestination `json:"destination"`
+	Error       string                        `json:"error,omitempty"`
+}
+
+// scheduleStore keeps schedules across restarts. Implementations must be
+// safe for concurrent use.
+type scheduleStore interface {
+	Put(record scheduleRecord) error
+	List() ([]scheduleRecord, error)
+}
+
+// newScheduleStore keeps schedules in db, the file the stream keys are in,
+// or in memory if there is none.
+func newScheduleStore(db *bolt.DB) scheduleStore {
+
+	if db == nil {
+		return newMemoryScheduleStore()
+	}
+
+	return &boltScheduleStore{db: db}
+
+}
+
+type memoryScheduleStore struct {
+	records     map[string]scheduleRecord
+	recordsLock sync.RWMutex
+}
+
+func newMemoryScheduleStore() *memoryScheduleStore {
+
+	return &memoryScheduleStore{records: make(map[string]scheduleRecord)}
+
+}
+
+func (ms *memoryScheduleStore) Put(record scheduleRecord) error {
+
+	ms.recordsLock.Lock()
+
+	defer ms.recordsLock.Unlock()
+
+	ms.records[record.Schedule.ID] = record
+
+	return nil
+
+}
+
+func (ms *memoryScheduleStore) List() ([]scheduleRecord, error) {
+
+	ms.recordsLock.RLock()
+
+	defer ms.recordsLock.RUnlock()
+
+	records := make([]scheduleRecord, 0, len(ms.records))
+
+	for _, record := range ms.records {
+		records = append(records, record)
+	}
+
+	return records, nil
+
+}
+
+// boltScheduleStore keeps schedules as JSON keyed by schedule ID in a bucket
+// of the stream key database.
+type boltScheduleStore struct {
+	db *bolt.DB
+}
+
+func (bs *boltScheduleStore) Put(record scheduleRecord) error {
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule: %v", err)
+	}
+
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+
+		schedules, err := tx.CreateBucketIfNotExists(schedulesBucket)
+
+		if err != nil {
+			return err
+		}
+
+		return schedules.Put([]byte(record.Schedule.ID), data)
+
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to write schedule: %v", err)
+	}
+
+	return nil
+
+}
+
+func (bs *boltScheduleStore) List() ([]scheduleRecord, error) {
+
+	var records []scheduleRecord
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+
+		schedules := tx.Bucket(schedulesBucket)
+
+		if schedules == nil {
+			return nil
+		}
+
+		return schedules.ForEach(func(_, data []byte) error {
+
+			var record scheduleRecord
+
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+
+			return nil
+
+		})
+
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %v", err)
+	}
+
+	return records, nil
+
+}
+
+func (e *entry) record() scheduleRecord {
+
+	record := scheduleRecord{
+		Schedule:     e.schedule,
+		Cursor:       e.cursor,
+		Materialized: e.materialized,
+	}
+
+	for _, result := range e.results {
+
+		stored := resultRecord{
+			Platform:    result.Platform,
+			Response:    result.Response,
+			Destination: result.RTMPDestination,
+		}
+
+		if result.Error != nil {
+			stored.Error = result.Error.Error()
+		}
+
+		record.Results = append(record.Results, stored)
+
+	}
+
+	return record
+
+}
+
+func entryFromRecord(record scheduleRecord) (*entry, error) {
+
+	e := &entry{
+		schedule:     record.Schedule,
+		cursor:       record.Cursor,
+		materialized: record.Materialized,
+	}
+
+	for _, stored := range record.Results {
+
+		result := multistream.PlatformResult{
+			Platform:        stored.Platform,
+			Response:        stored.Response,
+			RTMPDestination: stored.Destination,
+		}
+
+		if stored.Error != "" {
+			result.Error = errors.New(stored.Error)
+		}
+
+		e.results = append(e.results, result)
+
+	}
+
+	if e.schedule.Recurrence != nil {
+
+		rule, err := parseRecurrence(*e.schedule.Recurrence, e.schedule.StartTime)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+		}
+
+		e.rule = rule
+
+		if e.materialized == nil {
+			e.materialized = make(map[string]string)
+		}
+
+	}
+
+	return e, nil
+
+}
@@ -0,0 +1,1030 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+	"github.com/OODemi52/chronocast-server/internal/utils"
+)
+
+var (
+	ErrScheduleNotFound       = errors.New("schedule not found")
+	ErrScheduleNotEditable    = errors.New("schedule can no longer be changed")
+	ErrScheduleNotRecurring   = errors.New("schedule is not recurring")
+	ErrInvalidRecurrence      = errors.New("invalid recurrence")
+	ErrInvalidOccurrence      = errors.New("not an occurrence of this schedule")
+	ErrOccurrenceMaterialized = errors.New("occurrence has already been scheduled, update or cancel its schedule instead")
+	ErrBroadcastsNotDeleted   = errors.New("schedule was cancelled but its platform broadcasts could not be deleted")
+)
+
+// entry holds a schedule and its runtime state.
+type entry struct {
+	schedule types.ScheduledStream
+	results  []multistream.PlatformResult
+
+	// Recurring schedules only: the parsed rule, the last occurrence that
+	// was turned into a one-off schedule and the schedules created so far,
+	// keyed by occurrence key.
+	rule         recurrenceRule
+	cursor       time.Time
+	materialized map[string]string
+}
+
+// Scheduler provisions platform broadcasts ahead of a scheduled start and
+// arms the relays once the start time is reached. Recurring schedules are
+// expanded into one-off schedules as each occurrence enters the
+// provisioning window. Schedules are kept with the stream keys, so a
+// persistent key store keeps them across restarts, and polled on a fixed
+// interval.
+type Scheduler struct {
+	mediaServer        mediaserver.MediaServer
+	multiStreamService *multistream.MultiStreamService
+	lifecycle          *lifecycle.Manager
+	config             config.SchedulerConfig
+	store              scheduleStore
+	entries            map[string]*entry
+	entriesLock        sync.RWMutex
+	stop               chan struct{}
+	stopOnce           sync.Once
+}
+
+func NewScheduler(mediaServer mediaserver.MediaServer, multiStreamService *multistream.MultiStreamService, streamLifecycle *lifecycle.Manager) *Scheduler {
+
+	s := &Scheduler{
+		mediaServer:        mediaServer,
+		multiStreamService: multiStreamService,
+		lifecycle:          streamLifecycle,
+		config:             config.GetSchedulerConfig(),
+		store:              newScheduleStore(auth.KeyStoreDB()),
+		entries:            make(map[string]*entry),
+		stop:               make(chan struct{}),
+	}
+
+	streamLifecycle.OnEnded(s.streamEnded)
+
+	auth.OnStreamKeyRotated(s.streamKeyRotated)
+
+	return s
+
+}
+
+func (s *Scheduler) Start() {
+
+	s.load()
+
+	log.Printf("Scheduler started, provisioning %s ahead of start times", s.config.ProvisionLead)
+
+	ticker := time.NewTicker(s.config.PollInterval)
+
+	defer ticker.Stop()
+
+	for {
+
+		select {
+
+		case <-s.stop:
+			log.Println("Scheduler stopped.")
+			return
+
+		case now := <-ticker.C:
+			s.tick(now)
+
+		}
+
+	}
+
+}
+
+func (s *Scheduler) Stop() {
+
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+}
+
+func (s *Scheduler) CreateSchedule(request types.ScheduleRequest) (types.ScheduledStream, error) {
+
+	id, err := utils.GenerateID()
+
+	if err != nil {
+		return types.ScheduledStream{}, fmt.Errorf("failed to generate schedule id: %v", err)
+	}
+
+	now := time.Now()
+
+	e := &entry{
+		schedule: types.ScheduledStream{
+			ID:            id,
+			UserID:        request.UserID,
+			Title:         request.Title,
+			Description:   request.Description,
+			Privacy:       request.Privacy,
+			Destinations:  request.Destinations,
+			StreamKeyID:   request.KeyID,
+			StreamKeyName: request.KeyName,
+			StartTime:     request.StartTime,
+			Status:        types.ScheduleStatusScheduled,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		},
+	}
+
+	if request.Recurrence != nil {
+
+		rule, err := parseRecurrence(*request.Recurrence, request.StartTime)
+
+		if err != nil {
+			return types.ScheduledStream{}, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+		}
+
+		e.useRecurrence(*request.Recurrence, rule)
+
+	}
+
+	s.entriesLock.Lock()
+
+	s.entries[id] = e
+
+	s.save(e)
+
+	s.entriesLock.Unlock()
+
+	if e.rule != nil {
+		log.Printf("Scheduled recurring stream %s (%q) starting %s", id, e.schedule.Title, e.schedule.StartTime.Format(time.RFC3339))
+	} else {
+		log.Printf("Scheduled stream %s (%q) for %s", id, e.schedule.Title, e.schedule.StartTime.Format(time.RFC3339))
+	}
+
+	return e.schedule, nil
+
+}
+
+func (s *Scheduler) ListSchedules(userID string) []types.ScheduledStream {
+
+	s.entriesLock.RLock()
+
+	defer s.entriesLock.RUnlock()
+
+	schedules := make([]types.ScheduledStream, 0, len(s.entries))
+
+	for _, e := range s.entries {
+
+		if userID != "" && e.schedule.UserID != userID {
+			continue
+		}
+
+		schedules = append(schedules, e.schedule)
+
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].StartTime.Before(schedules[j].StartTime)
+	})
+
+	return schedules
+
+}
+
+func (s *Scheduler) GetSchedule(id string) (types.ScheduledStream, bool) {
+
+	s.entriesLock.RLock()
+
+	defer s.entriesLock.RUnlock()
+
+	e, exists := s.entries[id]
+
+	if !exists {
+		return types.ScheduledStream{}, false
+	}
+
+	return e.schedule, true
+
+}
+
+// UpdateSchedule replaces the editable fields of a schedule. Once the
+// platform broadcasts have been provisioned the schedule is locked, since
+// the platforms do not support updating a broadcast yet. Changes to a
+// recurring schedule apply to occurrences that have not been scheduled yet.
+func (s *Scheduler) UpdateSchedule(id string, request types.ScheduleRequest) (types.ScheduledStream, error) {
+
+	s.entriesLock.Lock()
+
+	defer s.entriesLock.Unlock()
+
+	e, exists := s.entries[id]
+
+	if !exists {
+		return types.ScheduledStream{}, ErrScheduleNotFound
+	}
+
+	if e.schedule.Status != types.ScheduleStatusScheduled && e.schedule.Status != types.ScheduleStatusRecurring {
+		return types.ScheduledStream{}, ErrScheduleNotEditable
+	}
+
+	recurrence := e.schedule.Recurrence
+
+	if request.Recurrence != nil {
+		recurrence = request.Recurrence
+	}
+
+	var rule recurrenceRule
+
+	if recurrence != nil {
+
+		parsed, err := parseRecurrence(*recurrence, request.StartTime)
+
+		if err != nil {
+			return types.ScheduledStream{}, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+		}
+
+		rule = parsed
+
+	}
+
+	e.schedule.Title = request.Title
+	e.schedule.Description = request.Description
+	e.schedule.Privacy = request.Privacy
+	e.schedule.Destinations = request.Destinations
+	e.schedule.StreamKeyID = request.KeyID
+	e.schedule.StreamKeyName = request.KeyName
+	e.schedule.StartTime = request.StartTime
+	e.schedule.UpdatedAt = time.Now()
+
+	if rule != nil {
+		e.useRecurrence(*recurrence, rule)
+	}
+
+	s.save(e)
+
+	return e.schedule, nil
+
+}
+
+func (s *Scheduler) CancelSchedule(id string) (types.ScheduledStream, error) {
+
+	s.entriesLock.Lock()
+
+	e, exists := s.entries[id]
+
+	if !exists {
+		s.entriesLock.Unlock()
+		return types.ScheduledStream{}, ErrScheduleNotFound
+	}
+
+	previousStatus := e.schedule.Status
+
+	// An ended or failed schedule keeps its status, and has no broadcasts
+	// left to delete.
+	switch previousStatus {
+
+	case types.ScheduleStatusEnded, types.ScheduleStatusFailed, types.ScheduleStatusCancelled:
+		s.entriesLock.Unlock()
+		return types.ScheduledStream{}, ErrScheduleNotEditable
+
+	}
+
+	e.schedule.Status = types.ScheduleStatusCancelled
+	e.schedule.UpdatedAt = time.Now()
+
+	s.save(e)
+
+	schedule := e.schedule
+
+	results := e.results
+
+	streamID := e.schedule.StreamKeyID
+
+	var pending []string
+
+	for _, childID := range e.materialized {
+
+		if child, exists := s.entries[childID]; exists && (child.schedule.Status == types.ScheduleStatusScheduled || child.schedule.Status == types.ScheduleStatusProvisioned) {
+			pending = append(pending, childID)
+		}
+
+	}
+
+	s.entriesLock.Unlock()
+
+	for _, childID := range pending {
+
+		if _, err := s.CancelSchedule(childID); err != nil {
+			log.Printf("Failed to cancel occurrence %s of schedule %s: %v", childID, id, err)
+		}
+
+	}
+
+	switch previousStatus {
+
+	case types.ScheduleStatusLive:
+		if _, err := s.lifecycle.End(streamID, "schedule cancelled"); err != nil {
+			log.Printf("Failed to end stream for schedule %s: %v", id, err)
+		}
+
+	case types.ScheduleStatusProvisioned:
+		if err := s.multiStreamService.DeleteMultiStream(results); err != nil {
+			log.Printf("Cancelled scheduled stream %s, but not its broadcasts", id)
+			return schedule, fmt.Errorf("%w: %v", ErrBroadcastsNotDeleted, err)
+		}
+
+	}
+
+	log.Printf("Cancelled scheduled stream %s", id)
+
+	return schedule, nil
+
+}
+
+func (s *Scheduler) tick(now time.Time) {
+
+	var toProvision, toArm []string
+
+	s.entriesLock.Lock()
+
+	var series []*entry
+
+	for _, e := range s.entries {
+
+		if e.schedule.Status == types.ScheduleStatusRecurring {
+			series = append(series, e)
+		}
+
+	}
+
+	for _, e := range series {
+
+		cursor, materialized := e.cursor, len(e.materialized)
+
+		s.expand(e, now)
+
+		if !e.cursor.Equal(cursor) || len(e.materialized) != materialized {
+			s.save(e)
+		}
+
+	}
+
+	for id, e := range s.entries {
+
+		switch e.schedule.Status {
+
+		case types.ScheduleStatusScheduled:
+			if !now.Before(e.schedule.StartTime.Add(-s.config.ProvisionLead)) {
+				toProvision = append(toProvision, id)
+			}
+
+		case types.ScheduleStatusProvisioned:
+			if !now.Before(e.schedule.StartTime) {
+				toArm = append(toArm, id)
+			}
+
+		}
+
+	}
+
+	s.entriesLock.Unlock()
+
+	for _, id := range toProvision {
+		s.provision(id)
+	}
+
+	for _, id := range toArm {
+		s.arm(id)
+	}
+
+}
+
+// ListOccurrences returns the next occurrences of a recurring schedule
+// with any overrides applied.
+func (s *Scheduler) ListOccurrences(id string, limit int) ([]types.Occurrence, error) {
+
+	s.entriesLock.RLock()
+
+	defer s.entriesLock.RUnlock()
+
+	e, exists := s.entries[id]
+
+	if !exists {
+		return nil, ErrScheduleNotFound
+	}
+
+	if e.rule == nil {
+		return nil, ErrScheduleNotRecurring
+	}
+
+	occurrences := []types.Occurrence{}
+
+	after := time.Now()
+
+	for len(occurrences) < limit {
+
+		start, ok := e.rule.next(after)
+
+		if !ok {
+			break
+		}
+
+		after = start
+
+		key := occurrenceKey(start)
+
+		override := e.schedule.Overrides[key]
+
+		occurrence := types.Occurrence{
+			Key:         key,
+			StartTime:   start,
+			Title:       e.schedule.Title,
+			Description: e.schedule.Description,
+			Skipped:     override.Skip,
+			ScheduleID:  e.materialized[key],
+		}
+
+		applyOverride(&occurrence, override)
+
+		occurrences = append(occurrences, occurrence)
+
+	}
+
+	return occurrences, nil
+
+}
+
+// SetOccurrenceOverride skips or changes a single occurrence of a recurring
+// schedule. The key is the occurrence's original start time; RFC 3339
+// timestamps and plain dates in the schedule's timezone are accepted.
+func (s *Scheduler) SetOccurrenceOverride(id, key string, override types.OccurrenceOverride) (types.ScheduledStream, error) {
+
+	s.entriesLock.Lock()
+
+	defer s.entriesLock.Unlock()
+
+	e, exists := s.entries[id]
+
+	if !exists {
+		return types.ScheduledStream{}, ErrScheduleNotFound
+	}
+
+	if e.rule == nil {
+		return types.ScheduledStream{}, ErrScheduleNotRecurring
+	}
+
+	if e.schedule.Status != types.ScheduleStatusRecurring {
+		return types.ScheduledStream{}, ErrScheduleNotEditable
+	}
+
+	start, err := e.resolveOccurrence(key)
+
+	if err != nil {
+		return types.ScheduledStream{}, err
+	}
+
+	key = occurrenceKey(start)
+
+	if _, materialized := e.materialized[key]; materialized {
+		return types.ScheduledStream{}, ErrOccurrenceMaterialized
+	}
+
+	if e.schedule.Overrides == nil {
+		e.schedule.Overrides = make(map[string]types.OccurrenceOverride)
+	}
+
+	e.schedule.Overrides[key] = override
+	e.schedule.UpdatedAt = time.Now()
+
+	s.save(e)
+
+	log.Printf("Updated occurrence %s of schedule %s (skip=%t)", key, id, override.Skip)
+
+	return e.schedule, nil
+
+}
+
+func (e *entry) useRecurrence(recurrence types.Recurrence, rule recurrenceRule) {
+
+	e.rule = rule
+	e.schedule.Recurrence = &recurrence
+	e.schedule.Status = types.ScheduleStatusRecurring
+	e.schedule.NextOccurrence = nil
+
+	if next, ok := rule.next(e.cursor); ok {
+		e.schedule.NextOccurrence = &next
+	}
+
+	if e.materialized == nil {
+		e.materialized = make(map[string]string)
+	}
+
+}
+
+func (e *entry) resolveOccurrence(key string) (time.Time, error) {
+
+	if start, err := time.Parse(time.RFC3339, key); err == nil {
+
+		if next, ok := e.rule.next(start.Add(-time.Nanosecond)); ok && next.Equal(start) {
+			return start, nil
+		}
+
+		return time.Time{}, ErrInvalidOccurrence
+
+	}
+
+	location := time.UTC
+
+	if e.schedule.Recurrence.Timezone != "" {
+
+		if loc, err := time.LoadLocation(e.schedule.Recurrence.Timezone); err == nil {
+			location = loc
+		}
+
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, key, location)
+
+	if err != nil {
+		return time.Time{}, ErrInvalidOccurrence
+	}
+
+	next, ok := e.rule.next(day.Add(-time.Nanosecond))
+
+	if !ok || !next.Before(day.AddDate(0, 0, 1)) {
+		return time.Time{}, ErrInvalidOccurrence
+	}
+
+	return next, nil
+
+}
+
+// expand turns every occurrence that has entered the provisioning window
+// into a one-off schedule. An override can move an occurrence earlier, so
+// the window opens at the earlier of its original and overridden start.
+// The caller must hold the write lock.
+func (s *Scheduler) expand(series *entry, now time.Time) {
+
+	// An occurrence moved ahead of the ones before it is scheduled as soon
+	// as its new start enters the window, out of turn.
+	for key, override := range series.schedule.Overrides {
+
+		if override.Skip || override.StartTime == nil || override.StartTime.Before(now) || override.StartTime.Add(-s.config.ProvisionLead).After(now) {
+			continue
+		}
+
+		if _, materialized := series.materialized[key]; materialized {
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, key)
+
+		if err != nil || !start.After(series.cursor) {
+			continue
+		}
+
+		s.materialize(series, key, start, now)
+
+	}
+
+	for {
+
+		start, ok := series.rule.next(series.cursor)
+
+		if !ok {
+			series.schedule.NextOccurrence = nil
+			return
+		}
+
+		key := occurrenceKey(start)
+
+		override := series.schedule.Overrides[key]
+
+		opensAt := start
+
+		if override.StartTime != nil && override.StartTime.Before(start) {
+			opensAt = *override.StartTime
+		}
+
+		if opensAt.Add(-s.config.ProvisionLead).After(now) {
+			series.schedule.NextOccurrence = &start
+			return
+		}
+
+		series.cursor = start
+
+		if _, materialized := series.materialized[key]; materialized {
+			continue
+		}
+
+		if override.Skip {
+			log.Printf("Skipping occurrence %s of schedule %s", key, series.schedule.ID)
+			continue
+		}
+
+		if !s.materialize(series, key, start, now) {
+			series.cursor = start.Add(-time.Nanosecond)
+			return
+		}
+
+	}
+
+}
+
+// materialize creates the one-off schedule for an occurrence, with its
+// override applied. It reports false if the occurrence should be tried
+// again later.
+func (s *Scheduler) materialize(series *entry, key string, start, now time.Time) bool {
+
+	occurrence := types.Occurrence{
+		StartTime:   start,
+		Title:       series.schedule.Title,
+		Description: series.schedule.Description,
+	}
+
+	applyOverride(&occurrence, series.schedule.Overrides[key])
+
+	if occurrence.StartTime.Before(now) {
+		log.Printf("Missed occurrence %s of schedule %s, not scheduling it", key, series.schedule.ID)
+		return true
+	}
+
+	id, err := utils.GenerateID()
+
+	if err != nil {
+		log.Printf("Failed to schedule occurrence %s of schedule %s: %v", key, series.schedule.ID, err)
+		return false
+	}
+
+	occurrenceEntry := &entry{
+		schedule: types.ScheduledStream{
+			ID:            id,
+			UserID:        series.schedule.UserID,
+			Title:         occurrence.Title,
+			Description:   occurrence.Description,
+			Privacy:       series.schedule.Privacy,
+			Destinations:  series.schedule.Destinations,
+			StreamKeyID:   series.schedule.StreamKeyID,
+			StreamKeyName: series.schedule.StreamKeyName,
+			StartTime:     occurrence.StartTime,
+			Status:        types.ScheduleStatusScheduled,
+			SeriesID:      series.schedule.ID,
+			OccurrenceKey: key,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		},
+	}
+
+	s.entries[id] = occurrenceEntry
+
+	s.save(occurrenceEntry)
+
+	series.materialized[key] = id
+
+	log.Printf("Scheduled occurrence %s of schedule %s as %s", key, series.schedule.ID, id)
+
+	return true
+
+}
+
+func applyOverride(occurrence *types.Occurrence, override types.OccurrenceOverride) {
+
+	if override.Title != "" {
+		occurrence.Title = override.Title
+	}
+
+	if override.Description != "" {
+		occurrence.Description = override.Description
+	}
+
+	if override.StartTime != nil {
+		occurrence.StartTime = *override.StartTime
+	}
+
+}
+
+func occurrenceKey(start time.Time) string {
+
+	return start.UTC().Format(time.RFC3339)
+
+}
+
+func (s *Scheduler) provision(id string) {
+
+	schedule, exists := s.GetSchedule(id)
+
+	if !exists || schedule.Status != types.ScheduleStatusScheduled {
+		return
+	}
+
+	if s.multiStreamService == nil {
+		s.fail(id, fmt.Errorf("multi-streaming service unavailable"))
+		return
+	}
+
+	log.Printf("Provisioning broadcasts for scheduled stream %s", id)
+
+	results, err := s.multiStreamService.ProvisionMultiStream(schedule.Destinations, types.StreamOptions{
+		Title:        schedule.Title,
+		Description:  schedule.Description,
+		Privacy:      schedule.Privacy,
+		ScheduleTime: schedule.StartTime,
+	})
+
+	if err != nil {
+		s.abandon(id, results, err)
+		return
+	}
+
+	var broadcasts []types.StreamResponse
+
+	for _, result := range results {
+
+		if result.Error != nil {
+			log.Printf("Failed to provision %s for schedule %s: %v", result.Platform, id, result.Error)
+			continue
+		}
+
+		broadcasts = append(broadcasts, types.StreamResponse{
+			Platform: result.Response.Platform,
+			StreamID: result.Response.StreamID,
+			URL:      result.Response.URL,
+		})
+
+	}
+
+	s.entriesLock.Lock()
+
+	e := s.entries[id]
+
+	cancelled := e.schedule.Status == types.ScheduleStatusCancelled
+
+	if !cancelled {
+		e.results = results
+		e.schedule.Broadcasts = broadcasts
+		e.schedule.Status = types.ScheduleStatusProvisioned
+		e.schedule.UpdatedAt = time.Now()
+		s.save(e)
+	}
+
+	s.entriesLock.Unlock()
+
+	if cancelled {
+		s.multiStreamService.DeleteMultiStream(results)
+		return
+	}
+
+	if !time.Now().Before(schedule.StartTime) {
+		s.arm(id)
+	}
+
+}
+
+func (s *Scheduler) arm(id string) {
+
+	s.entriesLock.RLock()
+
+	e, exists := s.entries[id]
+
+	if !exists || e.schedule.Status != types.ScheduleStatusProvisioned {
+		s.entriesLock.RUnlock()
+		return
+	}
+
+	userID := e.schedule.UserID
+
+	title := e.schedule.Title
+
+	keyID := e.schedule.StreamKeyID
+
+	keyName := e.schedule.StreamKeyName
+
+	results := e.results
+
+	s.entriesLock.RUnlock()
+
+	// A key chosen by name is whichever key has the name now, so the
+	// schedule follows the key through rotations.
+	selector := keyID
+
+	if keyName != "" {
+		selector = keyName
+	}
+
+	record, exists := auth.FindStreamKeyForUser(userID, selector)
+
+	if !exists || (keyName == "" && record.ID != keyID) {
+		s.abandon(id, results, fmt.Errorf("stream key for user %s is no longer valid", userID))
+		return
+	}
+
+	if record.ID != keyID {
+
+		s.entriesLock.Lock()
+
+		e.schedule.StreamKeyID = record.ID
+
+		s.save(e)
+
+		s.entriesLock.Unlock()
+
+	}
+
+	if _, err := s.lifecycle.Create(record.ID, userID, title, id); err != nil {
+		s.abandon(id, results, err)
+		return
+	}
+
+	log.Printf("Arming relays for scheduled stream %s", id)
+
+	var destinations []mediaserver.StreamDestination
+
+	for _, result := range results {
+
+		if result.Error == nil {
+			destinations = append(destinations, result.RTMPDestination)
+		}
+
+	}
+
+	if err := s.mediaServer.AddStream(record.ID, destinations); err != nil {
+		s.lifecycle.Discard(record.ID)
+		s.abandon(id, results, err)
+		return
+	}
+
+	s.entriesLock.Lock()
+
+	cancelled := e.schedule.Status == types.ScheduleStatusCancelled
+
+	if !cancelled {
+		e.schedule.Status = types.ScheduleStatusLive
+		e.schedule.UpdatedAt = time.Now()
+		s.save(e)
+	}
+
+	s.entriesLock.Unlock()
+
+	if cancelled {
+
+		if err := s.mediaServer.RemoveStream(record.ID); err != nil {
+			log.Printf("Failed to remove stream for schedule %s: %v", id, err)
+		}
+
+		s.lifecycle.Discard(record.ID)
+
+		s.multiStreamService.DeleteMultiStream(results)
+
+		return
+
+	}
+
+	// The relays start once the encoder publishes on the key.
+	if _, err := s.lifecycle.Arm(record.ID, id, results); err != nil {
+		log.Printf("Failed to track stream for schedule %s: %v", id, err)
+	}
+
+}
+
+// streamEnded marks a live schedule as ended once its stream has been torn
+// down, whether the encoder went away or the stream was ended by hand.
+func (s *Scheduler) streamEnded(stream types.StreamLifecycle) {
+
+	if stream.ScheduleID == "" {
+		return
+	}
+
+	s.entriesLock.Lock()
+
+	defer s.entriesLock.Unlock()
+
+	if e, exists := s.entries[stream.ScheduleID]; exists && e.schedule.Status == types.ScheduleStatusLive {
+		e.schedule.Status = types.ScheduleStatusEnded
+		e.schedule.UpdatedAt = time.Now()
+		s.save(e)
+	}
+
+}
+
+// abandon deletes the broadcasts provisioned for a schedule that cannot go
+// ahead, so they are not left on the channel, and marks it failed.
+func (s *Scheduler) abandon(id string, results []multistream.PlatformResult, err error) {
+
+	if err := s.multiStreamService.DeleteMultiStream(results); err != nil {
+		log.Printf("Failed to delete the broadcasts of scheduled stream %s: %v", id, err)
+	}
+
+	s.fail(id, err)
+
+}
+
+// streamKeyRotated moves the schedules still to come on a rotated key to its
+// replacement.
+func (s *Scheduler) streamKeyRotated(previous, replacement auth.StreamKeyRecord) {
+
+	s.entriesLock.Lock()
+
+	defer s.entriesLock.Unlock()
+
+	for _, e := range s.entries {
+
+		if e.schedule.StreamKeyID != previous.ID || e.schedule.UserID != previous.UserID {
+			continue
+		}
+
+		switch e.schedule.Status {
+
+		case types.ScheduleStatusScheduled, types.ScheduleStatusRecurring, types.ScheduleStatusProvisioned:
+			e.schedule.StreamKeyID = replacement.ID
+			e.schedule.UpdatedAt = time.Now()
+			s.save(e)
+
+		}
+
+	}
+
+}
+
+func (s *Scheduler) fail(id string, err error) {
+
+	log.Printf("Scheduled stream %s failed: %v", id, err)
+
+	s.entriesLock.Lock()
+
+	defer s.entriesLock.Unlock()
+
+	if e, exists := s.entries[id]; exists && e.schedule.Status != types.ScheduleStatusCancelled {
+		e.schedule.Status = types.ScheduleStatusFailed
+		e.schedule.Error = err.Error()
+		e.schedule.UpdatedAt = time.Now()
+		s.save(e)
+	}
+
+}
+
+// load restores the schedules kept in the store. A stream that was live
+// did not survive the restart, so its schedule is ended and its broadcasts
+// completed.
+func (s *Scheduler) load() {
+
+	records, err := s.store.List()
+
+	if err != nil {
+		log.Printf("Failed to load schedules: %v", err)
+		return
+	}
+
+	var interrupted [][]multistream.PlatformResult
+
+	s.entriesLock.Lock()
+
+	for _, record := range records {
+
+		e, err := entryFromRecord(record)
+
+		if err != nil {
+			log.Printf("Failed to load schedule %s: %v", record.Schedule.ID, err)
+			continue
+		}
+
+		if e.schedule.Status == types.ScheduleStatusLive {
+			e.schedule.Status = types.ScheduleStatusEnded
+			e.schedule.Error = "the server restarted while the stream was live"
+			e.schedule.UpdatedAt = time.Now()
+			s.save(e)
+			interrupted = append(interrupted, e.results)
+		}
+
+		s.entries[e.schedule.ID] = e
+
+	}
+
+	s.entriesLock.Unlock()
+
+	for _, results := range interrupted {
+
+		if s.multiStreamService != nil {
+			s.multiStreamService.CompleteMultiStream(results)
+		}
+
+	}
+
+	if len(records) > 0 {
+		log.Printf("Loaded %d schedules", len(records))
+	}
+
+}
+
+// save writes the entry to the store. The caller must hold the write lock.
+func (s *Scheduler) save(e *entry) {
+
+	if err := s.store.Put(e.record()); err != nil {
+		log.Printf("Failed to save schedule %s: %v", e.schedule.ID, err)
+	}
+
+}
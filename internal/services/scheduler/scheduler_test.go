@@ -0,0 +1,360 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/OODemi52/chronocast-server/internal/config"
+	mediaserver "github.com/OODemi52/chronocast-server/internal/media-server"
+	"github.com/OODemi52/chronocast-server/internal/media-server/embedded"
+	"github.com/OODemi52/chronocast-server/internal/rtmp-server/auth"
+	"github.com/OODemi52/chronocast-server/internal/services/ffmpeg"
+	"github.com/OODemi52/chronocast-server/internal/services/lifecycle"
+	"github.com/OODemi52/chronocast-server/internal/services/multistream"
+	"github.com/OODemi52/chronocast-server/internal/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fakePlatform records which broadcasts were deleted.
+type fakePlatform struct {
+	deleted []string
+}
+
+func (p *fakePlatform) Authenticate(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (p *fakePlatform) CreateStream(options types.StreamOptions) (types.StreamResponse, error) {
+	return types.StreamResponse{}, nil
+}
+
+func (p *fakePlatform) UpdateStream(id string, options types.StreamOptions) error {
+	return nil
+}
+
+func (p *fakePlatform) DeleteStream(id string) error {
+
+	p.deleted = append(p.deleted, id)
+
+	return nil
+
+}
+
+func (p *fakePlatform) CompleteStream(id string) error {
+	return nil
+}
+
+// newProvisioned returns a scheduler holding one provisioned schedule with a
+// broadcast on platform.
+func newProvisioned(platform *fakePlatform, keyID string) *Scheduler {
+
+	s := &Scheduler{
+		multiStreamService: &multistream.MultiStreamService{
+			Platforms:     map[string]types.StreamPlatform{"youtube": platform},
+			FFmpegService: ffmpeg.NewFFmpegService(),
+		},
+		store:   newMemoryScheduleStore(),
+		entries: make(map[string]*entry),
+	}
+
+	s.entries["schedule"] = &entry{
+		schedule: types.ScheduledStream{
+			ID:          "schedule",
+			UserID:      "user",
+			StreamKeyID: keyID,
+			StartTime:   time.Now(),
+			Status:      types.ScheduleStatusProvisioned,
+		},
+		results: []multistream.PlatformResult{
+			{Platform: "youtube", Response: types.StreamResponse{Platform: "youtube", StreamID: "broadcast"}},
+		},
+	}
+
+	return s
+
+}
+
+func newSeries(t *testing.T, s *Scheduler, start time.Time, recurrence types.Recurrence) *entry {
+
+	t.Helper()
+
+	rule, err := parseRecurrence(recurrence, start)
+
+	if err != nil {
+		t.Fatalf("parseRecurrence: %v", err)
+	}
+
+	series := &entry{
+		schedule: types.ScheduledStream{
+			ID:        "series",
+			StartTime: start,
+		},
+	}
+
+	series.useRecurrence(recurrence, rule)
+
+	s.entries[series.schedule.ID] = series
+
+	return series
+
+}
+
+func TestExpand(t *testing.T) {
+
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	s := &Scheduler{
+		config:  config.SchedulerConfig{ProvisionLead: time.Hour},
+		store:   newMemoryScheduleStore(),
+		entries: make(map[string]*entry),
+	}
+
+	series := newSeries(t, s, time.Date(2026, 1, 5, 12, 30, 0, 0, time.UTC), types.Recurrence{RRule: "FREQ=DAILY"})
+
+	// The third occurrence is moved into today's window, and the second is
+	// skipped.
+	moved := now.Add(45 * time.Minute)
+
+	series.schedule.Overrides = map[string]types.OccurrenceOverride{
+		"2026-01-06T12:30:00Z": {Skip: true},
+		"2026-01-07T12:30:00Z": {StartTime: &moved, Title: "Moved"},
+	}
+
+	s.expand(series, now)
+
+	if len(series.materialized) != 2 {
+		t.Fatalf("materialized %v, want today's and the moved occurrence", series.materialized)
+	}
+
+	today := s.entries[series.materialized["2026-01-05T12:30:00Z"]]
+
+	if today == nil || !today.schedule.StartTime.Equal(time.Date(2026, 1, 5, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("today's occurrence = %+v", today)
+	}
+
+	early := s.entries[series.materialized["2026-01-07T12:30:00Z"]]
+
+	if early == nil || !early.schedule.StartTime.Equal(moved) || early.schedule.Title != "Moved" {
+		t.Errorf("moved occurrence = %+v", early)
+	}
+
+	if series.schedule.NextOccurrence == nil || !series.schedule.NextOccurrence.Equal(time.Date(2026, 1, 6, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("next occurrence = %v", series.schedule.NextOccurrence)
+	}
+
+	// Expanding again later schedules nothing twice and steps over the
+	// skipped and already scheduled occurrences.
+	s.expand(series, time.Date(2026, 1, 8, 11, 45, 0, 0, time.UTC))
+
+	if len(series.materialized) != 3 || series.materialized["2026-01-08T12:30:00Z"] == "" {
+		t.Errorf("materialized %v, want the 8th added", series.materialized)
+	}
+
+	if len(s.entries) != 4 {
+		t.Errorf("%d entries, want the series and three occurrences", len(s.entries))
+	}
+
+}
+
+func TestArmFailureDeletesBroadcasts(t *testing.T) {
+
+	platform := &fakePlatform{}
+
+	s := newProvisioned(platform, "missing-key")
+
+	s.arm("schedule")
+
+	schedule, _ := s.GetSchedule("schedule")
+
+	if schedule.Status != types.ScheduleStatusFailed {
+		t.Fatalf("status %s, want %s", schedule.Status, types.ScheduleStatusFailed)
+	}
+
+	if !slices.Equal(platform.deleted, []string{"broadcast"}) {
+		t.Fatalf("deleted %v, want the provisioned broadcast", platform.deleted)
+	}
+
+}
+
+func TestCancelSchedule(t *testing.T) {
+
+	tests := []struct {
+		status  types.ScheduleStatus
+		err     error
+		want    types.ScheduleStatus
+		deleted []string
+	}{
+		{status: types.ScheduleStatusProvisioned, want: types.ScheduleStatusCancelled, deleted: []string{"broadcast"}},
+		{status: types.ScheduleStatusEnded, err: ErrScheduleNotEditable, want: types.ScheduleStatusEnded},
+		{status: types.ScheduleStatusFailed, err: ErrScheduleNotEditable, want: types.ScheduleStatusFailed},
+		{status: types.ScheduleStatusCancelled, err: ErrScheduleNotEditable, want: types.ScheduleStatusCancelled},
+	}
+
+	for _, test := range tests {
+
+		t.Run(string(test.status), func(t *testing.T) {
+
+			platform := &fakePlatform{}
+
+			s := newProvisioned(platform, "key-id")
+
+			s.entries["schedule"].schedule.Status = test.status
+
+			if _, err := s.CancelSchedule("schedule"); !errors.Is(err, test.err) {
+				t.Fatalf("CancelSchedule: got %v, want %v", err, test.err)
+			}
+
+			if schedule, _ := s.GetSchedule("schedule"); schedule.Status != test.want {
+				t.Fatalf("status %s, want %s", schedule.Status, test.want)
+			}
+
+			if !slices.Equal(platform.deleted, test.deleted) {
+				t.Fatalf("deleted %v, want %v", platform.deleted, test.deleted)
+			}
+
+		})
+
+	}
+
+}
+
+func TestSchedulesSurviveRestart(t *testing.T) {
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "stream-keys.db"), 0o600, nil)
+
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	platform := &fakePlatform{}
+
+	s := newProvisioned(platform, "key-id")
+
+	s.store = newScheduleStore(db)
+
+	s.entries["schedule"].schedule.Status = types.ScheduleStatusLive
+
+	s.entries["schedule"].results[0].RTMPDestination = mediaserver.StreamDestination{URL: "rtmp://a.rtmp.youtube.com/live2/", StreamKey: "platform-key"}
+
+	s.save(s.entries["schedule"])
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	once, err := s.CreateSchedule(types.ScheduleRequest{UserID: "user", Title: "Once", StartTime: start})
+
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	weekly, err := s.CreateSchedule(types.ScheduleRequest{UserID: "user", Title: "Weekly", StartTime: start, Recurrence: &types.Recurrence{RRule: "FREQ=WEEKLY"}})
+
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+
+	restarted := &Scheduler{
+		multiStreamService: s.multiStreamService,
+		store:              newScheduleStore(db),
+		entries:            make(map[string]*entry),
+	}
+
+	restarted.load()
+
+	if schedule, _ := restarted.GetSchedule(once.ID); schedule.Status != types.ScheduleStatusScheduled || !schedule.StartTime.Equal(start) {
+		t.Fatalf("one-off schedule reloaded as %+v", schedule)
+	}
+
+	if occurrences, err := restarted.ListOccurrences(weekly.ID, 2); err != nil || len(occurrences) != 2 {
+		t.Fatalf("recurring schedule reloaded with occurrences %v, %v", occurrences, err)
+	}
+
+	// The stream that was live is gone, so its schedule is over.
+	if schedule, _ := restarted.GetSchedule("schedule"); schedule.Status != types.ScheduleStatusEnded {
+		t.Fatalf("live schedule reloaded as %s, want %s", schedule.Status, types.ScheduleStatusEnded)
+	}
+
+	if restarted.entries["schedule"].results[0].RTMPDestination != s.entries["schedule"].results[0].RTMPDestination {
+		t.Fatalf("broadcast results were not kept")
+	}
+
+}
+
+func TestArmAfterRotation(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		keyName string
+
+		// moved reports the rotation to the scheduler, as the key store
+		// does for a scheduler it created.
+		moved bool
+	}{
+		{name: "chosen by name", keyName: "studio"},
+		{name: "chosen by ID", moved: true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			userID := "rotating-" + test.name
+
+			previous, _, err := auth.CreateStreamKey(userID, auth.StreamKeyOptions{Name: test.keyName})
+
+			if err != nil {
+				t.Fatalf("CreateStreamKey: %v", err)
+			}
+
+			server, err := embedded.NewServer(":0")
+
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			s := newProvisioned(&fakePlatform{}, previous.ID)
+
+			s.mediaServer = server
+
+			s.lifecycle = lifecycle.NewManager(server, nil)
+
+			schedule := &s.entries["schedule"].schedule
+
+			schedule.UserID = userID
+
+			schedule.StreamKeyName = test.keyName
+
+			// No grace period, so only the replacement is left by the time
+			// the schedule starts.
+			replacement, _, _, err := auth.RotateStreamKey(userID, previous.ID, 0)
+
+			if err != nil {
+				t.Fatalf("RotateStreamKey: %v", err)
+			}
+
+			if test.moved {
+				s.streamKeyRotated(previous, replacement)
+			}
+
+			s.arm("schedule")
+
+			armed, _ := s.GetSchedule("schedule")
+
+			if armed.Status != types.ScheduleStatusLive || armed.StreamKeyID != replacement.ID {
+				t.Fatalf("armed as %s on key %s (%s), want %s on %s", armed.Status, armed.StreamKeyID, armed.Error, types.ScheduleStatusLive, replacement.ID)
+			}
+
+			if _, err := s.lifecycle.Get(replacement.ID); err != nil {
+				t.Fatalf("no stream on the replacement key: %v", err)
+			}
+
+		})
+
+	}
+
+}
@@ -2,9 +2,13 @@ package youtube
 
 import (
 	"context"
+	"errors"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/OODemi52/chronocast-server/internal/types"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/youtube/v3"
 )
 
@@ -42,3 +46,50 @@ func (s *Service) createYouTubeBroadcast(ctx context.Context, ytService *youtube
 	return ytService.LiveBroadcasts.Insert([]string{"snippet", "status", "contentDetails"}, broadcast).Context(ctx).Do()
 
 }
+
+func (s *Service) completeYouTubeBroadcast(ctx context.Context, ytService *youtube.Service, broadcastId string) error {
+
+	_, err := ytService.LiveBroadcasts.Transition("complete", broadcastId, []string{"status"}).Context(ctx).Do()
+
+	return err
+
+}
+
+// deleteYouTubeBroadcast deletes the broadcast and then the stream that was
+// created for it. Failing to delete the stream is only logged: an unbound
+// stream is harmless and is reused by nothing.
+func (s *Service) deleteYouTubeBroadcast(ctx context.Context, ytService *youtube.Service, broadcastId string) error {
+
+	response, err := ytService.LiveBroadcasts.List([]string{"contentDetails"}).Id(broadcastId).Context(ctx).Do()
+
+	if err != nil {
+		return err
+	}
+
+	if len(response.Items) == 0 {
+		return nil
+	}
+
+	if err := ytService.LiveBroadcasts.Delete(broadcastId).Context(ctx).Do(); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if details := response.Items[0].ContentDetails; details != nil && details.BoundStreamId != "" {
+
+		if err := ytService.LiveStreams.Delete(details.BoundStreamId).Context(ctx).Do(); err != nil && !isNotFound(err) {
+			log.Printf("Failed to delete YouTube stream %s of broadcast %s: %v", details.BoundStreamId, broadcastId, err)
+		}
+
+	}
+
+	return nil
+
+}
+
+func isNotFound(err error) bool {
+
+	var apiErr *googleapi.Error
+
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+
+}
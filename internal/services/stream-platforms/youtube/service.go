@@ -93,7 +93,54 @@ func (s *Service) UpdateStream(id string, options types.StreamOptions) error {
 	return fmt.Errorf("update stream not implemented yet")
 }
 
+// DeleteStream deletes a broadcast that has not gone live, along with the
+// stream bound to it. A broadcast that is already gone counts as deleted.
 func (s *Service) DeleteStream(id string) error {
-	//TODO - Will implement later
-	return fmt.Errorf("delete stream not implemented yet")
+
+	accessToken, err := s.client.GetAccessToken()
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	ytService, err := s.client.GetYouTubeService(ctx, accessToken)
+
+	if err != nil {
+		return fmt.Errorf("failed to get YouTube service: %w", err)
+	}
+
+	if err := s.deleteYouTubeBroadcast(ctx, ytService, id); err != nil {
+		return fmt.Errorf("failed to delete YouTube broadcast: %w", err)
+	}
+
+	return nil
+
+}
+
+// CompleteStream ends a live broadcast, so YouTube stops waiting for more
+// video and finalizes the recording.
+func (s *Service) CompleteStream(id string) error {
+
+	accessToken, err := s.client.GetAccessToken()
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	ytService, err := s.client.GetYouTubeService(ctx, accessToken)
+
+	if err != nil {
+		return fmt.Errorf("failed to get YouTube service: %w", err)
+	}
+
+	if err := s.completeYouTubeBroadcast(ctx, ytService, id); err != nil {
+		return fmt.Errorf("failed to complete YouTube broadcast: %w", err)
+	}
+
+	return nil
+
 }
@@ -1,11 +1,24 @@
 package types
 
+import "time"
+
 type CreateStreamRequest struct {
 	Title        string   `json:"title"`
 	Description  string   `json:"description"`
 	Destinations []string `json:"destinations"`
 }
 
+type StreamKeyResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Prefix    string    `json:"prefix"`
+	StreamKey string    `json:"streamKey,omitempty"`
+	SingleUse bool      `json:"singleUse"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	UsedAt    time.Time `json:"usedAt,omitzero"`
+}
+
 type StreamAPIResponse struct {
 	StreamKey   string `json:"streamKey"`
 	IngestURL   string `json:"ingestUrl"`
@@ -13,3 +26,34 @@ type StreamAPIResponse struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 }
+
+type PublishURLResponse struct {
+	URL       string    `json:"url"`
+	KeyID     string    `json:"keyID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+}
+
+// PreviewURLResponse is a WHEP endpoint for watching what is published on
+// a stream key, and the bearer token that opens it until ExpiresAt.
+type PreviewURLResponse struct {
+	URL       string    `json:"url"`
+	Token     string    `json:"token"`
+	KeyID     string    `json:"keyID"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// IngestEndpoint is one way for an encoder to publish a stream. Server is
+// what encoders such as OBS ask for separately from the stream key; URL is
+// the complete publish URL, set when the stream key is known. WHIP clients
+// post to URL with the stream key as a bearer token.
+type IngestEndpoint struct {
+	Protocol string `json:"protocol"`
+	Server   string `json:"server"`
+	URL      string `json:"url,omitempty"`
+}
+
+type PlaybackURL struct {
+	Protocol string `json:"protocol"`
+	URL      string `json:"url"`
+}
@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+type StreamState string
+
+const (
+	StreamStateCreated StreamState = "created"
+	StreamStateWaiting StreamState = "waiting"
+	StreamStateLive    StreamState = "live"
+	StreamStateEnding  StreamState = "ending"
+	StreamStateEnded   StreamState = "ended"
+)
+
+type StreamLifecycle struct {
+	ID                string           `json:"id"`
+	UserID            string           `json:"userID"`
+	Title             string           `json:"title"`
+	ScheduleID        string           `json:"scheduleID,omitempty"`
+	State             StreamState      `json:"state"`
+	Broadcasts        []StreamResponse `json:"broadcasts,omitempty"`
+	Relays            []RelayStatus    `json:"relays,omitempty"`
+	Reconnects        int              `json:"reconnects"`
+	EndReason         string           `json:"endReason,omitempty"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	LiveAt            time.Time        `json:"liveAt,omitzero"`
+	ReconnectDeadline time.Time        `json:"reconnectDeadline,omitzero"`
+	EndedAt           time.Time        `json:"endedAt,omitzero"`
+	UpdatedAt         time.Time        `json:"updatedAt"`
+}
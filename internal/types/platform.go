@@ -24,4 +24,5 @@ type StreamPlatform interface {
 	CreateStream(options StreamOptions) (StreamResponse, error)
 	UpdateStream(id string, options StreamOptions) error
 	DeleteStream(id string) error
+	CompleteStream(id string) error
 }
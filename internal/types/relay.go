@@ -0,0 +1,44 @@
+package types
+
+import "time"
+
+type RelayState string
+
+const (
+	RelayStateStarting RelayState = "starting"
+	RelayStateRunning  RelayState = "running"
+	RelayStateBackoff  RelayState = "backoff"
+	RelayStateFailed   RelayState = "failed"
+	RelayStateStopped  RelayState = "stopped"
+)
+
+// RelayMetrics is what ffmpeg last reported about a relay's output. A
+// Speed below 1 means the relay is not keeping up with the stream, and
+// rising DropFrames or DupFrames that its output is uneven.
+type RelayMetrics struct {
+	Frames      int64     `json:"frames"`
+	FPS         float64   `json:"fps"`
+	BitrateKbps float64   `json:"bitrateKbps"`
+	DropFrames  int64     `json:"dropFrames"`
+	DupFrames   int64     `json:"dupFrames"`
+	Speed       float64   `json:"speed"`
+	TotalSize   int64     `json:"totalSize"`
+	OutTime     float64   `json:"outTime"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// RelayStatus is the state of the ffmpeg process relaying a stream to one
+// platform. Restarts counts the restarts since the relay last stayed up;
+// once it exceeds the retry budget the relay is failed and left down.
+type RelayStatus struct {
+	Name          string        `json:"name"`
+	Platform      string        `json:"platform,omitempty"`
+	State         RelayState    `json:"state"`
+	PID           int           `json:"pid,omitempty"`
+	Restarts      int           `json:"restarts"`
+	LastError     string        `json:"lastError,omitempty"`
+	Metrics       *RelayMetrics `json:"metrics,omitempty"`
+	StartedAt     time.Time     `json:"startedAt"`
+	NextRestartAt time.Time     `json:"nextRestartAt,omitzero"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+}
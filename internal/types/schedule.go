@@ -0,0 +1,75 @@
+package types
+
+import "time"
+
+type ScheduleStatus string
+
+const (
+	ScheduleStatusScheduled   ScheduleStatus = "scheduled"
+	ScheduleStatusRecurring   ScheduleStatus = "recurring"
+	ScheduleStatusProvisioned ScheduleStatus = "provisioned"
+	ScheduleStatusLive        ScheduleStatus = "live"
+	ScheduleStatusEnded       ScheduleStatus = "ended"
+	ScheduleStatusFailed      ScheduleStatus = "failed"
+	ScheduleStatusCancelled   ScheduleStatus = "cancelled"
+)
+
+// Recurrence describes a repeating schedule as either an RRULE
+// (e.g. "FREQ=WEEKLY;BYDAY=TU") or a five field cron expression
+// (e.g. "0 19 * * 2"), evaluated in Timezone.
+type Recurrence struct {
+	RRule    string `json:"rrule,omitempty"`
+	Cron     string `json:"cron,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+type OccurrenceOverride struct {
+	Skip        bool       `json:"skip,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	StartTime   *time.Time `json:"startTime,omitempty"`
+}
+
+type Occurrence struct {
+	Key         string    `json:"key"`
+	StartTime   time.Time `json:"startTime"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Skipped     bool      `json:"skipped"`
+	ScheduleID  string    `json:"scheduleId,omitempty"`
+}
+
+type ScheduleRequest struct {
+	UserID       string      `json:"userID"`
+	StreamKey    string      `json:"streamKey,omitempty"`
+	KeyID        string      `json:"keyID,omitempty"`
+	KeyName      string      `json:"keyName,omitempty"`
+	Title        string      `json:"title"`
+	Description  string      `json:"description"`
+	Privacy      string      `json:"privacy"`
+	Destinations []string    `json:"destinations"`
+	StartTime    time.Time   `json:"startTime"`
+	Recurrence   *Recurrence `json:"recurrence,omitempty"`
+}
+
+type ScheduledStream struct {
+	ID             string                        `json:"id"`
+	UserID         string                        `json:"userID"`
+	Title          string                        `json:"title"`
+	Description    string                        `json:"description"`
+	Privacy        string                        `json:"privacy"`
+	Destinations   []string                      `json:"destinations"`
+	StreamKeyID    string                        `json:"streamKeyId,omitempty"`
+	StreamKeyName  string                        `json:"streamKeyName,omitempty"`
+	StartTime      time.Time                     `json:"startTime"`
+	Status         ScheduleStatus                `json:"status"`
+	Error          string                        `json:"error,omitempty"`
+	Broadcasts     []StreamResponse              `json:"broadcasts,omitempty"`
+	Recurrence     *Recurrence                   `json:"recurrence,omitempty"`
+	Overrides      map[string]OccurrenceOverride `json:"overrides,omitempty"`
+	NextOccurrence *time.Time                    `json:"nextOccurrence,omitempty"`
+	SeriesID       string                        `json:"seriesId,omitempty"`
+	OccurrenceKey  string                        `json:"occurrenceKey,omitempty"`
+	CreatedAt      time.Time                     `json:"createdAt"`
+	UpdatedAt      time.Time                     `json:"updatedAt"`
+}
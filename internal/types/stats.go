@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+type IngestVideoStats struct {
+	Codec     string  `json:"codec"`
+	Profile   string  `json:"profile,omitempty"`
+	Level     string  `json:"level,omitempty"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frameRate"`
+}
+
+type IngestAudioStats struct {
+	Codec      string `json:"codec"`
+	Profile    string `json:"profile,omitempty"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+// IngestStats describes what the encoder is delivering to the media server
+// for one stream key. Players counts everything pulling the stream, the
+// platform relays included.
+type IngestStats struct {
+	StreamID  string            `json:"streamId"`
+	ClientID  string            `json:"clientId"`
+	IP        string            `json:"ip"`
+	Protocol  string            `json:"protocol,omitempty"`
+	LiveSince time.Time         `json:"liveSince"`
+	Video     *IngestVideoStats `json:"video,omitempty"`
+	Audio     *IngestAudioStats `json:"audio,omitempty"`
+	RecvKbps  int               `json:"recvKbps"`
+	SendKbps  int               `json:"sendKbps"`
+	Clients   int               `json:"clients"`
+	Players   int               `json:"players"`
+	SampledAt time.Time         `json:"sampledAt"`
+}
+
+// StreamClient is a connection to the media server, publishing or playing,
+// identified by the stream key it is attached to rather than its stream
+// name, which may be the plaintext key.
+type StreamClient struct {
+	ClientID  string  `json:"clientId"`
+	StreamID  string  `json:"streamId,omitempty"`
+	IP        string  `json:"ip"`
+	Type      string  `json:"type"`
+	Publisher bool    `json:"publisher"`
+	Alive     float64 `json:"aliveSeconds"`
+	RecvKbps  int     `json:"recvKbps"`
+	SendKbps  int     `json:"sendKbps"`
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -17,3 +18,15 @@ func GenerateRandomString() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 
 }
+
+func GenerateID() (string, error) {
+
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+
+}